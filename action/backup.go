@@ -0,0 +1,119 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// backupSuffix names the on-disk copy of the original settings, so they can
+// still be recovered if the action is killed before restoring them.
+const backupSuffix = ".iflow-action.bak"
+
+// settingsBackup records the state of ~/.iflow before the action touched it.
+type settingsBackup struct {
+	dir        string
+	path       string
+	data       []byte
+	mode       os.FileMode
+	existed    bool
+	dirCreated bool
+}
+
+// backupSettings snapshots the settings file in iflowDir before it is
+// overwritten. A leftover backup from an interrupted run takes precedence
+// over the current file, since the current file was written by that run.
+func backupSettings(iflowDir string, logf func(string)) (*settingsBackup, error) {
+	backup := &settingsBackup{
+		dir:  iflowDir,
+		path: filepath.Join(iflowDir, "settings.json"),
+	}
+
+	if _, err := os.Stat(iflowDir); os.IsNotExist(err) {
+		backup.dirCreated = true
+		return backup, nil
+	}
+
+	source := backup.path
+	if _, err := os.Stat(backup.path + backupSuffix); err == nil {
+		logf(fmt.Sprintf("Found backup from an interrupted run, restoring from %s", backup.path+backupSuffix))
+		source = backup.path + backupSuffix
+	}
+
+	stat, err := os.Stat(source)
+	if os.IsNotExist(err) {
+		return backup, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect existing settings: %w", err)
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing settings: %w", err)
+	}
+	backup.data = data
+	backup.mode = stat.Mode().Perm()
+	backup.existed = true
+
+	if source == backup.path {
+		if err := os.WriteFile(backup.path+backupSuffix, data, backup.mode); err != nil {
+			return nil, fmt.Errorf("failed to write settings backup: %w", err)
+		}
+	}
+
+	logf(fmt.Sprintf("Backed up existing iFlow settings from %s", backup.path))
+	return backup, nil
+}
+
+// existingSettings decodes the backed-up settings, if any.
+func (b *settingsBackup) existingSettings() (map[string]interface{}, error) {
+	if !b.existed {
+		return nil, nil
+	}
+	return parseExistingSettings(b.path, b.data)
+}
+
+// readExistingSettings decodes the settings file at path, if it exists.
+func readExistingSettings(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing settings: %w", err)
+	}
+	return parseExistingSettings(path, data)
+}
+
+func parseExistingSettings(path string, data []byte) (map[string]interface{}, error) {
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return nil, fmt.Errorf("failed to parse existing settings %s: %w", path, err)
+	}
+	return settings, nil
+}
+
+// restore puts ~/.iflow back into the state recorded by backupSettings.
+func (b *settingsBackup) restore() error {
+	if b.dirCreated {
+		if err := os.RemoveAll(b.dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %w", b.dir, err)
+		}
+		return nil
+	}
+
+	if b.existed {
+		if err := os.WriteFile(b.path, b.data, b.mode); err != nil {
+			return fmt.Errorf("failed to restore settings: %w", err)
+		}
+	} else if err := os.Remove(b.path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove settings: %w", err)
+	}
+
+	if err := os.Remove(b.path + backupSuffix); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove settings backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSettingsBackupRestore(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(dir string)
+		original string
+	}{
+		{
+			name: "Existing settings",
+			setup: func(dir string) {
+				os.MkdirAll(dir, 0755)
+				os.WriteFile(filepath.Join(dir, "settings.json"), []byte(`{"theme":"Dark"}`), 0600)
+			},
+			original: `{"theme":"Dark"}`,
+		},
+		{
+			name: "Stale backup from interrupted run",
+			setup: func(dir string) {
+				os.MkdirAll(dir, 0755)
+				os.WriteFile(filepath.Join(dir, "settings.json"), []byte(`{"apiKey":"leaked"}`), 0644)
+				os.WriteFile(filepath.Join(dir, "settings.json"+backupSuffix), []byte(`{"theme":"Light"}`), 0600)
+			},
+			original: `{"theme":"Light"}`,
+		},
+		{
+			name:  "No settings directory",
+			setup: func(dir string) {},
+		},
+		{
+			name: "Directory without settings",
+			setup: func(dir string) {
+				os.MkdirAll(dir, 0755)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), ".iflow")
+			tt.setup(dir)
+			_, dirErr := os.Stat(dir)
+			dirExisted := dirErr == nil
+
+			backup, err := backupSettings(dir, func(string) {})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Simulate the action overwriting the settings
+			os.MkdirAll(dir, 0755)
+			if err := os.WriteFile(filepath.Join(dir, "settings.json"), []byte(`{"apiKey":"sk-test"}`), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := backup.restore(); err != nil {
+				t.Fatalf("Unexpected restore error: %v", err)
+			}
+
+			if _, err := os.Stat(filepath.Join(dir, "settings.json"+backupSuffix)); !os.IsNotExist(err) {
+				t.Errorf("Expected backup file to be removed")
+			}
+			if !dirExisted {
+				if _, err := os.Stat(dir); !os.IsNotExist(err) {
+					t.Errorf("Expected created directory to be removed")
+				}
+				return
+			}
+
+			data, err := os.ReadFile(filepath.Join(dir, "settings.json"))
+			if tt.original == "" {
+				if !os.IsNotExist(err) {
+					t.Errorf("Expected settings file to be removed, got %q", data)
+				}
+				return
+			}
+			if string(data) != tt.original {
+				t.Errorf("Expected restored settings %q, got %q", tt.original, data)
+			}
+		})
+	}
+}
+
+func TestRunCleanup(t *testing.T) {
+	r := &run{}
+	var order []int
+	r.addCleanup(func() { order = append(order, 1) })
+	r.addCleanup(func() { order = append(order, 2) })
+
+	r.cleanup()
+	r.cleanup()
+
+	if len(order) != 2 || order[0] != 2 || order[1] != 1 {
+		t.Errorf("Expected cleanups to run once in reverse order, got %v", order)
+	}
+}
@@ -0,0 +1,105 @@
+//go:build linux
+
+package action
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroupRoot is where the cgroup v2 hierarchy is mounted.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// cgroup is a cgroup v2 sub-group of the runner's own group that limits the
+// memory of one process and its descendants.
+type cgroup struct {
+	dir string
+}
+
+// newCgroup creates a sub-group with its memory capped at memoryMB. It fails
+// when cgroup v2 is not mounted, not writable or has no memory controller
+// for the runner's group, e.g. in most containers.
+func newCgroup(memoryMB int) (*cgroup, error) {
+	if _, err := os.Stat(filepath.Join(cgroupRoot, "cgroup.controllers")); err != nil {
+		return nil, errors.New("cgroup v2 is not available")
+	}
+	own, err := ownCgroup()
+	if err != nil {
+		return nil, err
+	}
+
+	parent := filepath.Join(cgroupRoot, own)
+	dir, err := os.MkdirTemp(parent, "iflow-")
+	if err != nil {
+		return nil, err
+	}
+	group := &cgroup{dir: dir}
+
+	if _, err := os.Stat(filepath.Join(dir, "memory.max")); err != nil {
+		// Only succeeds when no process lives in the parent group itself
+		os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte("+memory"), 0)
+		if _, err := os.Stat(filepath.Join(dir, "memory.max")); err != nil {
+			group.remove()
+			return nil, errors.New("the memory controller is not enabled")
+		}
+	}
+
+	limit := strconv.FormatInt(int64(memoryMB)*1024*1024, 10)
+	if err := os.WriteFile(filepath.Join(dir, "memory.max"), []byte(limit), 0); err != nil {
+		group.remove()
+		return nil, err
+	}
+	// Swapping would only delay hitting the limit
+	os.WriteFile(filepath.Join(dir, "memory.swap.max"), []byte("0"), 0)
+	return group, nil
+}
+
+// ownCgroup returns the cgroup v2 path of this process.
+func ownCgroup() (string, error) {
+	file, err := os.Open("/proc/self/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return path, nil
+		}
+	}
+	return "", errors.New("the process is not in a cgroup v2 group")
+}
+
+// add moves a started process into the group. Its descendants are created
+// in the group.
+func (g *cgroup) add(pid int) error {
+	return os.WriteFile(filepath.Join(g.dir, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0)
+}
+
+// peakMemory returns the group's peak memory usage in bytes, or 0 when the
+// kernel does not track it.
+func (g *cgroup) peakMemory() int64 {
+	data, err := os.ReadFile(filepath.Join(g.dir, "memory.peak"))
+	if err != nil {
+		return 0
+	}
+	peak, _ := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	return peak
+}
+
+// remove kills what is left in the group and deletes it.
+func (g *cgroup) remove() {
+	os.WriteFile(filepath.Join(g.dir, "cgroup.kill"), []byte("1"), 0)
+	for range 20 {
+		if err := os.Remove(g.dir); err == nil || os.IsNotExist(err) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package action
+
+import "errors"
+
+// cgroup is not available outside Linux.
+type cgroup struct{}
+
+// newCgroup reports that cgroups are only available on Linux.
+func newCgroup(memoryMB int) (*cgroup, error) {
+	return nil, errors.New("cgroups are only available on Linux")
+}
+
+func (g *cgroup) add(pid int) error { return nil }
+
+func (g *cgroup) peakMemory() int64 { return 0 }
+
+func (g *cgroup) remove() {}
@@ -0,0 +1,282 @@
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Statuses of a FileChange.
+const (
+	ChangeAdded    = "added"
+	ChangeModified = "modified"
+	ChangeDeleted  = "deleted"
+)
+
+// FileChange is a file iflow added, modified or deleted.
+type FileChange struct {
+	Path      string // Relative to the top of the working tree, with forward slashes
+	Status    string // ChangeAdded, ChangeModified or ChangeDeleted
+	Additions int    // Lines added; 0 for binary files
+	Deletions int    // Lines deleted; 0 for binary files
+	Binary    bool
+}
+
+// Changes are the files changed in the working tree while iflow ran.
+type Changes struct {
+	Files     []FileChange // Sorted by path
+	PatchFile string       // Unified diff of the changes, usable with git apply; empty without changes
+}
+
+// Paths returns the paths of the changed files with the given status, or of
+// every changed file when status is empty.
+func (c *Changes) Paths(status string) []string {
+	var paths []string
+	for _, file := range c.Files {
+		if status == "" || file.Status == status {
+			paths = append(paths, file.Path)
+		}
+	}
+	return paths
+}
+
+// Lines returns the number of lines added and deleted in all files.
+func (c *Changes) Lines() (additions, deletions int) {
+	for _, file := range c.Files {
+		additions += file.Additions
+		deletions += file.Deletions
+	}
+	return additions, deletions
+}
+
+// treeHasher records states of a working tree as git tree objects. It uses
+// its own index and object directory, so neither the index nor the object
+// store of the repository are touched; outside a repository the working tree
+// is hashed into a scratch repository instead. Ignored files are left out in
+// a repository.
+type treeHasher struct {
+	dir string   // Top of the working tree
+	env []string // Points git at the scratch index and objects
+}
+
+// newTreeHasher prepares to hash the working tree containing dir, keeping
+// its state in the scratch directory.
+func newTreeHasher(dir, scratch string) (*treeHasher, error) {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	h := &treeHasher{dir: absDir}
+	index := filepath.Join(scratch, "index")
+	objects := filepath.Join(scratch, "objects")
+
+	gitDir, err := h.git("rev-parse", "--absolute-git-dir")
+	if err != nil {
+		// Not a repository: hash into a scratch one
+		repo := filepath.Join(scratch, "repo")
+		if _, err := h.git("init", "--quiet", "--bare", repo); err != nil {
+			return nil, err
+		}
+		h.env = []string{"GIT_DIR=" + repo, "GIT_WORK_TREE=" + absDir, "GIT_INDEX_FILE=" + index}
+		return h, nil
+	}
+
+	top, err := h.git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, err
+	}
+	// A linked worktree, as in patch mode, shares the objects of the main
+	// repository rather than having its own
+	commonDir, err := h.git("rev-parse", "--git-common-dir")
+	if err != nil {
+		return nil, err
+	}
+	if !filepath.IsAbs(commonDir) {
+		commonDir = filepath.Join(absDir, commonDir)
+	}
+	h.dir = top
+
+	// Starting from a copy of the index lets git skip files whose stat data
+	// is unchanged instead of hashing the whole tree
+	if err := copyFile(filepath.Join(gitDir, "index"), index); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := os.MkdirAll(objects, 0755); err != nil {
+		return nil, err
+	}
+	h.env = []string{
+		"GIT_INDEX_FILE=" + index,
+		"GIT_OBJECT_DIRECTORY=" + objects,
+		"GIT_ALTERNATE_OBJECT_DIRECTORIES=" + filepath.Join(commonDir, "objects"),
+	}
+	return h, nil
+}
+
+// snapshot hashes the current state of the working tree and returns the
+// hash of its tree.
+func (h *treeHasher) snapshot() (string, error) {
+	if _, err := h.git("add", "--all", "."); err != nil {
+		return "", err
+	}
+	return h.git("write-tree")
+}
+
+// diff returns the files changed between two snapshots and a patch of the
+// changes.
+func (h *treeHasher) diff(before, after string) ([]FileChange, string, error) {
+	nameStatus, err := h.git("diff", "--no-renames", "-z", "--name-status", before, after)
+	if err != nil {
+		return nil, "", err
+	}
+	numstat, err := h.git("diff", "--no-renames", "-z", "--numstat", before, after)
+	if err != nil {
+		return nil, "", err
+	}
+	files, err := parseChanges(nameStatus, numstat)
+	if err != nil || len(files) == 0 {
+		return files, "", err
+	}
+	patch, err := h.git("diff", "--no-renames", "--binary", before, after)
+	if err != nil {
+		return nil, "", err
+	}
+	return files, patch + "\n", nil
+}
+
+// git runs git in the working tree with the scratch index and objects.
+func (h *treeHasher) git(args ...string) (string, error) {
+	return gitOutput(h.dir, h.env, args...)
+}
+
+// gitOutput runs git in dir with env added to the environment and returns
+// its trimmed output. Repositories owned by another user, as in container
+// actions, are allowed.
+func gitOutput(dir string, env []string, args ...string) (string, error) {
+	return gitWithInput(dir, env, "", args...)
+}
+
+// gitWithInput is gitOutput with stdin as the standard input of git.
+func gitWithInput(dir string, env []string, stdin string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-c", "safe.directory=*", "-c", "core.quotePath=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
+
+// parseChanges combines the -z output of git diff --name-status and
+// --numstat.
+func parseChanges(nameStatus, numstat string) ([]FileChange, error) {
+	var files []FileChange
+	byPath := make(map[string]int)
+	fields := strings.Split(strings.TrimSuffix(nameStatus, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		status := ChangeModified
+		switch fields[i] {
+		case "A":
+			status = ChangeAdded
+		case "D":
+			status = ChangeDeleted
+		}
+		byPath[fields[i+1]] = len(files)
+		files = append(files, FileChange{Path: fields[i+1], Status: status})
+	}
+
+	for _, line := range strings.Split(strings.TrimSuffix(numstat, "\x00"), "\x00") {
+		parts := strings.SplitN(line, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		i, ok := byPath[parts[2]]
+		if !ok {
+			return nil, fmt.Errorf("git diff --numstat reported unknown file %q", parts[2])
+		}
+		if parts[0] == "-" {
+			files[i].Binary = true
+			continue
+		}
+		files[i].Additions, _ = strconv.Atoi(parts[0])
+		files[i].Deletions, _ = strconv.Atoi(parts[1])
+	}
+	return files, nil
+}
+
+// copyFile copies a regular file with its permissions.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// snapshotWorkingTree records the state of the working directory before
+// iflow runs.
+func (r *run) snapshotWorkingTree() error {
+	scratch, err := os.MkdirTemp(tempParent(), "iflow-changes-")
+	if err != nil {
+		return err
+	}
+	r.addCleanup(func() { os.RemoveAll(scratch) })
+
+	hasher, err := newTreeHasher(r.workingDir(), scratch)
+	if err != nil {
+		return err
+	}
+	if r.treeBefore, err = hasher.snapshot(); err != nil {
+		return err
+	}
+	r.hasher = hasher
+	return nil
+}
+
+// detectChanges compares the working tree with the snapshot taken before
+// iflow ran and writes the patch next to the other output files.
+func (r *run) detectChanges(result *Result) {
+	after, err := r.hasher.snapshot()
+	var files []FileChange
+	var patch string
+	if err == nil {
+		files, patch, err = r.hasher.diff(r.treeBefore, after)
+	}
+	if err != nil {
+		r.info(fmt.Sprintf("Warning: failed to detect changed files: %v", err))
+		return
+	}
+
+	changes := &Changes{Files: files}
+	if patch != "" {
+		path := filepath.Join(r.outputDir, "changes.patch")
+		if err := os.WriteFile(path, []byte(r.redactor.Redact(patch)), 0644); err != nil {
+			r.info(fmt.Sprintf("Warning: failed to write the patch of the changes: %v", err))
+		} else {
+			changes.PatchFile = path
+		}
+	}
+	result.Changes = changes
+	r.info(fmt.Sprintf("iFlow CLI changed %d files", len(files)))
+}
@@ -0,0 +1,292 @@
+package action
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// runGit runs git in dir for test setup.
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return string(output)
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestTreeHasher(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Ignored files are left out in plain directories too
+	expected := []FileChange{
+		{Path: "docs/new.md", Status: ChangeAdded, Additions: 2},
+		{Path: "go.sum", Status: ChangeDeleted, Deletions: 1},
+		{Path: "logo.png", Status: ChangeModified, Binary: true},
+		{Path: "main.go", Status: ChangeModified, Additions: 1, Deletions: 1},
+	}
+
+	tests := []struct {
+		name     string
+		repo     bool
+		worktree bool
+	}{
+		{name: "repository", repo: true},
+		{name: "linked worktree", repo: true, worktree: true},
+		{name: "plain directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{
+				"main.go":    "package main\n\nfunc main() {}\n",
+				"go.sum":     "example.com/x v1.0.0 h1:abc\n",
+				"logo.png":   "\x89PNG\x00\x01",
+				".gitignore": "*.log\n",
+			})
+			var objects string
+			if tt.repo {
+				runGit(t, dir, "init", "--quiet")
+				runGit(t, dir, "add", "--all")
+				runGit(t, dir, "commit", "--quiet", "-m", "Initial commit")
+				if tt.worktree {
+					worktree := filepath.Join(t.TempDir(), "worktree")
+					runGit(t, dir, "worktree", "add", "--quiet", "--detach", worktree)
+					dir = worktree
+				}
+				objects = runGit(t, dir, "count-objects")
+			}
+
+			hasher, err := newTreeHasher(filepath.Join(dir, "."), t.TempDir())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			before, err := hasher.snapshot()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			writeFiles(t, dir, map[string]string{
+				"main.go":     "package main\n\nfunc main() { println() }\n",
+				"logo.png":    "\x89PNG\x00\x02",
+				"docs/new.md": "# New\nText\n",
+				"build.log":   "ok\n",
+			})
+			if err := os.Remove(filepath.Join(dir, "go.sum")); err != nil {
+				t.Fatal(err)
+			}
+
+			after, err := hasher.snapshot()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			files, patch, err := hasher.diff(before, after)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(files, expected) {
+				t.Errorf("Expected changes %+v, got %+v", expected, files)
+			}
+			if !strings.Contains(patch, "+func main() { println() }") || !strings.Contains(patch, "GIT binary patch") {
+				t.Errorf("Expected a binary-safe patch, got %q", patch)
+			}
+
+			if tt.repo {
+				// The hasher reads the objects of the repository, shared by
+				// all of its worktrees
+				if _, err := hasher.git("cat-file", "-e", "HEAD:.gitignore"); err != nil {
+					t.Errorf("Expected the repository's objects to be readable: %v", err)
+				}
+
+				// Neither the index nor the object store of the repository
+				// are touched
+				if status := runGit(t, dir, "status", "--porcelain"); strings.ContainsAny(firstColumns(status), "ADM") {
+					t.Errorf("Expected nothing to be staged, got %q", status)
+				}
+				if count := runGit(t, dir, "count-objects"); count != objects {
+					t.Errorf("Expected no objects to be written to the repository, got %q, was %q", count, objects)
+				}
+
+				// The patch reverts and applies cleanly
+				path := filepath.Join(t.TempDir(), "changes.patch")
+				if err := os.WriteFile(path, []byte(patch), 0644); err != nil {
+					t.Fatal(err)
+				}
+				runGit(t, dir, "apply", "--reverse", path)
+				runGit(t, dir, "apply", path)
+			}
+
+			// Without further changes there is nothing to report
+			again, err := hasher.snapshot()
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if again != after {
+				t.Errorf("Expected the same tree %s, got %s", after, again)
+			}
+		})
+	}
+}
+
+// firstColumns returns the index column of git status --porcelain lines.
+func firstColumns(status string) string {
+	var columns strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(status, "\n"), "\n") {
+		if line != "" {
+			columns.WriteByte(line[0])
+		}
+	}
+	return columns.String()
+}
+
+func TestParseChanges(t *testing.T) {
+	nameStatus := "M\x00a b.go\x00A\x00dir/new\x00D\x00old\x00T\x00link\x00"
+	numstat := "3\t1\ta b.go\x00-\t-\tdir/new\x000\t2\told\x001\t1\tlink\x00"
+
+	files, err := parseChanges(nameStatus, numstat)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []FileChange{
+		{Path: "a b.go", Status: ChangeModified, Additions: 3, Deletions: 1},
+		{Path: "dir/new", Status: ChangeAdded, Binary: true},
+		{Path: "old", Status: ChangeDeleted, Deletions: 2},
+		{Path: "link", Status: ChangeModified, Additions: 1, Deletions: 1},
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, files)
+	}
+
+	if _, err := parseChanges("", "1\t0\tghost\x00"); err == nil {
+		t.Errorf("Expected an error for a file missing from --name-status")
+	}
+
+	changes := &Changes{Files: expected}
+	if paths := changes.Paths(ChangeModified); !reflect.DeepEqual(paths, []string{"a b.go", "link"}) {
+		t.Errorf("Expected the modified paths, got %v", paths)
+	}
+	if additions, deletions := changes.Lines(); additions != 4 || deletions != 4 {
+		t.Errorf("Expected 4 additions and 4 deletions, got %d and %d", additions, deletions)
+	}
+}
+
+// writingExecutor is a fakeExecutor whose iflow invocations write and
+// remove files in the working directory.
+type writingExecutor struct {
+	fakeExecutor
+	files  map[string]string
+	remove []string
+}
+
+func (w *writingExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if cmd.Name == "iflow" && cmd.Args[0] != "--version" {
+		for name, content := range w.files {
+			if err := os.WriteFile(filepath.Join(cmd.Dir, name), []byte(content), 0644); err != nil {
+				return 1, err
+			}
+		}
+		for _, name := range w.remove {
+			if err := os.RemoveAll(filepath.Join(cmd.Dir, name)); err != nil {
+				return 1, err
+			}
+		}
+	}
+	return w.fakeExecutor.Run(ctx, cmd)
+}
+
+func TestRunnerRunDetectChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tests := []struct {
+		name      string
+		detect    bool
+		container bool
+		expected  []string
+	}{
+		{name: "detected", detect: true, expected: []string{"README.md", "fix.go"}},
+		{name: "in the action's container", detect: true, container: true, expected: []string{"README.md", "fix.go"}},
+		{name: "disabled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+			var mounted string
+			if tt.container {
+				mounted = containerLayout(t)
+			}
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"README.md": "# Project\n"})
+
+			runner := &Runner{
+				Executor: &writingExecutor{files: map[string]string{
+					"README.md": "# Project\n\nFixed with sk-secret-value\n",
+					"fix.go":    "package fix\n",
+				}},
+				Logger: ConsoleLogger{Out: io.Discard},
+				Stdout: io.Discard,
+				Stderr: io.Discard,
+			}
+			cfg := DefaultConfig()
+			cfg.Prompt = "Fix the bug"
+			cfg.APIKey = "sk-secret-value"
+			cfg.WorkingDir = dir
+			cfg.DetectChanges = tt.detect
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !tt.detect {
+				if result.Changes != nil {
+					t.Errorf("Expected no change detection, got %+v", result.Changes)
+				}
+				return
+			}
+			if result.Changes == nil {
+				t.Fatalf("Expected changes to be detected")
+			}
+			if paths := result.Changes.Paths(""); !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("Expected changed files %v, got %v", tt.expected, paths)
+			}
+			path := result.Changes.PatchFile
+			if tt.container {
+				path = mountedPath(t, mounted, path)
+			}
+			patch, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Expected a patch file: %v", err)
+			}
+			if !strings.Contains(string(patch), "+package fix") || strings.Contains(string(patch), "sk-secret-value") {
+				t.Errorf("Expected a redacted patch of the changes, got %q", patch)
+			}
+		})
+	}
+}
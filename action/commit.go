@@ -0,0 +1,376 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Defaults of the commit inputs, shared with the command-line flags.
+const (
+	DefaultBranchName        = `iflow/run-{{ or (index .GitHub "run_id") "local" }}-{{ or (index .GitHub "run_attempt") "1" }}`
+	DefaultCommitMessage     = "Apply changes made by iFlow CLI"
+	DefaultCommitAuthorName  = "github-actions[bot]"
+	DefaultCommitAuthorEmail = "41898282+github-actions[bot]@users.noreply.github.com"
+)
+
+// maxCommitMessageDiff caps the bytes of the patch shown to iflow when it
+// writes the commit message.
+const maxCommitMessageDiff = 20000
+
+// Commit is the commit of the changes made by iflow.
+type Commit struct {
+	SHA     string
+	Branch  string
+	Message string
+	Pushed  bool // The branch was pushed to origin
+}
+
+// ExitCodeCommitFailed is reported when iflow succeeded but its changes could
+// not be committed or pushed, like EX_CANTCREAT of sysexits.h.
+const ExitCodeCommitFailed = 73
+
+// CommitData is the data passed to the commit_message template: the
+// PromptData and the changed files.
+//
+//	{{ range .Files }}{{ .Path }} {{ end }}
+type CommitData struct {
+	PromptData
+	Prompt string
+	Files  []FileChange
+}
+
+// validateCommit returns every problem with the commit inputs.
+func (c *Config) validateCommit() []error {
+	var problems []error
+	if !c.CommitChanges {
+		if c.PushChanges {
+			problems = append(problems, fmt.Errorf("push_changes requires commit_changes"))
+		}
+		return problems
+	}
+	if !c.DetectChanges {
+		problems = append(problems, fmt.Errorf("commit_changes requires detect_changes"))
+	}
+	if len(c.Models) > 0 {
+		problems = append(problems, fmt.Errorf("commit_changes cannot be combined with models"))
+	}
+	if strings.TrimSpace(c.BranchName) == "" {
+		problems = append(problems, fmt.Errorf("commit_changes requires branch_name"))
+	} else if _, err := parsePromptTemplate(c.BranchName); err != nil {
+		problems = append(problems, fmt.Errorf("invalid branch_name: %w", err))
+	}
+	if _, err := parsePromptTemplate(c.CommitMessage); err != nil {
+		problems = append(problems, fmt.Errorf("invalid commit_message: %w", err))
+	}
+	if strings.TrimSpace(c.CommitAuthorName) == "" || strings.TrimSpace(c.CommitAuthorEmail) == "" {
+		problems = append(problems, fmt.Errorf("commit_changes requires commit_author_name and commit_author_email"))
+	}
+	return problems
+}
+
+// prepareCommit renders the branch name and checks that the branch can be
+// created, so a run that could not commit fails before iflow runs.
+func (r *run) prepareCommit() error {
+	data, err := loadPromptData()
+	if err != nil {
+		return err
+	}
+	branch, err := RenderPrompt(r.cfg.BranchName, data)
+	if err != nil {
+		return fmt.Errorf("invalid branch_name: %w", err)
+	}
+	branch = strings.TrimSpace(branch)
+
+	top, err := gitOutput(r.workingDir(), nil, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return fmt.Errorf("commit_changes requires a git repository: %w", err)
+	}
+	if _, err := gitOutput(top, nil, "check-ref-format", "--branch", branch); err != nil {
+		return fmt.Errorf("invalid branch name %q", branch)
+	}
+	if _, err := gitOutput(top, nil, "rev-parse", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+		return fmt.Errorf("branch %q already exists", branch)
+	}
+
+	r.commitTop = top
+	r.commitBranch = branch
+	r.commitData = data
+	r.info(fmt.Sprintf("Changes will be committed to the new branch %s", branch))
+	return nil
+}
+
+// commitChanges commits the changes of a successful run to the new branch
+// and pushes it when requested. A failure fails the run with
+// ExitCodeCommitFailed; iflow's output is still published.
+func (r *run) commitChanges(ctx context.Context, result *Result) {
+	files, err := committedFiles(r.commitTop, result.Changes.Files)
+	if err != nil {
+		r.failCommit(result, fmt.Errorf("failed to commit the changes: %w", err))
+		return
+	}
+	if len(files) == 0 {
+		r.info("No changes to commit")
+		return
+	}
+	changes := &Changes{Files: files, PatchFile: result.Changes.PatchFile}
+
+	message, err := r.commitMessage(ctx, commitPrompt(r.cfg.Prompt, result.Steps), changes)
+	if err != nil {
+		r.failCommit(result, fmt.Errorf("failed to commit the changes: %w", err))
+		return
+	}
+
+	// Outside patch mode the workspace moves to the new branch, as if the
+	// commit had been made by hand
+	checkout := r.workspace == ""
+	sha, err := createCommit(r.commitTop, r.commitBranch, message, changes.Paths(""), r.commitEnv(), checkout)
+	if err != nil {
+		r.failCommit(result, fmt.Errorf("failed to commit the changes: %w", err))
+		return
+	}
+	result.Commit = &Commit{SHA: sha, Branch: r.commitBranch, Message: message}
+	r.info(fmt.Sprintf("Committed the changes as %s on branch %s", sha, r.commitBranch))
+
+	if r.cfg.PushChanges {
+		ref := "refs/heads/" + r.commitBranch
+		if _, err := gitOutput(r.commitTop, nil, "push", "origin", ref+":"+ref); err != nil {
+			r.failCommit(result, fmt.Errorf("failed to push branch %s: %w", r.commitBranch, err))
+			return
+		}
+		result.Commit.Pushed = true
+		r.info(fmt.Sprintf("Pushed branch %s to origin", r.commitBranch))
+	}
+}
+
+// failCommit records why the changes could not be committed or pushed and
+// fails the run.
+func (r *run) failCommit(result *Result, err error) {
+	result.CommitError = r.redactor.Redact(err.Error())
+	result.ExitCode = ExitCodeCommitFailed
+	r.info(fmt.Sprintf("Error: %s", result.CommitError))
+}
+
+// committedFiles leaves out of files the deleted files that are not in HEAD:
+// files created and deleted again while iflow ran, which were untracked
+// before, have nothing to commit.
+func committedFiles(top string, files []FileChange) ([]FileChange, error) {
+	var deleted []string
+	for _, file := range files {
+		if file.Status == ChangeDeleted {
+			deleted = append(deleted, file.Path)
+		}
+	}
+	if len(deleted) == 0 {
+		return files, nil
+	}
+
+	inHead := make(map[string]bool)
+	if _, err := gitOutput(top, nil, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err == nil {
+		listed, err := gitOutput(top, nil, append([]string{"ls-tree", "-r", "-z", "--name-only", "--full-tree", "HEAD", "--"}, deleted...)...)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range strings.Split(listed, "\x00") {
+			inHead[path] = true
+		}
+	}
+
+	var committed []FileChange
+	for _, file := range files {
+		if file.Status != ChangeDeleted || inHead[file.Path] {
+			committed = append(committed, file)
+		}
+	}
+	return committed, nil
+}
+
+// commitPrompt returns what the changes were made for: the rendered prompts
+// of the steps that ran, one after another, or else the prompt.
+func commitPrompt(prompt string, steps []StepResult) string {
+	if len(steps) == 0 {
+		return prompt
+	}
+	var prompts []string
+	for _, step := range steps {
+		if !step.Skipped {
+			prompts = append(prompts, step.Prompt)
+		}
+	}
+	return strings.Join(prompts, "\n\n")
+}
+
+// commitMessage renders commit_message, or asks iflow to write the message
+// when requested, falling back to commit_message. Sign-off is added last.
+func (r *run) commitMessage(ctx context.Context, prompt string, changes *Changes) (string, error) {
+	data := CommitData{PromptData: r.commitData, Prompt: prompt, Files: changes.Files}
+	tmpl, err := parsePromptTemplate(r.cfg.CommitMessage)
+	if err != nil {
+		return "", err
+	}
+	var rendered strings.Builder
+	if err := tmpl.Execute(&rendered, data); err != nil {
+		return "", fmt.Errorf("failed to render commit_message: %w", err)
+	}
+	message := strings.TrimSpace(rendered.String())
+
+	if r.cfg.GenerateCommitMessage {
+		generated, err := r.generateCommitMessage(ctx, prompt, changes)
+		if err != nil {
+			r.info(fmt.Sprintf("Warning: using commit_message, iFlow CLI did not write a commit message: %v", err))
+		} else {
+			message = generated
+		}
+	}
+	if message == "" {
+		message = DefaultCommitMessage
+	}
+
+	if r.cfg.CommitSignoff {
+		trailer := fmt.Sprintf("Signed-off-by: %s <%s>", r.cfg.CommitAuthorName, r.cfg.CommitAuthorEmail)
+		signed, err := gitWithInput(r.commitTop, nil, message+"\n", "interpret-trailers", "--if-exists", "addIfDifferent", "--trailer", trailer)
+		if err != nil {
+			return "", err
+		}
+		message = signed
+	}
+	return message, nil
+}
+
+// generateCommitMessage runs iflow a second time to write the commit
+// message from the patch and the prompt it was made for. It runs in an empty
+// directory, so it cannot change the files about to be committed.
+func (r *run) generateCommitMessage(ctx context.Context, prompt string, changes *Changes) (string, error) {
+	patch, err := os.ReadFile(changes.PatchFile)
+	if err != nil {
+		return "", err
+	}
+	diff := string(patch)
+	if len(diff) > maxCommitMessageDiff {
+		diff = diff[:maxCommitMessageDiff] + "\n... (truncated)"
+	}
+
+	dir, err := os.MkdirTemp(tempParent(), "iflow-commit-message-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	inv := r.promptInvocation()
+	inv.prompt = commitMessagePrompt(prompt, diff)
+	inv.dir = dir
+	inv.name = "commit-message"
+
+	var execution Execution
+	if err := r.executeIFlow(ctx, inv, &execution); err != nil {
+		return "", err
+	}
+	if execution.ExitCode != 0 {
+		return "", fmt.Errorf("iFlow CLI exited with code %d", execution.ExitCode)
+	}
+	message := cleanCommitMessage(execution.Output)
+	if message == "" {
+		return "", fmt.Errorf("iFlow CLI returned an empty message")
+	}
+	return r.redactor.Redact(message), nil
+}
+
+// commitMessagePrompt asks iflow for a commit message describing diff, the
+// result of prompt.
+func commitMessagePrompt(prompt, diff string) string {
+	var b strings.Builder
+	b.WriteString("Write a git commit message for the changes below, which were made for this task:\n\n")
+	b.WriteString(prompt)
+	b.WriteString("\n\nStart with a summary line of at most 72 characters in the imperative mood, then a blank line and a short body explaining what changed and why. ")
+	b.WriteString("Do not run any commands or change any files. Reply with the commit message only, without code fences.\n\n```diff\n")
+	b.WriteString(diff)
+	b.WriteString("\n```\n")
+	return b.String()
+}
+
+// cleanCommitMessage removes a code fence around the message and blank
+// lines around it.
+func cleanCommitMessage(output string) string {
+	message := strings.TrimSpace(output)
+	if strings.HasPrefix(message, "```") && strings.HasSuffix(message, "```") {
+		message = strings.TrimSuffix(message, "```")
+		if _, body, ok := strings.Cut(message, "\n"); ok {
+			message = body
+		} else {
+			message = ""
+		}
+	}
+	return strings.TrimSpace(message)
+}
+
+// commitEnv sets the author and committer of the commit.
+func (r *run) commitEnv() []string {
+	return []string{
+		"GIT_AUTHOR_NAME=" + r.cfg.CommitAuthorName,
+		"GIT_AUTHOR_EMAIL=" + r.cfg.CommitAuthorEmail,
+		"GIT_COMMITTER_NAME=" + r.cfg.CommitAuthorName,
+		"GIT_COMMITTER_EMAIL=" + r.cfg.CommitAuthorEmail,
+	}
+}
+
+// createCommit commits the working tree state of paths on top of HEAD to a
+// new branch, using a scratch index so changes staged by hand are neither
+// committed nor lost. With checkout, HEAD moves to the branch and the index
+// entries of paths match the commit.
+func createCommit(top, branch, message string, paths, env []string, checkout bool) (string, error) {
+	scratch, err := os.MkdirTemp(tempParent(), "iflow-commit-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(scratch)
+
+	pathspec := strings.Join(paths, "\x00")
+	literal := []string{"GIT_LITERAL_PATHSPECS=1"}
+	indexEnv := append([]string{"GIT_INDEX_FILE=" + filepath.Join(scratch, "index")}, literal...)
+
+	parent, err := gitOutput(top, nil, "rev-parse", "--verify", "--quiet", "HEAD^{commit}")
+	if err == nil {
+		_, err = gitOutput(top, indexEnv, "read-tree", parent)
+	} else {
+		parent = ""
+		_, err = gitOutput(top, indexEnv, "read-tree", "--empty")
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := gitWithInput(top, indexEnv, pathspec, "add", "--all", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return "", err
+	}
+	tree, err := gitOutput(top, indexEnv, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"commit-tree", tree, "-F", "-"}
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	sha, err := gitWithInput(top, env, message, args...)
+	if err != nil {
+		return "", err
+	}
+
+	// The empty old value makes the update fail if the branch appeared
+	// since prepareCommit checked
+	ref := "refs/heads/" + branch
+	if _, err := gitOutput(top, nil, "update-ref", "-m", "iflow-cli-action: commit changes", ref, sha, ""); err != nil {
+		return "", err
+	}
+	if !checkout {
+		return sha, nil
+	}
+	if _, err := gitOutput(top, nil, "symbolic-ref", "HEAD", ref); err != nil {
+		return "", err
+	}
+	if _, err := gitWithInput(top, literal, pathspec, "reset", "--quiet", "--pathspec-from-file=-", "--pathspec-file-nul"); err != nil {
+		return "", err
+	}
+	return sha, nil
+}
@@ -0,0 +1,329 @@
+package action
+
+import (
+	"context"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateCommit(t *testing.T) {
+	valid := DefaultConfig()
+	valid.CommitChanges = true
+
+	tests := []struct {
+		name     string
+		change   func(cfg *Config)
+		expected string
+	}{
+		{name: "valid", change: func(cfg *Config) {}},
+		{name: "push without commit", change: func(cfg *Config) { cfg.CommitChanges = false; cfg.PushChanges = true }, expected: "push_changes requires commit_changes"},
+		{name: "without detection", change: func(cfg *Config) { cfg.DetectChanges = false }, expected: "commit_changes requires detect_changes"},
+		{name: "models", change: func(cfg *Config) { cfg.Models = []string{"a", "b"} }, expected: "cannot be combined with models"},
+		{name: "no branch", change: func(cfg *Config) { cfg.BranchName = " " }, expected: "commit_changes requires branch_name"},
+		{name: "branch template", change: func(cfg *Config) { cfg.BranchName = "iflow/{{ .GitHub" }, expected: "invalid branch_name"},
+		{name: "message template", change: func(cfg *Config) { cfg.CommitMessage = "{{ range .Files }}" }, expected: "invalid commit_message"},
+		{name: "no author", change: func(cfg *Config) { cfg.CommitAuthorEmail = "" }, expected: "requires commit_author_name and commit_author_email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := valid
+			tt.change(&cfg)
+			problems := cfg.validateCommit()
+			if tt.expected == "" {
+				if len(problems) != 0 {
+					t.Errorf("Expected no problems, got %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0].Error(), tt.expected) {
+				t.Errorf("Expected a problem containing %q, got %v", tt.expected, problems)
+			}
+		})
+	}
+}
+
+func TestCleanCommitMessage(t *testing.T) {
+	tests := []struct {
+		output   string
+		expected string
+	}{
+		{output: "\nFix the parser\n\nIt crashed.\n", expected: "Fix the parser\n\nIt crashed."},
+		{output: "```\nFix the parser\n```", expected: "Fix the parser"},
+		{output: "```text\nFix the parser\n\nIt crashed.\n```\n", expected: "Fix the parser\n\nIt crashed."},
+		{output: "``````", expected: ""},
+	}
+
+	for _, tt := range tests {
+		if message := cleanCommitMessage(tt.output); message != tt.expected {
+			t.Errorf("cleanCommitMessage(%q) = %q, expected %q", tt.output, message, tt.expected)
+		}
+	}
+}
+
+func TestRunnerRunCommitChanges(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tests := []struct {
+		name      string
+		mode      string
+		generate  bool
+		steps     []Step
+		container bool
+		exitCode  int
+		outputs   []string
+		message   string
+		checkout  bool
+	}{
+		{
+			name:     "direct",
+			message:  "Fix the bug in fix.go main.go\n\nSigned-off-by: Bot <bot@example.com>",
+			checkout: true,
+		},
+		{
+			name:    "patch mode",
+			mode:    ModePatch,
+			message: "Fix the bug in fix.go main.go\n\nSigned-off-by: Bot <bot@example.com>",
+		},
+		{
+			name:     "generated message",
+			generate: true,
+			outputs:  []string{"Done.", "```\nAdd fix.go\n\nThe bug is fixed.\n```"},
+			message:  "Add fix.go\n\nThe bug is fixed.\n\nSigned-off-by: Bot <bot@example.com>",
+			checkout: true,
+		},
+		{
+			name:     "generated message for steps",
+			generate: true,
+			steps:    []Step{{Name: "find", Prompt: "Find the bug"}, {Name: "fix", Prompt: "Fix the bug in main.go"}},
+			outputs:  []string{"Found it.", "Done.", "Add fix.go"},
+			message:  "Add fix.go\n\nSigned-off-by: Bot <bot@example.com>",
+			checkout: true,
+		},
+		{
+			name:      "generated message in the action's container",
+			generate:  true,
+			container: true,
+			outputs:   []string{"Done.", "Add fix.go"},
+			message:   "Add fix.go\n\nSigned-off-by: Bot <bot@example.com>",
+			checkout:  true,
+		},
+		{name: "failed run", exitCode: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+			t.Setenv("GITHUB_RUN_ID", "42")
+			if tt.container {
+				containerLayout(t)
+			}
+
+			remote := t.TempDir()
+			runGit(t, remote, "init", "--quiet", "--bare")
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"main.go": "package main\n", "notes.md": "notes\n"})
+			runGit(t, dir, "init", "--quiet", "--initial-branch=main")
+			runGit(t, dir, "add", "--all")
+			runGit(t, dir, "commit", "--quiet", "-m", "Initial commit")
+			runGit(t, dir, "remote", "add", "origin", remote)
+			// Changes staged by hand are neither committed nor lost
+			writeFiles(t, dir, map[string]string{"notes.md": "staged\n"})
+			runGit(t, dir, "add", "notes.md")
+			// An untracked file iflow deletes has nothing to commit
+			writeFiles(t, dir, map[string]string{"scratch.txt": "scratch\n"})
+
+			executor := &writingExecutor{
+				fakeExecutor: fakeExecutor{outputs: tt.outputs, exitCode: tt.exitCode},
+				files: map[string]string{
+					"main.go": "package main\n\nfunc main() {}\n",
+					"fix.go":  "package main\n",
+				},
+				remove: []string{"scratch.txt"},
+			}
+			runner := &Runner{
+				Executor: executor,
+				Logger:   ConsoleLogger{Out: io.Discard},
+				Stdout:   io.Discard,
+				Stderr:   io.Discard,
+			}
+			cfg := DefaultConfig()
+			cfg.Prompt = "Fix the bug"
+			cfg.APIKey = "sk-test"
+			cfg.WorkingDir = dir
+			cfg.Mode = ModeDirect
+			if tt.mode != "" {
+				cfg.Mode = tt.mode
+			}
+			cfg.CommitChanges = true
+			cfg.BranchName = "iflow/{{ .GitHub.run_id }}"
+			cfg.CommitMessage = "Fix the bug in{{ range .Files }} {{ .Path }}{{ end }}"
+			cfg.GenerateCommitMessage = tt.generate
+			if tt.steps != nil {
+				cfg.Prompt = ""
+				cfg.Steps = tt.steps
+			}
+			cfg.CommitAuthorName = "Bot"
+			cfg.CommitAuthorEmail = "bot@example.com"
+			cfg.CommitSignoff = true
+			cfg.PushChanges = true
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			head := strings.TrimSpace(runGit(t, dir, "symbolic-ref", "--short", "HEAD"))
+			if tt.exitCode != 0 {
+				if result.Commit != nil {
+					t.Errorf("Expected no commit after a failed run, got %+v", result.Commit)
+				}
+				if branches := runGit(t, dir, "branch", "--list", "iflow/*"); branches != "" {
+					t.Errorf("Expected no branch after a failed run, got %q", branches)
+				}
+				return
+			}
+
+			if result.Commit == nil {
+				t.Fatalf("Expected the changes to be committed")
+			}
+			if result.Commit.Branch != "iflow/42" || !result.Commit.Pushed {
+				t.Errorf("Expected branch iflow/42 to be pushed, got %+v", result.Commit)
+			}
+			if result.Commit.Message != tt.message {
+				t.Errorf("Expected message %q, got %q", tt.message, result.Commit.Message)
+			}
+
+			// The message is asked for with the prompts the changes were made for
+			if tt.generate {
+				last := executor.commands[len(executor.commands)-1]
+				prompts := []string{cfg.Prompt}
+				for _, step := range tt.steps {
+					prompts = append(prompts, step.Prompt)
+				}
+				for _, prompt := range prompts {
+					if !strings.Contains(last.Args[2], prompt) {
+						t.Errorf("Expected the commit message prompt to contain %q, got %q", prompt, last.Args[2])
+					}
+				}
+			}
+
+			// The commit holds exactly iflow's changes on top of HEAD
+			show := runGit(t, dir, "show", "--name-status", "--format=%an <%ae>%n%B", result.Commit.SHA)
+			for _, expected := range []string{"Bot <bot@example.com>", "A\tfix.go", "M\tmain.go"} {
+				if !strings.Contains(show, expected) {
+					t.Errorf("Expected the commit to contain %q, got %q", expected, show)
+				}
+			}
+			if strings.Contains(show, "notes.md") || strings.Contains(show, "scratch.txt") {
+				t.Errorf("Expected neither the staged notes.md nor the untracked scratch.txt to be committed, got %q", show)
+			}
+			if sha := strings.TrimSpace(runGit(t, remote, "rev-parse", "refs/heads/iflow/42")); sha != result.Commit.SHA {
+				t.Errorf("Expected the remote branch at %s, got %s", result.Commit.SHA, sha)
+			}
+
+			status := runGit(t, dir, "status", "--porcelain")
+			if tt.checkout {
+				if head != "iflow/42" {
+					t.Errorf("Expected HEAD to move to the new branch, got %s", head)
+				}
+				if status != "M  notes.md\n" {
+					t.Errorf("Expected only notes.md to stay staged, got %q", status)
+				}
+			} else {
+				if head != "main" {
+					t.Errorf("Expected HEAD to stay on main, got %s", head)
+				}
+				if status != "M  notes.md\n?? scratch.txt\n" {
+					t.Errorf("Expected the working directory to be untouched, got %q", status)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerRunCommitPushFails(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n"})
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "add", "--all")
+	runGit(t, dir, "commit", "--quiet", "-m", "Initial commit")
+	runGit(t, dir, "remote", "add", "origin", filepath.Join(t.TempDir(), "missing"))
+
+	runner := &Runner{
+		Executor: &writingExecutor{files: map[string]string{"fix.go": "package main\n"}},
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+	cfg := DefaultConfig()
+	cfg.Prompt = "Fix the bug"
+	cfg.APIKey = "sk-test"
+	cfg.WorkingDir = dir
+	cfg.CommitChanges = true
+	cfg.PushChanges = true
+	cfg.BranchName = "iflow/fix"
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The commit is kept, but the run fails
+	if result.Commit == nil || result.Commit.Branch != "iflow/fix" || result.Commit.Pushed {
+		t.Errorf("Expected an unpushed commit on iflow/fix, got %+v", result.Commit)
+	}
+	if result.ExitCode != ExitCodeCommitFailed || result.Outcome() != OutcomeFailure {
+		t.Errorf("Expected exit code %d, got %d (%s)", ExitCodeCommitFailed, result.ExitCode, result.Outcome())
+	}
+	if !strings.Contains(result.CommitError, "failed to push branch iflow/fix") {
+		t.Errorf("Expected the push failure to be reported, got %q", result.CommitError)
+	}
+}
+
+func TestRunnerRunCommitBranchExists(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"main.go": "package main\n"})
+	runGit(t, dir, "init", "--quiet")
+	runGit(t, dir, "add", "--all")
+	runGit(t, dir, "commit", "--quiet", "-m", "Initial commit")
+	runGit(t, dir, "branch", "iflow/fix")
+
+	executor := &fakeExecutor{}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+	cfg := DefaultConfig()
+	cfg.Prompt = "Fix the bug"
+	cfg.APIKey = "sk-test"
+	cfg.WorkingDir = dir
+	cfg.CommitChanges = true
+	cfg.BranchName = "iflow/fix"
+
+	if _, err := runner.Run(context.Background(), cfg); err == nil || !strings.Contains(err.Error(), `branch "iflow/fix" already exists`) {
+		t.Errorf("Expected an error for the existing branch, got %v", err)
+	}
+	for _, cmd := range executor.commands {
+		if cmd.Name == "iflow" && cmd.Args[0] != "--version" {
+			t.Errorf("Expected iflow not to run, got %v", cmd.Args)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Package action runs the iFlow CLI the way the iFlow CLI GitHub Action does:
+// it resolves the prompt and settings, writes ~/.iflow/settings.json, runs
+// pre-commands and iflow, and publishes the result to pluggable sinks.
+//
+// The cobra command in cmd is a thin adapter over this package; other Go
+// tools can embed it directly:
+//
+//	runner := action.NewRunner()
+//	result, err := runner.Run(ctx, cfg)
+package action
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Default configuration values, shared with the command-line flags.
+const (
+	DefaultBaseURL          = "https://apis.iflow.cn/v1"
+	DefaultModel            = "Qwen3-Coder"
+	DefaultWorkingDir       = "."
+	DefaultTimeout          = 3600
+	DefaultRetryBackoff     = 5
+	DefaultKillGracePeriod  = 10
+	DefaultModelConcurrency = 1
+	DefaultMaxOutputSize    = 512 * 1024
+)
+
+// Config holds all configuration options for a single run. JSON names match
+// the action inputs, as in the run report.
+type Config struct {
+	Prompt                string   `json:"prompt"`
+	PromptFile            string   `json:"prompt_file"`   // Path to a file containing the prompt template
+	RenderPrompt          bool     `json:"render_prompt"` // Render an inline prompt as a Go template
+	APIKey                string   `json:"api_key"`
+	SettingsJSON          string   `json:"settings_json"`
+	SettingsFile          string   `json:"settings_file"`           // Path to a settings.json template used when SettingsJSON is empty
+	SettingsMerge         string   `json:"settings_merge"`          // How settings_json combines with individual inputs
+	PrintSettings         bool     `json:"print_settings"`          // Print the merged settings with secrets redacted
+	RestoreSettings       bool     `json:"restore_settings"`        // Restore the original ~/.iflow/settings.json on exit
+	MergeExistingSettings bool     `json:"merge_existing_settings"` // Merge with the existing ~/.iflow/settings.json instead of overwriting it
+	IsolatedHome          bool     `json:"isolated_home"`           // Use a temporary per-run home directory for iFlow
+	BaseURL               string   `json:"base_url"`
+	Model                 string   `json:"model"`
+	WorkingDir            string   `json:"working_directory"`
+	Timeout               int      `json:"timeout"`
+	IdleTimeout           int      `json:"idle_timeout"`            // Seconds without output after which iflow is stopped; 0 disables the watchdog
+	KillGracePeriod       int      `json:"kill_grace_period"`       // Seconds between SIGTERM and SIGKILL when stopping iflow and its descendants
+	Retries               int      `json:"retries"`                 // How many times to re-run iflow after a retryable failure
+	RetryBackoff          int      `json:"retry_backoff"`           // Base delay in seconds before the first retry, doubled for each further retry
+	RetryOn               []string `json:"retry_on"`                // Exit codes and output regexes that make a failure retryable; empty retries any failure
+	ExtraArgs             string   `json:"extra_args"`              // Additional command line arguments for iFlow CLI
+	PreCmd                string   `json:"precmd"`                  // Shell command(s) to execute before running iFlow CLI
+	MaskValues            []string `json:"mask_values"`             // Additional values to mask in logs, outputs and the summary
+	RedactPatterns        []string `json:"redact_patterns"`         // Additional regular expressions to redact
+	ConfigFile            string   `json:"config_file"`             // Path to a YAML or TOML file with shared defaults
+	Profile               string   `json:"profile"`                 // Name of a profile defined in the config file
+	Steps                 []Step   `json:"steps"`                   // Prompts run one after another instead of Prompt
+	Models                []string `json:"models"`                  // Models to run Prompt against, each with its own settings
+	ModelConcurrency      int      `json:"model_concurrency"`       // How many models of the matrix run at the same time
+	MaxOutputSize         int      `json:"max_output_size"`         // Bytes of output kept in memory per invocation; the rest is only in the output files
+	Transcript            bool     `json:"transcript"`              // Write a transcript of stdout and stderr lines with timestamps
+	UsePTY                bool     `json:"use_pty"`                 // Run iflow on a pseudo-terminal instead of pipes
+	StripANSI             bool     `json:"strip_ansi"`              // Remove terminal escape sequences from the result, output files and summary
+	MaxMemoryMB           int      `json:"max_memory_mb"`           // Memory limit for iflow and its descendants in MB; 0 is unlimited
+	MaxCPUSeconds         int      `json:"max_cpu_seconds"`         // CPU time limit for iflow in seconds; 0 is unlimited
+	MaxOpenFiles          int      `json:"max_open_files"`          // Open file descriptor limit for iflow; 0 is unlimited
+	ReportFile            string   `json:"report_file"`             // Path of the JSON run report to write; empty writes none
+	OutputSchema          string   `json:"output_schema"`           // JSON Schema, inline or a file path, that the JSON answer in the output must match
+	JSONRetries           int      `json:"json_retries"`            // How often iflow is prompted again when its JSON answer is missing or invalid
+	DetectChanges         bool     `json:"detect_changes"`          // Report the files changed in the working tree while iflow ran
+	Mode                  string   `json:"mode"`                    // ModeDirect to edit WorkingDir, or ModePatch to only produce a patch
+	CommitChanges         bool     `json:"commit_changes"`          // Commit the changes of a successful run to a new branch
+	BranchName            string   `json:"branch_name"`             // Template of the name of the new branch
+	CommitMessage         string   `json:"commit_message"`          // Template of the commit message
+	GenerateCommitMessage bool     `json:"generate_commit_message"` // Let iflow write the commit message from the patch
+	CommitAuthorName      string   `json:"commit_author_name"`
+	CommitAuthorEmail     string   `json:"commit_author_email"`
+	CommitSignoff         bool     `json:"commit_signoff"` // Add a Signed-off-by trailer for the author
+	PushChanges           bool     `json:"push_changes"`   // Push the new branch to origin
+
+	// ExplicitInputs records the inputs the user provided, even when the value
+	// equals the default. See SetExplicit.
+	ExplicitInputs map[string]bool `json:"-"`
+}
+
+// DefaultConfig returns a Config populated with the built-in defaults.
+func DefaultConfig() Config {
+	return Config{
+		BaseURL:           DefaultBaseURL,
+		Model:             DefaultModel,
+		WorkingDir:        DefaultWorkingDir,
+		Timeout:           DefaultTimeout,
+		RetryBackoff:      DefaultRetryBackoff,
+		KillGracePeriod:   DefaultKillGracePeriod,
+		ModelConcurrency:  DefaultModelConcurrency,
+		MaxOutputSize:     DefaultMaxOutputSize,
+		SettingsMerge:     SettingsMergeReplace,
+		RestoreSettings:   true,
+		StripANSI:         true,
+		DetectChanges:     true,
+		Mode:              ModeDirect,
+		BranchName:        DefaultBranchName,
+		CommitMessage:     DefaultCommitMessage,
+		CommitAuthorName:  DefaultCommitAuthorName,
+		CommitAuthorEmail: DefaultCommitAuthorEmail,
+	}
+}
+
+// Resolve loads the prompt and settings files and renders templates and
+// references in place, then validates the result. It must be called before
+// any settings are written.
+func (c *Config) Resolve() error {
+	// Load the prompt file and render the prompt template
+	if err := c.resolvePrompt(); err != nil {
+		return err
+	}
+
+	// Name the steps and load their prompt files
+	if err := c.resolveSteps(); err != nil {
+		return err
+	}
+
+	// Load the settings file and resolve ${ENV_VAR} and ${{ file:path }} references
+	if err := c.resolveSettingsJSON(); err != nil {
+		return err
+	}
+
+	// Load the output schema file and check the schema
+	if err := c.resolveOutputSchema(); err != nil {
+		return err
+	}
+
+	return c.Validate()
+}
+
+// errPromptRequired is reported when neither a prompt nor a prompt file is set.
+var errPromptRequired = errors.New("prompt or prompt_file input is required and cannot be empty")
+
+// Validate checks required values and ranges and returns the first problem.
+func (c *Config) Validate() error {
+	if problems := c.validate(); len(problems) > 0 {
+		return problems[0]
+	}
+	return nil
+}
+
+// validate returns every problem with required values and ranges.
+func (c *Config) validate() []error {
+	var problems []error
+
+	// Validate required inputs
+	if c.Prompt == "" && len(c.Steps) == 0 {
+		problems = append(problems, errPromptRequired)
+	}
+	problems = append(problems, c.validateSteps()...)
+	problems = append(problems, c.validateModels()...)
+	problems = append(problems, c.validateLimits()...)
+	problems = append(problems, c.validateOutputSchema()...)
+	problems = append(problems, c.validateMode()...)
+	problems = append(problems, c.validateCommit()...)
+
+	if c.APIKey == "" && c.SettingsJSON == "" {
+		problems = append(problems, fmt.Errorf("api_key input is required when settings_json is not provided"))
+	}
+
+	// Validate timeout range (1 second to 24 hours)
+	if c.Timeout < 1 || c.Timeout > 86400 {
+		problems = append(problems, fmt.Errorf("timeout value %d is out of range. Timeout must be between 1 and 86400 seconds (24 hours)", c.Timeout))
+	}
+
+	if c.IdleTimeout < 0 || c.IdleTimeout > 86400 {
+		problems = append(problems, fmt.Errorf("idle_timeout value %d is out of range. Idle timeout must be between 0 (disabled) and 86400 seconds", c.IdleTimeout))
+	}
+
+	if c.KillGracePeriod < 0 || c.KillGracePeriod > 300 {
+		problems = append(problems, fmt.Errorf("kill_grace_period value %d is out of range. Kill grace period must be between 0 and 300 seconds", c.KillGracePeriod))
+	}
+
+	if c.Retries < 0 || c.Retries > maxRetries {
+		problems = append(problems, fmt.Errorf("retries value %d is out of range. Retries must be between 0 and %d", c.Retries, maxRetries))
+	}
+
+	if c.RetryBackoff < 0 || c.RetryBackoff > 3600 {
+		problems = append(problems, fmt.Errorf("retry_backoff value %d is out of range. Retry backoff must be between 0 and 3600 seconds", c.RetryBackoff))
+	}
+
+	if c.ModelConcurrency < 1 || c.ModelConcurrency > maxModelConcurrency {
+		problems = append(problems, fmt.Errorf("model_concurrency value %d is out of range. Model concurrency must be between 1 and %d", c.ModelConcurrency, maxModelConcurrency))
+	}
+
+	if c.MaxOutputSize < minOutputSize || c.MaxOutputSize > maxOutputSize {
+		problems = append(problems, fmt.Errorf("max_output_size value %d is out of range. Max output size must be between %d and %d bytes", c.MaxOutputSize, minOutputSize, maxOutputSize))
+	}
+
+	if _, err := newRetryPolicy(c.RetryOn); err != nil {
+		problems = append(problems, err)
+	}
+
+	switch c.SettingsMerge {
+	case "", SettingsMergeReplace, SettingsMergeJSONOverInputs, SettingsMergeInputsOverJSON:
+	default:
+		problems = append(problems, fmt.Errorf("invalid settings_merge value %q (expected %s, %s or %s)",
+			c.SettingsMerge, SettingsMergeReplace, SettingsMergeJSONOverInputs, SettingsMergeInputsOverJSON))
+	}
+
+	return problems
+}
+
+// Check resolves a copy of cfg the way Run does and returns every problem it
+// finds, including unknown or mistyped settings_json keys, instead of stopping
+// at the first one. Nothing on the machine is changed.
+func Check(cfg Config) []error {
+	var problems []error
+
+	promptErr := cfg.resolvePrompt()
+	if promptErr != nil {
+		problems = append(problems, promptErr)
+	}
+
+	if err := cfg.resolveSteps(); err != nil {
+		problems = append(problems, err)
+	}
+
+	if err := cfg.resolveSettingsJSON(); err != nil {
+		problems = append(problems, err)
+	} else if cfg.SettingsJSON != "" {
+		problems = append(problems, CheckSettings(cfg.SettingsJSON)...)
+	}
+
+	if err := cfg.resolveOutputSchema(); err != nil {
+		problems = append(problems, err)
+	}
+
+	for _, err := range cfg.validate() {
+		// A prompt file that failed to load was already reported
+		if promptErr != nil && errors.Is(err, errPromptRequired) {
+			continue
+		}
+		problems = append(problems, err)
+	}
+
+	if _, err := NewRedactor(cfg.RedactPatterns); err != nil {
+		problems = append(problems, err)
+	}
+
+	return problems
+}
+
+// Redacted returns a copy of the config that is safe to publish: the API key
+// is hidden and free-form values are passed through the redactor.
+func (c Config) Redacted(r *Redactor) Config {
+	if c.APIKey != "" {
+		c.APIKey = "***"
+	}
+	c.Prompt = r.Redact(c.Prompt)
+	c.SettingsJSON = r.Redact(c.SettingsJSON)
+	c.ExtraArgs = r.Redact(c.ExtraArgs)
+	c.PreCmd = r.Redact(c.PreCmd)
+	if len(c.Steps) > 0 {
+		steps := make([]Step, len(c.Steps))
+		for i, step := range c.Steps {
+			step.Prompt = r.Redact(step.Prompt)
+			step.ExtraArgs = r.Redact(step.ExtraArgs)
+			steps[i] = step
+		}
+		c.Steps = steps
+	}
+	c.MaskValues = nil
+	return c
+}
@@ -0,0 +1,298 @@
+package action
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig mirrors the action inputs that can be shared through a repository
+// configuration file such as .iflow/action.yaml. Keys use the same snake_case
+// names as the action inputs; absent keys and empty strings or lists are
+// treated as unset, while an explicit false or 0 overrides the value below it.
+// Named profiles bundle settings that a step selects with the profile input.
+type FileConfig struct {
+	Prompt                string `yaml:"prompt" toml:"prompt"`
+	PromptFile            string `yaml:"prompt_file" toml:"prompt_file"`
+	RenderPrompt          *bool  `yaml:"render_prompt" toml:"render_prompt"`
+	APIKey                string `yaml:"api_key" toml:"api_key"`
+	SettingsJSON          string `yaml:"settings_json" toml:"settings_json"`
+	SettingsFile          string `yaml:"settings_file" toml:"settings_file"`
+	SettingsMerge         string `yaml:"settings_merge" toml:"settings_merge"`
+	PrintSettings         *bool  `yaml:"print_settings" toml:"print_settings"`
+	RestoreSettings       *bool  `yaml:"restore_settings" toml:"restore_settings"`
+	MergeExistingSettings *bool  `yaml:"merge_existing_settings" toml:"merge_existing_settings"`
+	IsolatedHome          *bool  `yaml:"isolated_home" toml:"isolated_home"`
+	BaseURL               string `yaml:"base_url" toml:"base_url"`
+	Model                 string `yaml:"model" toml:"model"`
+	WorkingDir            string `yaml:"working_directory" toml:"working_directory"`
+	Timeout               *int   `yaml:"timeout" toml:"timeout"`
+	IdleTimeout           *int   `yaml:"idle_timeout" toml:"idle_timeout"`
+	KillGracePeriod       *int   `yaml:"kill_grace_period" toml:"kill_grace_period"`
+	Retries               *int   `yaml:"retries" toml:"retries"`
+	RetryBackoff          *int   `yaml:"retry_backoff" toml:"retry_backoff"`
+	ExtraArgs             string `yaml:"extra_args" toml:"extra_args"`
+	PreCmd                string `yaml:"precmd" toml:"precmd"`
+	ModelConcurrency      *int   `yaml:"model_concurrency" toml:"model_concurrency"`
+	MaxOutputSize         *int   `yaml:"max_output_size" toml:"max_output_size"`
+	Transcript            *bool  `yaml:"transcript" toml:"transcript"`
+	UsePTY                *bool  `yaml:"use_pty" toml:"use_pty"`
+	StripANSI             *bool  `yaml:"strip_ansi" toml:"strip_ansi"`
+	MaxMemoryMB           *int   `yaml:"max_memory_mb" toml:"max_memory_mb"`
+	MaxCPUSeconds         *int   `yaml:"max_cpu_seconds" toml:"max_cpu_seconds"`
+	MaxOpenFiles          *int   `yaml:"max_open_files" toml:"max_open_files"`
+	ReportFile            string `yaml:"report_file" toml:"report_file"`
+	OutputSchema          string `yaml:"output_schema" toml:"output_schema"`
+	JSONRetries           *int   `yaml:"json_retries" toml:"json_retries"`
+	DetectChanges         *bool  `yaml:"detect_changes" toml:"detect_changes"`
+	Mode                  string `yaml:"mode" toml:"mode"`
+	CommitChanges         *bool  `yaml:"commit_changes" toml:"commit_changes"`
+	BranchName            string `yaml:"branch_name" toml:"branch_name"`
+	CommitMessage         string `yaml:"commit_message" toml:"commit_message"`
+	GenerateCommitMessage *bool  `yaml:"generate_commit_message" toml:"generate_commit_message"`
+	CommitAuthorName      string `yaml:"commit_author_name" toml:"commit_author_name"`
+	CommitAuthorEmail     string `yaml:"commit_author_email" toml:"commit_author_email"`
+	CommitSignoff         *bool  `yaml:"commit_signoff" toml:"commit_signoff"`
+	PushChanges           *bool  `yaml:"push_changes" toml:"push_changes"`
+
+	MaskValues     []string `yaml:"mask_values" toml:"mask_values"`
+	RedactPatterns []string `yaml:"redact_patterns" toml:"redact_patterns"`
+	RetryOn        []string `yaml:"retry_on" toml:"retry_on"`
+	Steps          []Step   `yaml:"steps" toml:"steps"`
+	Models         []string `yaml:"models" toml:"models"`
+
+	Profiles map[string]FileConfig `yaml:"profiles" toml:"profiles"`
+}
+
+// ParseConfigFile decodes a YAML or TOML configuration file. The format is
+// chosen by file extension; unknown keys are rejected so typos surface early.
+func ParseConfigFile(path string, data []byte) (*FileConfig, error) {
+	var fc FileConfig
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		md, err := toml.Decode(string(data), &fc)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse TOML config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+			return nil, fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(keys, ", "))
+		}
+	case ".yaml", ".yml", ".json":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse YAML config file %s: %w", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported config file extension %q (expected .yaml, .yml, .json or .toml)", filepath.Ext(path))
+	}
+
+	for name, profile := range fc.Profiles {
+		if len(profile.Profiles) > 0 {
+			return nil, fmt.Errorf("profile %q in config file %s cannot define nested profiles", name, path)
+		}
+	}
+
+	return &fc, nil
+}
+
+// ApplyTo copies every value set in the file onto cfg.
+func (fc *FileConfig) ApplyTo(cfg *Config) {
+	if fc.Prompt != "" {
+		cfg.Prompt = strings.TrimSpace(fc.Prompt)
+	}
+	if fc.PromptFile != "" {
+		cfg.PromptFile = fc.PromptFile
+	}
+	if fc.RenderPrompt != nil {
+		cfg.RenderPrompt = *fc.RenderPrompt
+	}
+	if fc.APIKey != "" {
+		cfg.APIKey = fc.APIKey
+		cfg.SetExplicit("api_key")
+	}
+	if fc.SettingsJSON != "" {
+		cfg.SettingsJSON = fc.SettingsJSON
+	}
+	if fc.SettingsFile != "" {
+		cfg.SettingsFile = fc.SettingsFile
+	}
+	if fc.SettingsMerge != "" {
+		cfg.SettingsMerge = fc.SettingsMerge
+	}
+	if fc.PrintSettings != nil {
+		cfg.PrintSettings = *fc.PrintSettings
+	}
+	if fc.RestoreSettings != nil {
+		cfg.RestoreSettings = *fc.RestoreSettings
+	}
+	if fc.MergeExistingSettings != nil {
+		cfg.MergeExistingSettings = *fc.MergeExistingSettings
+	}
+	if fc.IsolatedHome != nil {
+		cfg.IsolatedHome = *fc.IsolatedHome
+	}
+	if fc.BaseURL != "" {
+		cfg.BaseURL = fc.BaseURL
+		cfg.SetExplicit("base_url")
+	}
+	if fc.Model != "" {
+		cfg.Model = fc.Model
+		cfg.SetExplicit("model")
+	}
+	if fc.WorkingDir != "" {
+		cfg.WorkingDir = fc.WorkingDir
+	}
+	if fc.Timeout != nil {
+		cfg.Timeout = *fc.Timeout
+	}
+	if fc.IdleTimeout != nil {
+		cfg.IdleTimeout = *fc.IdleTimeout
+	}
+	if fc.KillGracePeriod != nil {
+		cfg.KillGracePeriod = *fc.KillGracePeriod
+	}
+	if fc.Retries != nil {
+		cfg.Retries = *fc.Retries
+	}
+	if fc.RetryBackoff != nil {
+		cfg.RetryBackoff = *fc.RetryBackoff
+	}
+	if fc.ExtraArgs != "" {
+		cfg.ExtraArgs = strings.TrimSpace(fc.ExtraArgs)
+	}
+	if fc.PreCmd != "" {
+		cfg.PreCmd = strings.TrimSpace(fc.PreCmd)
+	}
+	if len(fc.MaskValues) > 0 {
+		cfg.MaskValues = fc.MaskValues
+	}
+	if len(fc.RedactPatterns) > 0 {
+		cfg.RedactPatterns = fc.RedactPatterns
+	}
+	if len(fc.RetryOn) > 0 {
+		cfg.RetryOn = fc.RetryOn
+	}
+	if len(fc.Steps) > 0 {
+		cfg.Steps = fc.Steps
+	}
+	if len(fc.Models) > 0 {
+		cfg.Models = fc.Models
+	}
+	if fc.ModelConcurrency != nil {
+		cfg.ModelConcurrency = *fc.ModelConcurrency
+	}
+	if fc.MaxOutputSize != nil {
+		cfg.MaxOutputSize = *fc.MaxOutputSize
+	}
+	if fc.Transcript != nil {
+		cfg.Transcript = *fc.Transcript
+	}
+	if fc.UsePTY != nil {
+		cfg.UsePTY = *fc.UsePTY
+	}
+	if fc.StripANSI != nil {
+		cfg.StripANSI = *fc.StripANSI
+	}
+	if fc.MaxMemoryMB != nil {
+		cfg.MaxMemoryMB = *fc.MaxMemoryMB
+	}
+	if fc.MaxCPUSeconds != nil {
+		cfg.MaxCPUSeconds = *fc.MaxCPUSeconds
+	}
+	if fc.MaxOpenFiles != nil {
+		cfg.MaxOpenFiles = *fc.MaxOpenFiles
+	}
+	if fc.ReportFile != "" {
+		cfg.ReportFile = fc.ReportFile
+	}
+	if fc.OutputSchema != "" {
+		cfg.OutputSchema = fc.OutputSchema
+	}
+	if fc.JSONRetries != nil {
+		cfg.JSONRetries = *fc.JSONRetries
+	}
+	if fc.DetectChanges != nil {
+		cfg.DetectChanges = *fc.DetectChanges
+	}
+	if fc.Mode != "" {
+		cfg.Mode = fc.Mode
+	}
+	if fc.CommitChanges != nil {
+		cfg.CommitChanges = *fc.CommitChanges
+	}
+	if fc.BranchName != "" {
+		cfg.BranchName = fc.BranchName
+	}
+	if fc.CommitMessage != "" {
+		cfg.CommitMessage = fc.CommitMessage
+	}
+	if fc.GenerateCommitMessage != nil {
+		cfg.GenerateCommitMessage = *fc.GenerateCommitMessage
+	}
+	if fc.CommitAuthorName != "" {
+		cfg.CommitAuthorName = fc.CommitAuthorName
+	}
+	if fc.CommitAuthorEmail != "" {
+		cfg.CommitAuthorEmail = fc.CommitAuthorEmail
+	}
+	if fc.CommitSignoff != nil {
+		cfg.CommitSignoff = *fc.CommitSignoff
+	}
+	if fc.PushChanges != nil {
+		cfg.PushChanges = *fc.PushChanges
+	}
+}
+
+// LoadConfigFile reads cfg.ConfigFile and layers it, followed by the profile
+// named by cfg.Profile, on top of cfg. It does nothing when no file is set.
+func LoadConfigFile(cfg *Config) error {
+	if cfg.ConfigFile == "" {
+		if cfg.Profile != "" {
+			return fmt.Errorf("profile %q requires a config file", cfg.Profile)
+		}
+		return nil
+	}
+
+	data, err := os.ReadFile(cfg.ConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	fc, err := ParseConfigFile(cfg.ConfigFile, data)
+	if err != nil {
+		return err
+	}
+
+	fc.ApplyTo(cfg)
+
+	if cfg.Profile == "" {
+		return nil
+	}
+
+	profile, ok := fc.Profiles[cfg.Profile]
+	if !ok {
+		available := make([]string, 0, len(fc.Profiles))
+		for name := range fc.Profiles {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+		return fmt.Errorf("profile %q not found in %s (available: %s)", cfg.Profile, cfg.ConfigFile, strings.Join(available, ", "))
+	}
+
+	profile.ApplyTo(cfg)
+	return nil
+}
@@ -0,0 +1,178 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFile(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		content     string
+		expected    FileConfig
+		expectError bool
+	}{
+		{
+			name:     "YAML file",
+			path:     "action.yaml",
+			content:  "model: GLM-4.5\ntimeout: 600\nextra_args: --debug\n",
+			expected: FileConfig{Model: "GLM-4.5", Timeout: ptr(600), ExtraArgs: "--debug"},
+		},
+		{
+			name:     "TOML file",
+			path:     "action.toml",
+			content:  "base_url = \"https://example.com/v1\"\nprecmd = \"npm ci\"\n",
+			expected: FileConfig{BaseURL: "https://example.com/v1", PreCmd: "npm ci"},
+		},
+		{
+			name:     "Empty YAML file",
+			path:     "action.yml",
+			content:  "",
+			expected: FileConfig{},
+		},
+		{
+			name:    "YAML profiles",
+			path:    "action.yaml",
+			content: "model: Qwen3-Coder\nprofiles:\n  review:\n    model: GLM-4.5\n    timeout: 900\n",
+			expected: FileConfig{
+				Model:    "Qwen3-Coder",
+				Profiles: map[string]FileConfig{"review": {Model: "GLM-4.5", Timeout: ptr(900)}},
+			},
+		},
+		{
+			name:     "Explicit zero values",
+			path:     "action.toml",
+			content:  "isolated_home = false\nretries = 0\n",
+			expected: FileConfig{IsolatedHome: ptr(false), Retries: ptr(0)},
+		},
+		{
+			name:        "Nested profiles",
+			path:        "action.yaml",
+			content:     "profiles:\n  review:\n    profiles:\n      inner:\n        model: x\n",
+			expectError: true,
+		},
+		{
+			name:        "Unknown YAML key",
+			path:        "action.yaml",
+			content:     "modle: typo\n",
+			expectError: true,
+		},
+		{
+			name:        "Unknown TOML key",
+			path:        "action.toml",
+			content:     "modle = \"typo\"\n",
+			expectError: true,
+		},
+		{
+			name:        "Unsupported extension",
+			path:        "action.ini",
+			content:     "model=x",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fc, err := ParseConfigFile(tt.path, []byte(tt.content))
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(*fc, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, *fc)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "action.yaml")
+	content := "model: base-model\ntimeout: 600\nprofiles:\n  review:\n    model: review-model\n    extra_args: --debug\n  docs:\n    timeout: 300\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{BaseURL: DefaultBaseURL, Timeout: DefaultTimeout, ConfigFile: configPath, Profile: "review"}
+	if err := LoadConfigFile(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.Model != "review-model" {
+		t.Errorf("Expected profile to override config file, got model %q", cfg.Model)
+	}
+	if cfg.Timeout != 600 {
+		t.Errorf("Expected timeout from config file, got %d", cfg.Timeout)
+	}
+	if cfg.BaseURL != DefaultBaseURL {
+		t.Errorf("Expected unset values to keep their defaults, got base URL %q", cfg.BaseURL)
+	}
+
+	cfg = Config{ConfigFile: configPath, Profile: "missing"}
+	err := LoadConfigFile(&cfg)
+	if err == nil || !strings.Contains(err.Error(), "available: docs, review") {
+		t.Errorf("Expected unknown profile error listing profiles, got %v", err)
+	}
+
+	cfg = Config{Profile: "review"}
+	if err := LoadConfigFile(&cfg); err == nil {
+		t.Errorf("Expected error for profile without config file")
+	}
+}
+
+func TestLoadConfigFileProfileResetsValues(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "action.yaml")
+	content := `isolated_home: true
+transcript: true
+render_prompt: true
+retries: 2
+json_retries: 3
+max_memory_mb: 512
+model_concurrency: 4
+profiles:
+  plain:
+    isolated_home: false
+    transcript: false
+    render_prompt: false
+    retries: 0
+    json_retries: 0
+    max_memory_mb: 0
+    model_concurrency: 1
+  inherit:
+    model: other-model
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{ConfigFile: configPath, Profile: "plain"}
+	if err := LoadConfigFile(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.IsolatedHome || cfg.Transcript || cfg.RenderPrompt {
+		t.Errorf("Expected profile to reset booleans, got isolated_home=%v transcript=%v render_prompt=%v", cfg.IsolatedHome, cfg.Transcript, cfg.RenderPrompt)
+	}
+	if cfg.Retries != 0 || cfg.JSONRetries != 0 || cfg.MaxMemoryMB != 0 || cfg.ModelConcurrency != 1 {
+		t.Errorf("Expected profile to reset numbers, got retries=%d json_retries=%d max_memory_mb=%d model_concurrency=%d", cfg.Retries, cfg.JSONRetries, cfg.MaxMemoryMB, cfg.ModelConcurrency)
+	}
+
+	cfg = Config{ConfigFile: configPath, Profile: "inherit"}
+	if err := LoadConfigFile(&cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !cfg.IsolatedHome || !cfg.Transcript || !cfg.RenderPrompt || cfg.Retries != 2 || cfg.JSONRetries != 3 || cfg.MaxMemoryMB != 512 || cfg.ModelConcurrency != 4 {
+		t.Errorf("Expected keys missing from the profile to keep the config file values, got %+v", cfg)
+	}
+}
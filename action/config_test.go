@@ -0,0 +1,41 @@
+package action
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.PromptFile = filepath.Join(t.TempDir(), "missing.md")
+	cfg.SettingsJSON = `{"modelName":"Qwen3-Coder","colour":"blue"}`
+	cfg.SettingsMerge = "overwrite"
+	cfg.Timeout = 0
+	cfg.RedactPatterns = []string{"("}
+
+	problems := Check(cfg)
+
+	expected := []string{
+		"failed to read prompt file",
+		`unknown iFlow settings key "colour"`,
+		"timeout value 0 is out of range",
+		`invalid settings_merge value "overwrite"`,
+		"invalid redaction pattern",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(expected), len(problems), problems)
+	}
+	for i, problem := range problems {
+		if !strings.Contains(problem.Error(), expected[i]) {
+			t.Errorf("Expected problem containing %q, got %q", expected[i], problem)
+		}
+	}
+
+	cfg = DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-test"
+	if problems := Check(cfg); len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
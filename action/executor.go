@@ -0,0 +1,248 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// minWaitDelay bounds how long output from descendants that still hold the
+// child's stdout or stderr is drained after the child exits.
+const minWaitDelay = time.Second
+
+// cancelGracePeriod caps the grace period when the run is cancelled. The
+// runner sends SIGTERM 7.5 seconds after cancelling a job and SIGKILL soon
+// after, and the partial result still has to be published before that.
+const cancelGracePeriod = 3 * time.Second
+
+// cancelled reports whether ctx was cancelled from outside, e.g. because the
+// workflow was cancelled, rather than by a timeout or the idle watchdog.
+func cancelled(ctx context.Context) bool {
+	return errors.Is(ctx.Err(), context.Canceled) && !errors.Is(context.Cause(ctx), errIdleTimeout)
+}
+
+// Command describes a process started by the runner.
+type Command struct {
+	Name   string
+	Args   []string
+	Dir    string
+	Env    []string // Environment for the process; nil inherits the current one
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	// GracePeriod is how long the process and its descendants get to exit
+	// after SIGTERM before they are killed.
+	GracePeriod time.Duration
+
+	// KeepBackground leaves processes the command started in the background
+	// running after it exits, e.g. services started by a pre-command. They
+	// are still stopped with the command when ctx is done.
+	KeepBackground bool
+
+	// PTY runs the process on a pseudo-terminal instead of pipes. Its
+	// stdout and stderr are merged and written to Stdout; Stdin and Stderr
+	// are not used.
+	PTY bool
+
+	// Limits caps the resources of the process and its descendants.
+	Limits ResourceLimits
+
+	// Usage, when set, receives the resources the process used.
+	Usage *ResourceUsage
+}
+
+// Executor starts processes for the runner. Run blocks until the process
+// exits or ctx is done and returns its exit code. A non-nil error means the
+// process could not be run at all (e.g. command not found).
+type Executor interface {
+	Run(ctx context.Context, cmd Command) (int, error)
+}
+
+// ExecExecutor runs commands with os/exec. On Unix each command runs in its
+// own process group: when ctx is done the whole group receives SIGTERM and,
+// after the grace period, SIGKILL; a cancelled run gets at most
+// cancelGracePeriod. Processes left in the group after the command exits
+// are stopped the same way, within the same grace period, and reaped, unless
+// KeepBackground is set.
+// Commands on a pseudo-terminal (Linux only) lead their own session instead. Resource
+// limits are set with ulimit before the command starts; on Linux with
+// cgroup v2 a sub-group caps the memory of the whole process tree instead.
+type ExecExecutor struct{}
+
+// Run implements Executor.
+func (ExecExecutor) Run(ctx context.Context, command Command) (int, error) {
+	name, args := command.Name, command.Args
+	var group *cgroup
+	if command.Limits.Enabled() {
+		if command.Limits.MemoryMB > 0 {
+			// Fall back to the rlimit when no cgroup can be created
+			if g, err := newCgroup(command.Limits.MemoryMB); err == nil {
+				group = g
+				defer group.remove()
+			}
+		}
+		var err error
+		name, args, err = limitedCommand(name, args, command.Limits, group != nil)
+		if err != nil {
+			return 1, err
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = command.Dir
+	cmd.Env = command.Env
+	cmd.Stdin = command.Stdin
+	cmd.Stdout = command.Stdout
+	cmd.Stderr = command.Stderr
+	cmd.WaitDelay = max(command.GracePeriod, minWaitDelay)
+	processes := configureProcessGroup(ctx, cmd, command.GracePeriod)
+
+	var master, tty *os.File
+	if command.PTY {
+		var err error
+		master, tty, err = openPTY()
+		if err != nil {
+			return 1, fmt.Errorf("failed to open pseudo-terminal: %w", err)
+		}
+		defer master.Close()
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+		cmd.Env = terminalEnv(command.Env)
+		configureTerminal(cmd)
+	}
+
+	if err := cmd.Start(); err != nil {
+		if tty != nil {
+			tty.Close()
+		}
+		return 1, err
+	}
+	if group != nil {
+		if err := group.add(cmd.Process.Pid); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return 1, fmt.Errorf("failed to apply memory limit: %w", err)
+		}
+	}
+
+	// Copy the terminal output until every process has closed the terminal
+	var copied chan struct{}
+	if tty != nil {
+		tty.Close()
+		copied = make(chan struct{})
+		go func() {
+			io.Copy(command.Stdout, master)
+			close(copied)
+		}()
+	}
+
+	err := cmd.Wait()
+	if !command.KeepBackground || ctx.Err() != nil {
+		processes.stop()
+	}
+	if copied != nil {
+		drainTerminal(master, copied, cmd.WaitDelay)
+	}
+	if command.Usage != nil && cmd.ProcessState != nil {
+		*command.Usage = processUsage(cmd.ProcessState)
+		if group != nil {
+			command.Usage.PeakMemory = max(command.Usage.PeakMemory, group.peakMemory())
+		}
+	}
+
+	// Descendants kept the output open after the child exited
+	if errors.Is(err, exec.ErrWaitDelay) {
+		return cmd.ProcessState.ExitCode(), nil
+	}
+	if err == nil {
+		return 0, nil
+	}
+
+	var exitError *exec.ExitError
+	if errors.As(err, &exitError) {
+		return exitError.ExitCode(), nil
+	}
+	return 1, err
+}
+
+// drainTerminal waits up to delay for the rest of the terminal output, then
+// closes the master side to stop processes outside the group that still
+// hold the terminal from blocking the run.
+func drainTerminal(master *os.File, copied <-chan struct{}, delay time.Duration) {
+	select {
+	case <-copied:
+	case <-time.After(delay):
+		master.Close()
+		<-copied
+	}
+}
+
+// terminalEnv returns env, or the current environment when env is nil, with
+// TERM set for programs that check it before rendering for a terminal.
+func terminalEnv(env []string) []string {
+	if env == nil {
+		env = os.Environ()
+	}
+	for _, entry := range env {
+		if strings.HasPrefix(entry, "TERM=") {
+			return env
+		}
+	}
+	return append(env[:len(env):len(env)], "TERM=xterm-256color")
+}
+
+// parseExtraArgs parses a space-separated string of arguments into a slice
+// Handles quoted arguments with spaces properly
+func parseExtraArgs(extraArgs string) []string {
+	if extraArgs == "" {
+		return []string{}
+	}
+
+	var args []string
+	var current strings.Builder
+	inQuotes := false
+	var quoteChar rune
+
+	for i, char := range extraArgs {
+		switch char {
+		case '"', '\'':
+			if !inQuotes {
+				// Start of quoted string
+				inQuotes = true
+				quoteChar = char
+			} else if char == quoteChar {
+				// End of quoted string
+				inQuotes = false
+				quoteChar = 0
+			} else {
+				// Quote character inside different quotes
+				current.WriteRune(char)
+			}
+		case ' ', '\t', '\n':
+			if inQuotes {
+				// Space inside quotes, add to current argument
+				current.WriteRune(char)
+			} else {
+				// Space outside quotes, end current argument
+				if current.Len() > 0 {
+					args = append(args, current.String())
+					current.Reset()
+				}
+			}
+		default:
+			current.WriteRune(char)
+		}
+
+		// Handle end of string
+		if i == len(extraArgs)-1 && current.Len() > 0 {
+			args = append(args, current.String())
+		}
+	}
+
+	return args
+}
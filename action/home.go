@@ -0,0 +1,77 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// sharedHome is held by the run that uses the settings in the user's home
+// directory, so concurrent runs in one process take turns instead of reading
+// each other's settings and backups.
+var sharedHome = make(chan struct{}, 1)
+
+// lockSharedHome waits until no other run in this process uses the settings
+// in the user's home directory. The lock is released when the run finishes,
+// after the original settings are restored.
+func (r *run) lockSharedHome(ctx context.Context) error {
+	select {
+	case sharedHome <- struct{}{}:
+	default:
+		r.info("Waiting for another run using ~/.iflow to finish")
+		select {
+		case sharedHome <- struct{}{}:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	r.addCleanup(func() { <-sharedHome })
+	return nil
+}
+
+// setupIsolatedHome creates a private home directory for this run, so that
+// concurrent jobs on the same runner never share ~/.iflow. The directory is
+// removed when the run finishes.
+func (r *run) setupIsolatedHome() error {
+	home, err := r.tempHome()
+	if err != nil {
+		return fmt.Errorf("failed to create isolated home directory: %w", err)
+	}
+
+	r.homeDir = home
+	r.info(fmt.Sprintf("Using isolated iFlow home directory: %s", home))
+	return nil
+}
+
+// tempHome creates a temporary home directory that is removed when the run
+// finishes.
+func (r *run) tempHome() (string, error) {
+	home, err := os.MkdirTemp(tempParent(), "iflow-home-")
+	if err != nil {
+		return "", err
+	}
+
+	r.addCleanup(func() {
+		if err := os.RemoveAll(home); err != nil {
+			r.info(fmt.Sprintf("Warning: failed to remove temporary home directory: %v", err))
+		}
+	})
+	return home, nil
+}
+
+// iflowHomeDir returns the home directory iFlow reads its settings from.
+func (r *run) iflowHomeDir() (string, error) {
+	if r.homeDir != "" {
+		return r.homeDir, nil
+	}
+	return os.UserHomeDir()
+}
+
+// iflowEnv returns the environment for an iflow child process, pointing
+// HOME at home when it is set.
+func (r *run) iflowEnv(home string) []string {
+	if home == "" {
+		return nil
+	}
+	return append(os.Environ(), "HOME="+home)
+}
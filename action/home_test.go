@@ -0,0 +1,149 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestIsolatedHome(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+	r := newTestRun(Config{
+		APIKey:       "sk-test",
+		BaseURL:      "https://apis.iflow.cn/v1",
+		Model:        "Qwen3-Coder",
+		IsolatedHome: true,
+	})
+
+	if err := r.setupIsolatedHome(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	home := r.homeDir
+	if !strings.HasPrefix(home, os.Getenv("RUNNER_TEMP")) {
+		t.Errorf("Expected isolated home under RUNNER_TEMP, got %s", home)
+	}
+
+	if err := r.configureIFlow(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(home, ".iflow", "settings.json")); err != nil {
+		t.Errorf("Expected settings in isolated home: %v", err)
+	}
+
+	env := r.iflowEnv(r.homeDir)
+	if len(env) == 0 || env[len(env)-1] != "HOME="+home {
+		t.Errorf("Expected child environment to point HOME at isolated home")
+	}
+
+	r.cleanup()
+	if _, err := os.Stat(home); !os.IsNotExist(err) {
+		t.Errorf("Expected isolated home to be removed on cleanup")
+	}
+}
+
+func TestIsolatedHomeInContainer(t *testing.T) {
+	containerLayout(t)
+	r := newTestRun(Config{APIKey: "sk-test", IsolatedHome: true})
+
+	if err := r.setupIsolatedHome(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer r.cleanup()
+	if !strings.HasPrefix(r.homeDir, githubHome) {
+		t.Errorf("Expected isolated home under the mounted home, got %s", r.homeDir)
+	}
+	if err := r.configureIFlow(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// homeExecutor checks that each iflow prompt finds the API key of its own run
+// in ~/.iflow/settings.json of the shared home directory.
+type homeExecutor struct {
+	mu      sync.Mutex
+	running int
+	peak    int
+	wrong   []string
+}
+
+func (h *homeExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if cmd.Args[0] == "--version" {
+		return 0, nil
+	}
+	h.mu.Lock()
+	h.running++
+	h.peak = max(h.peak, h.running)
+	h.mu.Unlock()
+
+	// The prompt is the API key the run configured
+	prompt := cmd.Args[2]
+	time.Sleep(50 * time.Millisecond)
+	data, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".iflow", "settings.json"))
+	var settings map[string]interface{}
+	if err == nil {
+		err = json.Unmarshal(data, &settings)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running--
+	if err != nil || settings["apiKey"] != prompt {
+		h.wrong = append(h.wrong, fmt.Sprintf("%s saw %v (%v)", prompt, settings["apiKey"], err))
+	}
+	return 0, nil
+}
+
+func TestRunnerRunConcurrentSharedHome(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+	original := []byte(`{"apiKey":"sk-original"}`)
+	if err := os.MkdirAll(filepath.Join(home, ".iflow"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".iflow", "settings.json"), original, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	executor := &homeExecutor{}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg := DefaultConfig()
+			cfg.APIKey = fmt.Sprintf("sk-run-%d", i)
+			cfg.Prompt = cfg.APIKey
+			cfg.WorkingDir = t.TempDir()
+			cfg.DetectChanges = false
+			if _, err := runner.Run(context.Background(), cfg); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if executor.peak != 1 {
+		t.Errorf("Expected runs sharing ~/.iflow to take turns, %d ran at once", executor.peak)
+	}
+	if len(executor.wrong) > 0 {
+		t.Errorf("Expected each run to see its own settings: %v", executor.wrong)
+	}
+	if data, _ := os.ReadFile(filepath.Join(home, ".iflow", "settings.json")); string(data) != string(original) {
+		t.Errorf("Expected the original settings to be restored, got %s", data)
+	}
+}
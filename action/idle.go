@@ -0,0 +1,69 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+// errIdleTimeout is the cancellation cause of an attempt that produced no
+// output for the idle timeout.
+var errIdleTimeout = errors.New("no output within the idle timeout")
+
+// activityWriter records when output last arrived.
+type activityWriter struct {
+	last atomic.Int64 // Unix nanoseconds of the last write
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	a.touch()
+	return len(p), nil
+}
+
+func (a *activityWriter) touch() {
+	a.last.Store(time.Now().UnixNano())
+}
+
+// idleFor returns how long ago output last arrived.
+func (a *activityWriter) idleFor() time.Duration {
+	return time.Since(time.Unix(0, a.last.Load()))
+}
+
+// watchIdle returns a context that is cancelled with errIdleTimeout once
+// nothing has been written to the returned writer for idle, and a function
+// that stops the watchdog. With idle <= 0 there is no watchdog.
+func watchIdle(ctx context.Context, idle time.Duration) (context.Context, io.Writer, func()) {
+	if idle <= 0 {
+		return ctx, io.Discard, func() {}
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	activity := &activityWriter{}
+	activity.touch()
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(min(idle/4, time.Second))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if activity.idleFor() >= idle {
+					cancel(errIdleTimeout)
+					return
+				}
+			}
+		}
+	}()
+
+	return ctx, activity, func() {
+		close(done)
+		cancel(nil)
+	}
+}
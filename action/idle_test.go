@@ -0,0 +1,94 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatchIdle(t *testing.T) {
+	t.Run("Silence stops the attempt", func(t *testing.T) {
+		ctx, _, stop := watchIdle(context.Background(), 50*time.Millisecond)
+		defer stop()
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(2 * time.Second):
+			t.Fatal("Expected the watchdog to fire")
+		}
+		if !errors.Is(context.Cause(ctx), errIdleTimeout) {
+			t.Errorf("Expected cause %v, got %v", errIdleTimeout, context.Cause(ctx))
+		}
+	})
+
+	t.Run("Output keeps the attempt alive", func(t *testing.T) {
+		ctx, activity, stop := watchIdle(context.Background(), 100*time.Millisecond)
+		for range 10 {
+			fmt.Fprint(activity, ".")
+			time.Sleep(25 * time.Millisecond)
+		}
+		if ctx.Err() != nil {
+			t.Errorf("Expected the attempt to stay alive, got %v", context.Cause(ctx))
+		}
+		stop()
+		if errors.Is(context.Cause(ctx), errIdleTimeout) {
+			t.Errorf("Expected stop not to report an idle timeout")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		parent := context.Background()
+		ctx, _, stop := watchIdle(parent, 0)
+		defer stop()
+		if ctx != parent {
+			t.Errorf("Expected the parent context without a watchdog")
+		}
+	})
+}
+
+func TestRunnerRunIdleTimeout(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	executor := &blockingExecutor{started: make(chan struct{})}
+	sink := &recordingSink{}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Sinks:    []Sink{sink},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-test"
+	cfg.IsolatedHome = true
+	cfg.IdleTimeout = 1
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !result.IdleTimedOut || result.TimedOut || result.Cancelled {
+		t.Errorf("Expected an idle timeout, got %+v", result)
+	}
+	if result.ExitCode != ExitCodeIdleTimeout {
+		t.Errorf("Expected exit code %d, got %d", ExitCodeIdleTimeout, result.ExitCode)
+	}
+	if result.Outcome() != OutcomeIdleTimeout {
+		t.Errorf("Expected outcome %s, got %s", OutcomeIdleTimeout, result.Outcome())
+	}
+	if result.Output != "partial output" {
+		t.Errorf("Expected partial output, got %q", result.Output)
+	}
+
+	summary := GenerateSummaryMarkdown(sink.cfg, sink.result)
+	if !strings.Contains(summary, "Summary - Idle Timeout") || !strings.Contains(summary, "Idle Timeout Information") {
+		t.Errorf("Expected an idle timeout summary, got:\n%s", summary)
+	}
+}
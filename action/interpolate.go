@@ -0,0 +1,109 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// referencePattern matches ${{ file:path }}, ${NAME} and the escaped form $${NAME}.
+var referencePattern = regexp.MustCompile(`\$\$\{[A-Za-z_][A-Za-z0-9_]*\}|\$\{\{\s*file:\s*([^}]+?)\s*\}\}|\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// resolveSettingsJSON loads settings_file when settings_json is empty and
+// resolves environment and file references in every string value.
+func (c *Config) resolveSettingsJSON() error {
+	if c.SettingsJSON == "" && c.SettingsFile != "" {
+		data, err := os.ReadFile(c.SettingsFile)
+		if err != nil {
+			return fmt.Errorf("failed to read settings file: %w", err)
+		}
+		c.SettingsJSON = string(data)
+	}
+	if c.SettingsJSON == "" {
+		return nil
+	}
+
+	var settings interface{}
+	if err := json.Unmarshal([]byte(c.SettingsJSON), &settings); err != nil {
+		return fmt.Errorf("invalid settings_json provided: %w", err)
+	}
+
+	resolved, err := InterpolateSettings(settings)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return fmt.Errorf("failed to format settings JSON: %w", err)
+	}
+	c.SettingsJSON = string(data)
+	return nil
+}
+
+// InterpolateSettings replaces ${ENV_VAR} and ${{ file:path }} references in
+// all string values of a decoded JSON document. Use $${NAME} for a literal
+// ${NAME}. Every unresolved reference is reported in a single error.
+func InterpolateSettings(value interface{}) (interface{}, error) {
+	missing := map[string]bool{}
+	result := interpolateValue(value, missing)
+	if len(missing) > 0 {
+		names := make([]string, 0, len(missing))
+		for name := range missing {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("unresolved references in settings: %s", strings.Join(names, ", "))
+	}
+	return result, nil
+}
+
+func interpolateValue(value interface{}, missing map[string]bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			result[k] = interpolateValue(item, missing)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = interpolateValue(item, missing)
+		}
+		return result
+	case string:
+		return interpolateString(v, missing)
+	default:
+		return v
+	}
+}
+
+func interpolateString(s string, missing map[string]bool) string {
+	return referencePattern.ReplaceAllStringFunc(s, func(ref string) string {
+		if strings.HasPrefix(ref, "$$") {
+			return ref[1:]
+		}
+
+		groups := referencePattern.FindStringSubmatch(ref)
+		if path := groups[1]; path != "" {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				missing["file:"+path] = true
+				return ref
+			}
+			return strings.TrimRight(string(data), "\r\n")
+		}
+
+		name := groups[2]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing[name] = true
+			return ref
+		}
+		return value
+	})
+}
@@ -0,0 +1,64 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInterpolateSettings(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("IFLOW_TEST_API_KEY", "sk-env")
+
+	settings := map[string]interface{}{
+		"apiKey": "${IFLOW_TEST_API_KEY}",
+		"mcpServers": map[string]interface{}{
+			"github": map[string]interface{}{
+				"args": []interface{}{"--token", "${{ file:" + tokenFile + " }}"},
+				"env":  map[string]interface{}{"LITERAL": "$${HOME}"},
+			},
+		},
+		"timeout": float64(30),
+	}
+
+	resolved, err := InterpolateSettings(settings)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{
+		"apiKey": "sk-env",
+		"mcpServers": map[string]interface{}{
+			"github": map[string]interface{}{
+				"args": []interface{}{"--token", "file-token"},
+				"env":  map[string]interface{}{"LITERAL": "${HOME}"},
+			},
+		},
+		"timeout": float64(30),
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("Expected %v, got %v", expected, resolved)
+	}
+}
+
+func TestInterpolateSettingsMissing(t *testing.T) {
+	settings := map[string]interface{}{
+		"apiKey":       "${IFLOW_TEST_MISSING_B}",
+		"searchApiKey": "${IFLOW_TEST_MISSING_A}",
+		"cert":         "${{ file:/nonexistent/cert.pem }}",
+	}
+
+	_, err := InterpolateSettings(settings)
+	if err == nil {
+		t.Fatal("Expected error but got none")
+	}
+	expected := "IFLOW_TEST_MISSING_A, IFLOW_TEST_MISSING_B, file:/nonexistent/cert.pem"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected error to list %q, got %v", expected, err)
+	}
+}
@@ -0,0 +1,243 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ExitCodeInvalidJSON is reported when iflow succeeded but its output holds
+// no JSON matching output_schema, like EX_DATAERR of sysexits.h.
+const ExitCodeInvalidJSON = 65
+
+// maxJSONRetries caps how often iflow is prompted again for valid JSON.
+const maxJSONRetries = 5
+
+// errNoJSON is reported when the output contains no JSON object at all.
+var errNoJSON = errors.New("no JSON object found in the output")
+
+// fencedBlock matches Markdown code blocks that are unlabelled or labelled
+// as JSON.
+var fencedBlock = regexp.MustCompile("(?s)```(?:json|JSON)?[ \t]*\r?\n(.*?)```")
+
+// resolveOutputSchema loads output_schema from a file unless it is an
+// inline schema, and checks it.
+func (c *Config) resolveOutputSchema() error {
+	text := strings.TrimSpace(c.OutputSchema)
+	if text == "" {
+		return nil
+	}
+	if !strings.HasPrefix(text, "{") {
+		data, err := os.ReadFile(text)
+		if err != nil {
+			return fmt.Errorf("failed to read output schema file: %w", err)
+		}
+		text = strings.TrimSpace(string(data))
+	}
+	if _, err := parseJSONSchema(text); err != nil {
+		return err
+	}
+	c.OutputSchema = text
+	return nil
+}
+
+// validateOutputSchema returns every problem with how output_schema and
+// json_retries are combined with other inputs.
+func (c *Config) validateOutputSchema() []error {
+	var problems []error
+	if c.JSONRetries < 0 || c.JSONRetries > maxJSONRetries {
+		problems = append(problems, fmt.Errorf("json_retries value %d is out of range. JSON retries must be between 0 and %d", c.JSONRetries, maxJSONRetries))
+	}
+	if c.OutputSchema == "" {
+		if c.JSONRetries > 0 {
+			problems = append(problems, fmt.Errorf("json_retries requires output_schema"))
+		}
+		return problems
+	}
+	if len(c.Models) > 0 {
+		problems = append(problems, fmt.Errorf("output_schema cannot be combined with models"))
+	}
+	if len(c.Steps) > 0 && c.JSONRetries > 0 {
+		problems = append(problems, fmt.Errorf("json_retries cannot be combined with steps; the last step's output is checked once"))
+	}
+	return problems
+}
+
+// extractJSON returns the last JSON value in output, compacted: the last
+// unlabelled or JSON code block that parses, otherwise the last top-level
+// JSON object in the text.
+func extractJSON(output string) (interface{}, string, error) {
+	blocks := fencedBlock.FindAllStringSubmatch(output, -1)
+	for i := len(blocks) - 1; i >= 0; i-- {
+		if value, compact, ok := decodeJSON(strings.TrimSpace(blocks[i][1])); ok {
+			return value, compact, nil
+		}
+	}
+
+	if value, compact, ok := lastJSONObject(output); ok {
+		return value, compact, nil
+	}
+	return nil, "", errNoJSON
+}
+
+// jsonBytes holds every byte that can appear in JSON outside a string.
+const jsonBytes = " \t\r\n{}[]:,-+.0123456789eEtrufalsn"
+
+// lastJSONObject returns the last top-level JSON object in text. A single
+// pass finds the balanced {...} spans, ignoring braces in strings and giving
+// up on a span at the first byte that cannot be JSON, and only those spans
+// are decoded, so the cost stays linear in the size of the text.
+func lastJSONObject(text string) (interface{}, string, bool) {
+	var value interface{}
+	var compact string
+	start, depth := 0, 0
+	inString, escaped := false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case depth == 0:
+			if c == '{' {
+				start, depth = i, 1
+			}
+		case inString:
+			switch {
+			case escaped:
+				escaped = false
+			case c == '\\':
+				escaped = true
+			case c == '"':
+				inString = false
+			case c < 0x20:
+				// Strings cannot span lines
+				depth, inString = 0, false
+			}
+		case c == '"':
+			inString = true
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				if v, s, ok := decodeJSON(text[start : i+1]); ok {
+					value, compact = v, s
+				}
+			}
+		case strings.IndexByte(jsonBytes, c) < 0:
+			depth = 0
+		}
+	}
+	return value, compact, compact != ""
+}
+
+// decodeJSON decodes text that holds exactly one JSON value.
+func decodeJSON(text string) (interface{}, string, bool) {
+	var value interface{}
+	if err := json.Unmarshal([]byte(text), &value); err != nil {
+		return nil, "", false
+	}
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, []byte(text)); err != nil {
+		return nil, "", false
+	}
+	return value, compact.String(), true
+}
+
+// checkJSON extracts the JSON answer from the output of a successful run and
+// validates it against the output schema. It reports whether the answer is
+// valid; the problems are recorded in the result.
+func (r *run) checkJSON(schema interface{}, result *Result) bool {
+	result.JSON = ""
+	result.JSONErrors = nil
+
+	value, compact, err := extractJSON(result.Output)
+	if err != nil {
+		result.JSONErrors = []string{err.Error()}
+	} else if problems := validateJSON(schema, value, "$"); len(problems) > 0 {
+		result.JSONErrors = problems
+	} else {
+		result.JSON = compact
+		r.info("Extracted JSON output matching output_schema")
+		return true
+	}
+
+	r.info(fmt.Sprintf("iFlow CLI output does not match output_schema: %s", strings.Join(result.JSONErrors, "; ")))
+	return false
+}
+
+// executeJSONPrompt runs the prompt and checks its JSON answer, asking up to
+// json_retries times for the answer to be rewritten without the problems
+// found. Every round shares the timeout; the attempts of all rounds are
+// recorded.
+func (r *run) executeJSONPrompt(ctx context.Context, schema interface{}, result *Result) error {
+	inv := r.promptInvocation()
+	deadline := time.Now().Add(time.Duration(inv.timeout) * time.Second)
+
+	for round := 0; ; round++ {
+		var execution Execution
+		if err := r.executeIFlow(ctx, inv, &execution); err != nil {
+			return err
+		}
+		result.Execution.absorb(&execution)
+
+		if result.ExitCode != 0 || result.Cancelled {
+			return nil
+		}
+		if r.checkJSON(schema, result) {
+			return nil
+		}
+
+		remaining := int(time.Until(deadline).Seconds())
+		if round >= r.cfg.JSONRetries || remaining < 1 {
+			result.InvalidJSON = true
+			result.ExitCode = ExitCodeInvalidJSON
+			return nil
+		}
+		r.info(fmt.Sprintf("Prompting iFlow CLI again for valid JSON (%d of %d)", round+1, r.cfg.JSONRetries))
+		inv.prompt = repairPrompt(result.Output, result.JSONErrors, r.cfg.OutputSchema)
+		inv.timeout = remaining
+	}
+}
+
+// absorb records a further run of the prompt: its outcome replaces the
+// previous one, while the start time, attempts and usage accumulate.
+func (e *Execution) absorb(next *Execution) {
+	start, attempts, usage := e.StartTime, e.Attempts, e.Usage
+	*e = *next
+	if !start.IsZero() {
+		e.StartTime = start
+	}
+	for _, attempt := range next.Attempts {
+		attempt.Number = len(attempts) + 1
+		attempts = append(attempts, attempt)
+	}
+	e.Attempts = attempts
+	usage.add(next.Usage)
+	e.Usage = usage
+}
+
+// maxRepairAnswer caps how much of the previous answer a repair prompt quotes,
+// as the prompt is passed on the command line.
+const maxRepairAnswer = 32 * 1024
+
+// repairPrompt asks iflow to rewrite its previous answer as JSON that avoids
+// the problems found. The answer is quoted instead of the original prompt so
+// that iflow does not carry out the task again.
+func repairPrompt(answer string, problems []string, schema string) string {
+	var b strings.Builder
+	b.WriteString("Your previous answer, quoted below, did not end with JSON matching the required schema:\n")
+	for _, problem := range problems {
+		b.WriteString("- " + problem + "\n")
+	}
+	b.WriteString("\nDo not repeat the task, run any tools or change any files. Only rewrite the answer, ending it with a single JSON value in a ```json code block that matches this JSON Schema:\n\n```json\n")
+	b.WriteString(schema)
+	b.WriteString("\n```\n\nPrevious answer:\n\n")
+	b.WriteString(truncateMiddle(strings.TrimSpace(answer), maxRepairAnswer))
+	b.WriteString("\n")
+	return b.String()
+}
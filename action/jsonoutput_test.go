@@ -0,0 +1,260 @@
+package action
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected string
+	}{
+		{
+			name:     "fenced block",
+			output:   "Here it is:\n\n```json\n{\n  \"label\": \"bug\"\n}\n```\n",
+			expected: `{"label":"bug"}`,
+		},
+		{
+			name:     "last fenced block wins",
+			output:   "```json\n{\"a\":1}\n```\nThen:\n```\n{\"a\":2}\n```",
+			expected: `{"a":2}`,
+		},
+		{
+			name:     "fenced block before inline object",
+			output:   "```json\n[1, 2]\n```\nas in {\"a\":1}",
+			expected: `[1,2]`,
+		},
+		{
+			name:     "invalid fenced block",
+			output:   "```json\n{oops}\n```\nAnswer: {\"a\": 1}",
+			expected: `{"a":1}`,
+		},
+		{
+			name:     "last inline object",
+			output:   `First {"a": {"b": 1}} then {"c": [2]} done.`,
+			expected: `{"c":[2]}`,
+		},
+		{
+			name:     "nested object is not top-level",
+			output:   `Result: {"a": {"b": 1}} {broken`,
+			expected: `{"a":{"b":1}}`,
+		},
+		{
+			name:     "braces in strings",
+			output:   `Answer: {"a": "}{"} done`,
+			expected: `{"a":"}{"}`,
+		},
+		{
+			name:     "many unclosed objects",
+			output:   strings.Repeat(`{"a":`, 20000) + "\nAnswer: {\"ok\": true}",
+			expected: `{"ok":true}`,
+		},
+		{
+			name:   "none",
+			output: "No JSON {here}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, compact, err := extractJSON(tt.output)
+			if tt.expected == "" {
+				if err != errNoJSON {
+					t.Errorf("Expected errNoJSON, got %q, %v", compact, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if compact != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, compact)
+			}
+		})
+	}
+}
+
+func TestRepairPrompt(t *testing.T) {
+	answer := strings.Repeat("reasoning ", maxRepairAnswer) + `{"label": "docs"}`
+	prompt := repairPrompt(answer, []string{"$.label: must be one of"}, `{"type":"object"}`)
+
+	if len(prompt) > maxRepairAnswer+1024 {
+		t.Errorf("Expected the quoted answer to be limited, got a %d byte prompt", len(prompt))
+	}
+	for _, want := range []string{"- $.label: must be one of", `{"type":"object"}`, "Do not repeat the task", `{"label": "docs"}`} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("Expected prompt to contain %q", want)
+		}
+	}
+}
+
+func TestResolveOutputSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte("{\"type\": \"object\"}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := Config{OutputSchema: path}
+	if err := cfg.resolveOutputSchema(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.OutputSchema != `{"type": "object"}` {
+		t.Errorf("Expected the schema file to be loaded, got %q", cfg.OutputSchema)
+	}
+
+	cfg = Config{OutputSchema: filepath.Join(t.TempDir(), "missing.json")}
+	if err := cfg.resolveOutputSchema(); err == nil || !strings.Contains(err.Error(), "failed to read output schema file") {
+		t.Errorf("Expected a read error, got %v", err)
+	}
+
+	cfg = Config{OutputSchema: `{"type": "dict"}`}
+	if err := cfg.resolveOutputSchema(); err == nil || !strings.Contains(err.Error(), "invalid output_schema") {
+		t.Errorf("Expected a schema error, got %v", err)
+	}
+}
+
+func TestValidateOutputSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected []string
+	}{
+		{name: "unused", cfg: Config{}},
+		{name: "retries", cfg: Config{OutputSchema: "{}", JSONRetries: 2}},
+		{name: "retries out of range", cfg: Config{OutputSchema: "{}", JSONRetries: 6}, expected: []string{"json_retries value 6 is out of range"}},
+		{name: "retries without schema", cfg: Config{JSONRetries: 1}, expected: []string{"json_retries requires output_schema"}},
+		{name: "models", cfg: Config{OutputSchema: "{}", Models: []string{"a", "b"}}, expected: []string{"cannot be combined with models"}},
+		{name: "steps", cfg: Config{OutputSchema: "{}", Steps: []Step{{Name: "a"}}}},
+		{name: "steps with retries", cfg: Config{OutputSchema: "{}", Steps: []Step{{Name: "a"}}, JSONRetries: 1}, expected: []string{"json_retries cannot be combined with steps"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.cfg.validateOutputSchema()
+			if len(problems) != len(tt.expected) {
+				t.Fatalf("Expected %d problems, got %v", len(tt.expected), problems)
+			}
+			for i, problem := range problems {
+				if !strings.Contains(problem.Error(), tt.expected[i]) {
+					t.Errorf("Expected problem containing %q, got %q", tt.expected[i], problem)
+				}
+			}
+		})
+	}
+}
+
+func TestRunnerRunOutputSchema(t *testing.T) {
+	const schema = `{"type":"object","required":["label"],"properties":{"label":{"enum":["bug","feature"]}}}`
+
+	tests := []struct {
+		name        string
+		outputs     []string
+		retries     int
+		exitCode    int
+		json        string
+		prompts     int
+		errorPrefix string
+	}{
+		{
+			name:    "valid",
+			outputs: []string{"Done.\n```json\n{\"label\": \"bug\"}\n```\n"},
+			json:    `{"label":"bug"}`,
+			prompts: 1,
+		},
+		{
+			name:    "re-prompted",
+			outputs: []string{"It is a bug.", `{"label": "docs"}`, `{"label": "feature"}`},
+			retries: 2,
+			json:    `{"label":"feature"}`,
+			prompts: 3,
+		},
+		{
+			name:        "still invalid",
+			outputs:     []string{"It is a bug.", `{"label": "docs"}`},
+			retries:     1,
+			exitCode:    ExitCodeInvalidJSON,
+			prompts:     2,
+			errorPrefix: "$.label: must be one of",
+		},
+		{
+			name:        "no retries",
+			outputs:     []string{"It is a bug."},
+			exitCode:    ExitCodeInvalidJSON,
+			prompts:     1,
+			errorPrefix: errNoJSON.Error(),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+
+			executor := &fakeExecutor{outputs: tt.outputs}
+			runner := &Runner{
+				Executor: executor,
+				Logger:   ConsoleLogger{Out: io.Discard},
+				Stdout:   io.Discard,
+				Stderr:   io.Discard,
+			}
+
+			cfg := DefaultConfig()
+			cfg.Prompt = "Triage the issue"
+			cfg.APIKey = "sk-test"
+			cfg.OutputSchema = schema
+			cfg.JSONRetries = tt.retries
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.ExitCode != tt.exitCode {
+				t.Errorf("Expected exit code %d, got %d", tt.exitCode, result.ExitCode)
+			}
+			if result.JSON != tt.json {
+				t.Errorf("Expected JSON %q, got %q", tt.json, result.JSON)
+			}
+			if len(result.Attempts) != tt.prompts {
+				t.Errorf("Expected %d attempts, got %d", tt.prompts, len(result.Attempts))
+			}
+			if tt.errorPrefix == "" {
+				if result.InvalidJSON || len(result.JSONErrors) != 0 {
+					t.Errorf("Expected valid JSON, got errors %v", result.JSONErrors)
+				}
+			} else {
+				if !result.InvalidJSON || result.Outcome() != OutcomeInvalidJSON {
+					t.Errorf("Expected the invalid_json outcome, got %s", result.Outcome())
+				}
+				if len(result.JSONErrors) == 0 || !strings.HasPrefix(result.JSONErrors[0], tt.errorPrefix) {
+					t.Errorf("Expected errors starting with %q, got %v", tt.errorPrefix, result.JSONErrors)
+				}
+			}
+
+			// Every further prompt quotes the previous answer with its problems
+			// instead of repeating the task
+			var prompts []string
+			for _, cmd := range executor.commands {
+				if cmd.Name == "iflow" && len(cmd.Args) > 2 && cmd.Args[1] == "--prompt" {
+					prompts = append(prompts, cmd.Args[2])
+				}
+			}
+			if len(prompts) != tt.prompts {
+				t.Fatalf("Expected %d prompts, got %d", tt.prompts, len(prompts))
+			}
+			if prompts[0] != "Triage the issue" {
+				t.Errorf("Expected the first prompt unchanged, got %q", prompts[0])
+			}
+			for i, prompt := range prompts[1:] {
+				if strings.Contains(prompt, "Triage the issue") || !strings.Contains(prompt, schema) || !strings.Contains(prompt, tt.outputs[i]) {
+					t.Errorf("Expected a repair prompt with the schema and the previous answer, got %q", prompt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// jsonSchemaTypes are the values of the JSON Schema type keyword.
+var jsonSchemaTypes = map[string]bool{
+	"object": true, "array": true, "string": true, "number": true,
+	"integer": true, "boolean": true, "null": true,
+}
+
+// parseJSONSchema decodes a JSON Schema and checks the keywords validateJSON
+// understands. Annotations such as title and description are ignored;
+// references are not supported.
+func parseJSONSchema(text string) (interface{}, error) {
+	var schema interface{}
+	if err := json.Unmarshal([]byte(text), &schema); err != nil {
+		return nil, fmt.Errorf("invalid output_schema: %w", err)
+	}
+	if err := checkJSONSchema(schema, "#"); err != nil {
+		return nil, fmt.Errorf("invalid output_schema: %w", err)
+	}
+	return schema, nil
+}
+
+// checkJSONSchema reports the first malformed or unsupported keyword in the
+// schema at path.
+func checkJSONSchema(schema interface{}, path string) error {
+	if _, ok := schema.(bool); ok {
+		return nil
+	}
+	object, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("%s: a schema must be an object or a boolean", path)
+	}
+	if _, ok := object["$ref"]; ok {
+		return fmt.Errorf("%s: $ref is not supported, inline the referenced schema", path)
+	}
+
+	switch types := object["type"].(type) {
+	case nil:
+	case string:
+		if !jsonSchemaTypes[types] {
+			return fmt.Errorf("%s/type: unknown type %q", path, types)
+		}
+	case []interface{}:
+		for _, t := range types {
+			if name, ok := t.(string); !ok || !jsonSchemaTypes[name] {
+				return fmt.Errorf("%s/type: unknown type %v", path, t)
+			}
+		}
+	default:
+		return fmt.Errorf("%s/type: must be a string or an array of strings", path)
+	}
+
+	if required, ok := object["required"]; ok {
+		names, ok := required.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s/required: must be an array of property names", path)
+		}
+		for _, name := range names {
+			if _, ok := name.(string); !ok {
+				return fmt.Errorf("%s/required: must be an array of property names", path)
+			}
+		}
+	}
+	if enum, ok := object["enum"]; ok {
+		if _, ok := enum.([]interface{}); !ok {
+			return fmt.Errorf("%s/enum: must be an array", path)
+		}
+	}
+	if pattern, ok := object["pattern"]; ok {
+		text, ok := pattern.(string)
+		if !ok {
+			return fmt.Errorf("%s/pattern: must be a string", path)
+		}
+		if _, err := regexp.Compile(text); err != nil {
+			return fmt.Errorf("%s/pattern: %w", path, err)
+		}
+	}
+	for _, keyword := range []string{"minimum", "maximum", "exclusiveMinimum", "exclusiveMaximum", "minLength", "maxLength", "minItems", "maxItems"} {
+		if value, ok := object[keyword]; ok {
+			if _, ok := value.(float64); !ok {
+				return fmt.Errorf("%s/%s: must be a number", path, keyword)
+			}
+		}
+	}
+
+	if properties, ok := object["properties"]; ok {
+		byName, ok := properties.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s/properties: must be an object", path)
+		}
+		for name, property := range byName {
+			if err := checkJSONSchema(property, path+"/properties/"+name); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"items", "additionalProperties", "not"} {
+		if sub, ok := object[keyword]; ok {
+			if err := checkJSONSchema(sub, path+"/"+keyword); err != nil {
+				return err
+			}
+		}
+	}
+	for _, keyword := range []string{"allOf", "anyOf", "oneOf"} {
+		if subs, ok := object[keyword]; ok {
+			list, ok := subs.([]interface{})
+			if !ok || len(list) == 0 {
+				return fmt.Errorf("%s/%s: must be a non-empty array of schemas", path, keyword)
+			}
+			for i, sub := range list {
+				if err := checkJSONSchema(sub, fmt.Sprintf("%s/%s/%d", path, keyword, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateJSON returns every way value, at path, violates schema. The
+// schema must have passed checkJSONSchema.
+func validateJSON(schema interface{}, value interface{}, path string) []string {
+	if allowed, ok := schema.(bool); ok {
+		if !allowed {
+			return []string{fmt.Sprintf("%s: no value is allowed here", path)}
+		}
+		return nil
+	}
+	object := schema.(map[string]interface{})
+
+	if types := schemaTypes(object["type"]); len(types) > 0 && !matchesSchemaType(value, types) {
+		return []string{fmt.Sprintf("%s: expected %s, got %s", path, strings.Join(types, " or "), schemaType(value))}
+	}
+
+	var problems []string
+	if enum, ok := object["enum"].([]interface{}); ok && !containsJSON(enum, value) {
+		problems = append(problems, fmt.Sprintf("%s: must be one of %s", path, formatJSON(enum)))
+	}
+	if constant, ok := object["const"]; ok && !reflect.DeepEqual(constant, value) {
+		problems = append(problems, fmt.Sprintf("%s: must be %s", path, formatJSON(constant)))
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := float64(len([]rune(v)))
+		if limit, ok := object["minLength"].(float64); ok && length < limit {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %g characters long", path, limit))
+		}
+		if limit, ok := object["maxLength"].(float64); ok && length > limit {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %g characters long", path, limit))
+		}
+		if pattern, ok := object["pattern"].(string); ok && !regexp.MustCompile(pattern).MatchString(v) {
+			problems = append(problems, fmt.Sprintf("%s: must match the pattern %q", path, pattern))
+		}
+	case float64:
+		if limit, ok := object["minimum"].(float64); ok && v < limit {
+			problems = append(problems, fmt.Sprintf("%s: must be at least %g", path, limit))
+		}
+		if limit, ok := object["maximum"].(float64); ok && v > limit {
+			problems = append(problems, fmt.Sprintf("%s: must be at most %g", path, limit))
+		}
+		if limit, ok := object["exclusiveMinimum"].(float64); ok && v <= limit {
+			problems = append(problems, fmt.Sprintf("%s: must be greater than %g", path, limit))
+		}
+		if limit, ok := object["exclusiveMaximum"].(float64); ok && v >= limit {
+			problems = append(problems, fmt.Sprintf("%s: must be less than %g", path, limit))
+		}
+	case []interface{}:
+		if limit, ok := object["minItems"].(float64); ok && float64(len(v)) < limit {
+			problems = append(problems, fmt.Sprintf("%s: must have at least %g items", path, limit))
+		}
+		if limit, ok := object["maxItems"].(float64); ok && float64(len(v)) > limit {
+			problems = append(problems, fmt.Sprintf("%s: must have at most %g items", path, limit))
+		}
+		if items, ok := object["items"]; ok {
+			for i, item := range v {
+				problems = append(problems, validateJSON(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]interface{}:
+		if required, ok := object["required"].([]interface{}); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: missing required property %q", path, name))
+				}
+			}
+		}
+		properties, _ := object["properties"].(map[string]interface{})
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if property, ok := properties[name]; ok {
+				problems = append(problems, validateJSON(property, v[name], path+"."+name)...)
+			} else if additional, ok := object["additionalProperties"]; ok {
+				if allowed, ok := additional.(bool); ok && !allowed {
+					problems = append(problems, fmt.Sprintf("%s: unexpected property %q", path, name))
+				} else {
+					problems = append(problems, validateJSON(additional, v[name], path+"."+name)...)
+				}
+			}
+		}
+	}
+
+	if subs, ok := object["allOf"].([]interface{}); ok {
+		for _, sub := range subs {
+			problems = append(problems, validateJSON(sub, value, path)...)
+		}
+	}
+	if subs, ok := object["anyOf"].([]interface{}); ok && countMatching(subs, value, path) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: must match at least one schema of anyOf", path))
+	}
+	if subs, ok := object["oneOf"].([]interface{}); ok {
+		if n := countMatching(subs, value, path); n != 1 {
+			problems = append(problems, fmt.Sprintf("%s: must match exactly one schema of oneOf, matched %d", path, n))
+		}
+	}
+	if not, ok := object["not"]; ok && len(validateJSON(not, value, path)) == 0 {
+		problems = append(problems, fmt.Sprintf("%s: must not match the schema of not", path))
+	}
+	return problems
+}
+
+// schemaTypes returns the types allowed by a type keyword.
+func schemaTypes(keyword interface{}) []string {
+	switch t := keyword.(type) {
+	case string:
+		return []string{t}
+	case []interface{}:
+		types := make([]string, 0, len(t))
+		for _, name := range t {
+			types = append(types, name.(string))
+		}
+		return types
+	}
+	return nil
+}
+
+// matchesSchemaType reports whether value is of one of types; integers are
+// numbers too.
+func matchesSchemaType(value interface{}, types []string) bool {
+	actual := schemaType(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaType returns the JSON Schema type of a decoded value; whole numbers
+// are integers.
+func schemaType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func countMatching(schemas []interface{}, value interface{}, path string) int {
+	n := 0
+	for _, schema := range schemas {
+		if len(validateJSON(schema, value, path)) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+func containsJSON(values []interface{}, value interface{}) bool {
+	for _, v := range values {
+		if reflect.DeepEqual(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatJSON(value interface{}) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
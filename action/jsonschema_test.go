@@ -0,0 +1,99 @@
+package action
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestParseJSONSchema(t *testing.T) {
+	tests := []struct {
+		name     string
+		schema   string
+		expected string
+	}{
+		{name: "valid", schema: `{"type":"object","properties":{"a":{"type":["string","null"]}},"required":["a"]}`},
+		{name: "boolean", schema: `true`},
+		{name: "not JSON", schema: `{"type":`, expected: "invalid output_schema"},
+		{name: "not an object", schema: `"object"`, expected: "#: a schema must be an object or a boolean"},
+		{name: "unknown type", schema: `{"type":"map"}`, expected: `#/type: unknown type "map"`},
+		{name: "reference", schema: `{"properties":{"a":{"$ref":"#/$defs/a"}}}`, expected: "#/properties/a: $ref is not supported"},
+		{name: "required", schema: `{"required":"a"}`, expected: "#/required: must be an array"},
+		{name: "pattern", schema: `{"items":{"pattern":"("}}`, expected: "#/items/pattern"},
+		{name: "minimum", schema: `{"minimum":"1"}`, expected: "#/minimum: must be a number"},
+		{name: "empty anyOf", schema: `{"anyOf":[]}`, expected: "#/anyOf: must be a non-empty array"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseJSONSchema(tt.schema)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expected) {
+				t.Errorf("Expected error containing %q, got %v", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidateJSON(t *testing.T) {
+	const schema = `{
+		"type": "object",
+		"required": ["label", "priority"],
+		"properties": {
+			"label": {"enum": ["bug", "feature"]},
+			"priority": {"type": "integer", "minimum": 1, "maximum": 3},
+			"summary": {"type": "string", "minLength": 3, "pattern": "^[A-Z]"},
+			"files": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+			"score": {"anyOf": [{"type": "null"}, {"type": "number", "exclusiveMaximum": 1}]}
+		},
+		"additionalProperties": false
+	}`
+
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{name: "valid", value: `{"label":"bug","priority":2,"summary":"Crash","files":["a.go"],"score":0.5}`},
+		{name: "null score", value: `{"label":"bug","priority":2,"score":null}`},
+		{name: "wrong type", value: `[1]`, expected: []string{"$: expected object, got array"}},
+		{name: "missing", value: `{"label":"bug"}`, expected: []string{`$: missing required property "priority"`}},
+		{
+			name:  "constraints",
+			value: `{"label":"docs","priority":2.5,"summary":"ok","files":["a",1,"c"],"extra":true,"score":2}`,
+			expected: []string{
+				`$: unexpected property "extra"`,
+				"$.files: must have at most 2 items",
+				"$.files[1]: expected string, got integer",
+				`$.label: must be one of ["bug","feature"]`,
+				"$.priority: expected integer, got number",
+				"$.score: must match at least one schema of anyOf",
+				"$.summary: must be at least 3 characters long",
+				`$.summary: must match the pattern "^[A-Z]"`,
+			},
+		},
+		{name: "range", value: `{"label":"bug","priority":4}`, expected: []string{"$.priority: must be at most 3"}},
+	}
+
+	parsed, err := parseJSONSchema(schema)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatalf("Invalid test value: %v", err)
+			}
+			problems := validateJSON(parsed, value, "$")
+			if strings.Join(problems, "\n") != strings.Join(tt.expected, "\n") {
+				t.Errorf("Expected problems %q, got %q", tt.expected, problems)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package action
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Upper bounds of the resource limit inputs.
+const (
+	maxMemoryMB   = 1024 * 1024
+	maxCPUSeconds = 7 * 86400
+	maxOpenFiles  = 1024 * 1024
+)
+
+// ResourceLimits caps the resources of a process and its descendants. Zero
+// leaves a resource unlimited.
+type ResourceLimits struct {
+	MemoryMB   int // Memory, enforced by a cgroup v2 sub-group where possible and the data segment rlimit otherwise
+	CPUSeconds int // CPU time; the process is killed when it uses more
+	OpenFiles  int // Open file descriptors per process
+}
+
+// Enabled reports whether any limit is set.
+func (l ResourceLimits) Enabled() bool {
+	return l.MemoryMB > 0 || l.CPUSeconds > 0 || l.OpenFiles > 0
+}
+
+// String describes the limits for logs and the step summary.
+func (l ResourceLimits) String() string {
+	var parts []string
+	if l.MemoryMB > 0 {
+		parts = append(parts, fmt.Sprintf("%d MB memory", l.MemoryMB))
+	}
+	if l.CPUSeconds > 0 {
+		parts = append(parts, fmt.Sprintf("%d seconds CPU", l.CPUSeconds))
+	}
+	if l.OpenFiles > 0 {
+		parts = append(parts, fmt.Sprintf("%d open files", l.OpenFiles))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// ResourceUsage reports what a process and the descendants it waited for
+// used.
+type ResourceUsage struct {
+	PeakMemory int64 // Peak resident set size in bytes
+	UserCPU    time.Duration
+	SystemCPU  time.Duration
+}
+
+// PeakMemoryMB returns the peak memory in MB.
+func (u ResourceUsage) PeakMemoryMB() float64 {
+	return float64(u.PeakMemory) / (1024 * 1024)
+}
+
+// add accumulates the usage of another invocation: CPU times are summed and
+// the peak memory is the larger of the two.
+func (u *ResourceUsage) add(other ResourceUsage) {
+	u.PeakMemory = max(u.PeakMemory, other.PeakMemory)
+	u.UserCPU += other.UserCPU
+	u.SystemCPU += other.SystemCPU
+}
+
+// resourceLimits returns the limits configured for iflow.
+func (c *Config) resourceLimits() ResourceLimits {
+	return ResourceLimits{MemoryMB: c.MaxMemoryMB, CPUSeconds: c.MaxCPUSeconds, OpenFiles: c.MaxOpenFiles}
+}
+
+// validateLimits returns every problem with the configured resource limits.
+func (c *Config) validateLimits() []error {
+	var problems []error
+	if c.MaxMemoryMB < 0 || c.MaxMemoryMB > maxMemoryMB {
+		problems = append(problems, fmt.Errorf("max_memory_mb value %d is out of range. Max memory must be between 0 and %d MB", c.MaxMemoryMB, maxMemoryMB))
+	}
+	if c.MaxCPUSeconds < 0 || c.MaxCPUSeconds > maxCPUSeconds {
+		problems = append(problems, fmt.Errorf("max_cpu_seconds value %d is out of range. Max CPU time must be between 0 and %d seconds", c.MaxCPUSeconds, maxCPUSeconds))
+	}
+	if c.MaxOpenFiles < 0 || c.MaxOpenFiles > maxOpenFiles {
+		problems = append(problems, fmt.Errorf("max_open_files value %d is out of range. Max open files must be between 0 and %d", c.MaxOpenFiles, maxOpenFiles))
+	}
+	return problems
+}
+
+// limitedCommand returns the command line that runs name with the rlimits
+// applied: a shell sets them with ulimit and then execs the command, so they
+// are in place before it starts. The memory limit is left out when a cgroup
+// enforces it.
+func limitedCommand(name string, args []string, limits ResourceLimits, cgroupMemory bool) (string, []string, error) {
+	if runtime.GOOS == "windows" {
+		return "", nil, fmt.Errorf("resource limits are not supported on %s", runtime.GOOS)
+	}
+
+	var ulimits []string
+	if limits.MemoryMB > 0 && !cgroupMemory {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -d %d", limits.MemoryMB*1024))
+	}
+	if limits.CPUSeconds > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -t %d", limits.CPUSeconds))
+	}
+	if limits.OpenFiles > 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -n %d", limits.OpenFiles))
+	}
+	if len(ulimits) == 0 {
+		return name, args, nil
+	}
+
+	// Resolve the command like os/exec would, so a missing command is still
+	// reported as an error rather than the shell's exit code 127
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return "", nil, err
+	}
+
+	script := strings.Join(ulimits, " && ") + ` && exec "$0" "$@"`
+	return "sh", append([]string{"-c", script, path}, args...), nil
+}
@@ -0,0 +1,88 @@
+package action
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateLimits(t *testing.T) {
+	tests := []struct {
+		name     string
+		limits   ResourceLimits
+		problems []string
+	}{
+		{
+			name:   "Unlimited",
+			limits: ResourceLimits{},
+		},
+		{
+			name:   "Within range",
+			limits: ResourceLimits{MemoryMB: 4096, CPUSeconds: 1800, OpenFiles: 4096},
+		},
+		{
+			name:     "Out of range",
+			limits:   ResourceLimits{MemoryMB: -1, CPUSeconds: maxCPUSeconds + 1, OpenFiles: -1},
+			problems: []string{"max_memory_mb", "max_cpu_seconds", "max_open_files"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.MaxMemoryMB = tt.limits.MemoryMB
+			cfg.MaxCPUSeconds = tt.limits.CPUSeconds
+			cfg.MaxOpenFiles = tt.limits.OpenFiles
+
+			problems := cfg.validateLimits()
+			if len(problems) != len(tt.problems) {
+				t.Fatalf("Expected %d problems, got %v", len(tt.problems), problems)
+			}
+			for i, want := range tt.problems {
+				if !strings.Contains(problems[i].Error(), want) {
+					t.Errorf("Expected problem containing %q, got %q", want, problems[i])
+				}
+			}
+		})
+	}
+}
+
+func TestLimitedCommand(t *testing.T) {
+	tests := []struct {
+		name         string
+		limits       ResourceLimits
+		cgroupMemory bool
+		script       string
+	}{
+		{
+			name:   "All rlimits",
+			limits: ResourceLimits{MemoryMB: 2, CPUSeconds: 60, OpenFiles: 256},
+			script: `ulimit -d 2048 && ulimit -t 60 && ulimit -n 256 && exec "$0" "$@"`,
+		},
+		{
+			name:         "Memory left to the cgroup",
+			limits:       ResourceLimits{MemoryMB: 2, OpenFiles: 256},
+			cgroupMemory: true,
+			script:       `ulimit -n 256 && exec "$0" "$@"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name, args, err := limitedCommand("sh", []string{"-c", "true"}, tt.limits, tt.cgroupMemory)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if name != "sh" || len(args) != 5 || args[0] != "-c" || args[1] != tt.script {
+				t.Fatalf("Unexpected command %s %q", name, args)
+			}
+			if !strings.HasSuffix(args[2], "/sh") || args[3] != "-c" || args[4] != "true" {
+				t.Errorf("Expected the resolved command and its arguments, got %q", args[2:])
+			}
+		})
+	}
+
+	name, args, err := limitedCommand("iflow", []string{"--yolo"}, ResourceLimits{MemoryMB: 2}, true)
+	if err != nil || name != "iflow" || len(args) != 1 {
+		t.Errorf("Expected the command unchanged when the cgroup enforces every limit, got %s %q, %v", name, args, err)
+	}
+}
@@ -0,0 +1,30 @@
+package action
+
+import (
+	"fmt"
+	"io"
+)
+
+// ConsoleLogger writes progress messages to Out. In GitHub Actions mode
+// messages are emitted as notices and secrets are registered with the runner
+// through ::add-mask:: so they are hidden in the job log.
+type ConsoleLogger struct {
+	Out    io.Writer
+	GitHub bool // Use GitHub Actions workflow commands
+}
+
+// Info implements Logger.
+func (l ConsoleLogger) Info(message string) {
+	if l.GitHub {
+		fmt.Fprintf(l.Out, "::notice::%s\n", message)
+	} else {
+		fmt.Fprintf(l.Out, "INFO: %s\n", message)
+	}
+}
+
+// Mask implements Logger.
+func (l ConsoleLogger) Mask(value string) {
+	if l.GitHub {
+		fmt.Fprintf(l.Out, "::add-mask::%s\n", value)
+	}
+}
@@ -0,0 +1,140 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// minMaskLength avoids masking trivially short values, which would mangle
+// unrelated output.
+const minMaskLength = 4
+
+// defaultRedactPatterns match common credential formats even when the value
+// itself was never passed to the action.
+var defaultRedactPatterns = []string{
+	`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`,
+	`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`,
+	`\bgh[pousr]_[A-Za-z0-9]{36,}\b`,
+	`\bgithub_pat_[A-Za-z0-9_]{22,}\b`,
+	`\bsk-[A-Za-z0-9_\-]{20,}\b`,
+}
+
+// Redactor scrubs secret values and credential patterns from text.
+type Redactor struct {
+	values   []string
+	patterns []*regexp.Regexp
+}
+
+// NewRedactor compiles the default patterns together with any extra ones.
+func NewRedactor(extraPatterns []string) (*Redactor, error) {
+	r := &Redactor{}
+	for _, pattern := range append(append([]string{}, defaultRedactPatterns...), extraPatterns...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+		}
+		r.patterns = append(r.patterns, re)
+	}
+	return r, nil
+}
+
+// AddValue registers a literal secret. Multi-line values are also registered
+// line by line, matching how the runner masks them.
+func (r *Redactor) AddValue(value string) {
+	candidates := append([]string{value}, strings.Split(value, "\n")...)
+	for _, candidate := range candidates {
+		candidate = strings.TrimSpace(candidate)
+		if len(candidate) < minMaskLength {
+			continue
+		}
+		exists := false
+		for _, v := range r.values {
+			if v == candidate {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			r.values = append(r.values, candidate)
+		}
+	}
+	// Replace longer values first so overlapping secrets are fully removed
+	sort.Slice(r.values, func(i, j int) bool { return len(r.values[i]) > len(r.values[j]) })
+}
+
+// Values returns the registered literal secrets.
+func (r *Redactor) Values() []string {
+	return r.values
+}
+
+// Redact replaces every registered value and pattern match with ***.
+func (r *Redactor) Redact(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, value := range r.values {
+		text = strings.ReplaceAll(text, value, "***")
+	}
+	for _, re := range r.patterns {
+		text = re.ReplaceAllString(text, "***")
+	}
+	return text
+}
+
+// NewConfigRedactor builds a redactor for cfg from the API key, secret-looking
+// values in settings_json, mask_values and redact_patterns.
+func NewConfigRedactor(cfg *Config) (*Redactor, error) {
+	r, err := NewRedactor(cfg.RedactPatterns)
+	if err != nil {
+		return nil, err
+	}
+
+	r.AddValue(cfg.APIKey)
+	for _, value := range cfg.MaskValues {
+		r.AddValue(value)
+	}
+	if cfg.SettingsJSON != "" {
+		var settings interface{}
+		if err := json.Unmarshal([]byte(cfg.SettingsJSON), &settings); err == nil {
+			for _, value := range collectSecretValues("", settings) {
+				r.AddValue(value)
+			}
+		}
+	}
+
+	return r, nil
+}
+
+// collectSecretValues returns string values stored under secret-looking keys.
+func collectSecretValues(key string, value interface{}) []string {
+	var values []string
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, item := range v {
+			values = append(values, collectSecretValues(k, item)...)
+		}
+	case []interface{}:
+		for _, item := range v {
+			values = append(values, collectSecretValues(key, item)...)
+		}
+	case string:
+		if secretKeyPattern.MatchString(key) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// SplitLines splits a multi-line input into trimmed, non-empty entries.
+func SplitLines(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, "\n") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
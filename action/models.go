@@ -0,0 +1,300 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxModelConcurrency caps how many models of a matrix run at the same time.
+const maxModelConcurrency = 10
+
+// ModelResult describes the outcome of the prompt on one model of a model
+// matrix run.
+type ModelResult struct {
+	Execution
+	Model string
+}
+
+// validateModels returns every problem with the configured model matrix.
+func (c *Config) validateModels() []error {
+	if len(c.Models) == 0 {
+		return nil
+	}
+
+	var problems []error
+	if len(c.Steps) > 0 {
+		problems = append(problems, fmt.Errorf("models cannot be combined with steps"))
+	}
+
+	seen := make(map[string]bool, len(c.Models))
+	for _, model := range c.Models {
+		if strings.TrimSpace(model) == "" {
+			problems = append(problems, fmt.Errorf("models cannot contain an empty model name"))
+			continue
+		}
+		if seen[model] {
+			problems = append(problems, fmt.Errorf("model %q is listed more than once", model))
+		}
+		seen[model] = true
+	}
+
+	// Models share the working directory, so only let them run side by side
+	// where their edits are thrown away
+	if c.ModelConcurrency > 1 && c.Mode != ModePatch {
+		problems = append(problems, fmt.Errorf("model_concurrency %d requires mode %s, as models running at the same time would edit the same working directory", c.ModelConcurrency, ModePatch))
+	}
+	return problems
+}
+
+// setupModelHomes gives every model of the matrix its own temporary home
+// directory with a settings.json that selects the model, so concurrent
+// invocations never share settings. The user's own settings are only read.
+func (r *run) setupModelHomes() ([]string, error) {
+	r.info(settingsSource(&r.cfg))
+	settings, err := buildSettings(&r.cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Layer the new settings on top of the ones already on the machine
+	if r.cfg.MergeExistingSettings {
+		homeDir, err := r.iflowHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get home directory: %w", err)
+		}
+		existing, err := readExistingSettings(filepath.Join(homeDir, ".iflow", "settings.json"))
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			r.info("Merging with existing iFlow settings")
+			settings = deepMerge(existing, settings)
+		}
+	}
+
+	homes := make([]string, len(r.cfg.Models))
+	for i, model := range r.cfg.Models {
+		home, err := r.tempHome()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create home directory for model %s: %w", model, err)
+		}
+
+		iflowDir := filepath.Join(home, ".iflow")
+		if err := os.MkdirAll(iflowDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create .iflow directory: %w", err)
+		}
+
+		modelSettings := deepMerge(settings, map[string]interface{}{"modelName": model})
+		if err := r.writeSettings(filepath.Join(iflowDir, "settings.json"), modelSettings); err != nil {
+			return nil, err
+		}
+		homes[i] = home
+	}
+	return homes, nil
+}
+
+// executeModels runs the prompt against every model, starting them in order
+// and running at most model_concurrency at a time. The overall exit code is
+// that of the first model that failed.
+func (r *run) executeModels(ctx context.Context, homes []string, result *Result) error {
+	result.StartTime = time.Now()
+	defer func() { result.EndTime = time.Now() }()
+
+	result.Models = make([]ModelResult, len(r.cfg.Models))
+	errs := make([]error, len(r.cfg.Models))
+	workers := min(max(r.cfg.ModelConcurrency, 1), len(r.cfg.Models))
+
+	// Prefix live and logged output with the model when several run at once
+	var outputMu, logMu sync.Mutex
+	invocations := make([]invocation, len(r.cfg.Models))
+	for i, model := range r.cfg.Models {
+		result.Models[i].Model = model
+		inv := r.promptInvocation()
+		inv.env = r.iflowEnv(homes[i])
+		inv.name = model
+		if workers > 1 {
+			prefix := fmt.Sprintf("[%s] ", model)
+			inv.stdout = &prefixWriter{mu: &outputMu, w: r.runner.Stdout, prefix: prefix}
+			inv.stderr = &prefixWriter{mu: &outputMu, w: r.runner.Stderr, prefix: prefix}
+			if inv.log != nil {
+				inv.log = &prefixWriter{mu: &logMu, w: inv.log, prefix: prefix}
+			}
+		}
+		invocations[i] = inv
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				inv := invocations[i]
+				r.info(fmt.Sprintf("Running prompt on model %s", r.cfg.Models[i]))
+				errs[i] = r.executeIFlow(ctx, inv, &result.Models[i].Execution)
+				flushPrefixed(inv.stdout, inv.stderr, inv.log)
+			}
+		}()
+	}
+	for i := range r.cfg.Models {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range result.Models {
+		if errs[i] != nil {
+			return fmt.Errorf("model %s: %w", result.Models[i].Model, errs[i])
+		}
+	}
+
+	// Combine the outputs of every model, bounded like a single invocation's
+	resultPath, err := r.newOutputPath("result-*.log")
+	if err != nil {
+		return err
+	}
+	combined, err := newOutputCapture(r.cfg.MaxOutputSize, resultPath, nil, r.cleanLine)
+	if err != nil {
+		return err
+	}
+	for i := range result.Models {
+		model := &result.Models[i]
+		if i > 0 {
+			io.WriteString(combined, "\n\n")
+		}
+		fmt.Fprintf(combined, "=== %s (%s, exit code %d) ===\n", model.Model, model.Outcome(), model.ExitCode)
+		if err := copyOutput(combined, &model.Execution); err != nil {
+			combined.Close()
+			return err
+		}
+
+		result.Usage.add(model.Usage)
+		if model.Cancelled {
+			result.Cancelled = true
+		} else if result.ExitCode == 0 && model.ExitCode != 0 {
+			result.ExitCode = model.ExitCode
+			result.TimedOut = model.TimedOut
+			result.IdleTimedOut = model.IdleTimedOut
+		}
+	}
+	if err := combined.Close(); err != nil {
+		r.info(fmt.Sprintf("Warning: failed to write output file: %v", err))
+	}
+	result.Output = combined.String()
+	result.OutputFile = combined.Path()
+	result.OutputSize = combined.Size()
+	result.Truncated = combined.Truncated()
+
+	if result.Cancelled {
+		result.ExitCode = ExitCodeCancelled
+		result.TimedOut = false
+		result.IdleTimedOut = false
+	}
+	return nil
+}
+
+// copyOutput writes the complete output of e to w, from its output file when
+// there is one.
+func copyOutput(w io.Writer, e *Execution) error {
+	if e.OutputFile == "" {
+		_, err := io.WriteString(w, e.Output)
+		return err
+	}
+
+	file, err := os.Open(e.OutputFile)
+	if err != nil {
+		return fmt.Errorf("failed to read output file: %w", err)
+	}
+	defer file.Close()
+	_, err = io.Copy(w, file)
+	return err
+}
+
+// prefixWriter prefixes every line written to w, so the live output of
+// concurrent invocations can be told apart. Writers sharing mu never
+// interleave within a line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1]); err != nil {
+			return len(b), err
+		}
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// flush writes a trailing line that has no newline.
+func (p *prefixWriter) flush() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+		p.buf = nil
+	}
+}
+
+// flushPrefixed writes the unterminated last lines held by writers that
+// split their input into lines.
+func flushPrefixed(writers ...io.Writer) {
+	for _, w := range writers {
+		switch w := w.(type) {
+		case *prefixWriter:
+			w.flush()
+		case *transcriptStream:
+			w.flush()
+		}
+	}
+}
+
+// ModelsJSON renders the model results as the JSON array published in the
+// models output.
+func ModelsJSON(models []ModelResult) (string, error) {
+	type modelOutput struct {
+		Model           string  `json:"model"`
+		Outcome         string  `json:"outcome"`
+		ExitCode        int     `json:"exit_code"`
+		DurationSeconds float64 `json:"duration_seconds"`
+		Output          string  `json:"output"`
+		Stderr          string  `json:"stderr"`
+	}
+
+	// Outputs share the size limit of the output
+	return fitJSON(MaxPublishedSize/max(2*len(models), 1), func(limit int) interface{} {
+		outputs := make([]modelOutput, 0, len(models))
+		for _, model := range models {
+			outputs = append(outputs, modelOutput{
+				Model:           model.Model,
+				Outcome:         model.Outcome(),
+				ExitCode:        model.ExitCode,
+				DurationSeconds: model.Duration().Round(time.Millisecond).Seconds(),
+				Output:          truncateMiddle(model.Output, limit),
+				Stderr:          truncateMiddle(model.Stderr, limit),
+			})
+		}
+		return outputs
+	})
+}
@@ -0,0 +1,251 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// modelExecutor answers each iflow prompt with the modelName from the
+// settings.json in the invocation's HOME and fails models named "broken".
+type modelExecutor struct {
+	mu      sync.Mutex
+	homes   []string
+	running int
+	peak    int
+	delay   time.Duration
+}
+
+func (m *modelExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if len(cmd.Args) > 0 && cmd.Args[0] == "--version" {
+		return 0, nil
+	}
+
+	var home string
+	for _, env := range cmd.Env {
+		if strings.HasPrefix(env, "HOME=") {
+			home = strings.TrimPrefix(env, "HOME=")
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(home, ".iflow", "settings.json"))
+	if err != nil {
+		return 0, err
+	}
+	var settings map[string]interface{}
+	if err := json.Unmarshal(data, &settings); err != nil {
+		return 0, err
+	}
+
+	m.mu.Lock()
+	m.homes = append(m.homes, home)
+	m.running++
+	m.peak = max(m.peak, m.running)
+	m.mu.Unlock()
+
+	time.Sleep(m.delay)
+
+	m.mu.Lock()
+	m.running--
+	m.mu.Unlock()
+
+	model := settings["modelName"].(string)
+	fmt.Fprintf(cmd.Stdout, "answer from %s\n", model)
+	if model == "broken" {
+		return 3, nil
+	}
+	return 0, nil
+}
+
+func TestValidateModels(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Models = []string{"GLM-4.5", " ", "GLM-4.5"}
+	cfg.Steps = []Step{{Name: "analyze", Prompt: "Analyze"}}
+	cfg.ModelConcurrency = 2
+
+	problems := cfg.validateModels()
+	expected := []string{
+		"cannot be combined with steps",
+		"empty model name",
+		`"GLM-4.5" is listed more than once`,
+		"model_concurrency 2 requires mode patch",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for i, want := range expected {
+		if !strings.Contains(problems[i].Error(), want) {
+			t.Errorf("Expected problem containing %q, got %q", want, problems[i])
+		}
+	}
+
+	cfg = DefaultConfig()
+	cfg.ModelConcurrency = maxModelConcurrency + 1
+	cfg.Prompt = "Review"
+	cfg.APIKey = "sk-test"
+	if err := cfg.Validate(); err == nil || !strings.Contains(err.Error(), "model_concurrency") {
+		t.Errorf("Expected model_concurrency error, got %v", err)
+	}
+
+	cfg = DefaultConfig()
+	cfg.Models = []string{"GLM-4.5", "Kimi-K2"}
+	cfg.ModelConcurrency = 2
+	cfg.Mode = ModePatch
+	if problems := cfg.validateModels(); len(problems) != 0 {
+		t.Errorf("Expected concurrent models in patch mode to be valid, got %v", problems)
+	}
+}
+
+func TestRunnerRunModels(t *testing.T) {
+	tests := []struct {
+		name         string
+		models       []string
+		concurrency  int
+		mode         string
+		expectedExit int
+		outcomes     []string
+		peak         int
+	}{
+		{
+			name:     "Models run one at a time",
+			models:   []string{"Qwen3-Coder", "GLM-4.5", "Kimi-K2"},
+			outcomes: []string{OutcomeSuccess, OutcomeSuccess, OutcomeSuccess},
+			peak:     1,
+		},
+		{
+			name:        "Models run concurrently",
+			models:      []string{"Qwen3-Coder", "GLM-4.5", "Kimi-K2"},
+			concurrency: 2,
+			mode:        ModePatch,
+			outcomes:    []string{OutcomeSuccess, OutcomeSuccess, OutcomeSuccess},
+			peak:        2,
+		},
+		{
+			name:         "A failed model fails the run",
+			models:       []string{"Qwen3-Coder", "broken"},
+			expectedExit: 3,
+			outcomes:     []string{OutcomeSuccess, OutcomeFailure},
+			peak:         1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+
+			executor := &modelExecutor{delay: 50 * time.Millisecond}
+			sink := &recordingSink{}
+			runner := &Runner{
+				Executor: executor,
+				Logger:   ConsoleLogger{Out: io.Discard},
+				Sinks:    []Sink{sink},
+				Stdout:   io.Discard,
+				Stderr:   io.Discard,
+			}
+
+			cfg := DefaultConfig()
+			cfg.APIKey = "sk-test"
+			cfg.Prompt = "Review"
+			cfg.IsolatedHome = true
+			cfg.Models = tt.models
+			if tt.concurrency > 0 {
+				cfg.ModelConcurrency = tt.concurrency
+			}
+			if tt.mode != "" {
+				cfg.Mode = tt.mode
+				cfg.WorkingDir = t.TempDir()
+			}
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.ExitCode != tt.expectedExit {
+				t.Errorf("Expected exit code %d, got %d", tt.expectedExit, result.ExitCode)
+			}
+			if len(result.Models) != len(tt.models) {
+				t.Fatalf("Expected %d model results, got %d", len(tt.models), len(result.Models))
+			}
+			for i, model := range result.Models {
+				if model.Model != tt.models[i] {
+					t.Errorf("Expected model %s, got %s", tt.models[i], model.Model)
+				}
+				if model.Outcome() != tt.outcomes[i] {
+					t.Errorf("Model %s: expected outcome %s, got %s", model.Model, tt.outcomes[i], model.Outcome())
+				}
+				if model.Output != fmt.Sprintf("answer from %s\n", model.Model) {
+					t.Errorf("Model %s: unexpected output %q", model.Model, model.Output)
+				}
+				if !strings.Contains(result.Output, model.Output) {
+					t.Errorf("Expected overall output to contain %q, got %q", model.Output, result.Output)
+				}
+			}
+			if executor.peak != tt.peak {
+				t.Errorf("Expected %d models running at once, got %d", tt.peak, executor.peak)
+			}
+
+			// Every model had its own home, removed after the run
+			seen := make(map[string]bool)
+			for _, home := range executor.homes {
+				if seen[home] {
+					t.Errorf("Home %s was shared between models", home)
+				}
+				seen[home] = true
+				if _, err := os.Stat(home); !os.IsNotExist(err) {
+					t.Errorf("Expected home %s to be removed, got %v", home, err)
+				}
+			}
+
+			summary := GenerateSummaryMarkdown(sink.cfg, sink.result)
+			if !strings.Contains(summary, "Model Comparison") {
+				t.Errorf("Expected model comparison in summary, got:\n%s", summary)
+			}
+			for _, model := range tt.models {
+				if !strings.Contains(summary, fmt.Sprintf("`%s` |", model)) {
+					t.Errorf("Expected a column for model %s in summary", model)
+				}
+			}
+		})
+	}
+}
+
+func TestPrefixWriter(t *testing.T) {
+	var out strings.Builder
+	var mu sync.Mutex
+	w := &prefixWriter{mu: &mu, w: &out, prefix: "[GLM-4.5] "}
+
+	fmt.Fprint(w, "first line\nsecond ")
+	fmt.Fprint(w, "line\nunterminated")
+	w.flush()
+
+	expected := "[GLM-4.5] first line\n[GLM-4.5] second line\n[GLM-4.5] unterminated\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestModelsJSON(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	models := []ModelResult{
+		{Model: "Qwen3-Coder", Execution: Execution{Output: "ok", StartTime: start, EndTime: start.Add(1500 * time.Millisecond)}},
+		{Model: "GLM-4.5", Execution: Execution{Output: "partial", Stderr: "warning", ExitCode: ExitCodeTimeout, TimedOut: true}},
+	}
+
+	data, err := ModelsJSON(models)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `[{"model":"Qwen3-Coder","outcome":"success","exit_code":0,"duration_seconds":1.5,"output":"ok","stderr":""},` +
+		`{"model":"GLM-4.5","outcome":"timeout","exit_code":124,"duration_seconds":0,"output":"partial","stderr":"warning"}]`
+	if data != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
@@ -0,0 +1,416 @@
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Bounds of max_output_size. The upper bound keeps the result output well
+// below the size limits of GITHUB_OUTPUT.
+const (
+	minOutputSize = 1024
+	maxOutputSize = 1024 * 1024
+)
+
+// MaxPublishedSize caps every value published as a GitHub Actions output,
+// leaving headroom below the 1 MB GitHub allows per output.
+const MaxPublishedSize = 900 * 1000
+
+// maxSummaryOutput caps the output of a failed run in the step summary; the
+// complete output is in result_file.
+const maxSummaryOutput = 10 * 1000
+
+// maxPendingLine caps how much of an unterminated line the spill writer
+// holds before redacting and writing it anyway.
+const maxPendingLine = 64 * 1024
+
+// outputCapture collects the output of one iflow attempt, safe for
+// concurrent writes from the stdout and stderr copiers. It keeps at most
+// limit bytes in memory, the head and the tail of the stream, and spills the
+// complete stream to a file.
+type outputCapture struct {
+	mu    sync.Mutex
+	half  int
+	head  []byte
+	tail  []byte
+	total int64
+	spill *lineRedactor // Complete stream, redacted; nil when not spilling
+	file  *os.File
+}
+
+// newOutputCapture returns a capture that keeps limit bytes in memory and
+// spills the complete stream, each line passed through clean, to path and
+// log when they are set.
+func newOutputCapture(limit int, path string, log io.Writer, clean func(string) string) (*outputCapture, error) {
+	c := &outputCapture{half: limit / 2}
+
+	var spill []io.Writer
+	if path != "" {
+		file, err := os.Create(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output file: %w", err)
+		}
+		c.file = file
+		spill = append(spill, file)
+	}
+	if log != nil {
+		spill = append(spill, log)
+	}
+	if len(spill) > 0 {
+		c.spill = &lineRedactor{w: io.MultiWriter(spill...), clean: clean}
+	}
+	return c, nil
+}
+
+func (c *outputCapture) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	n := len(p)
+	c.total += int64(n)
+	if c.spill != nil {
+		// A full disk must not fail iflow; the in-memory copy is still kept
+		c.spill.Write(p)
+	}
+
+	if room := c.half - len(c.head); room > 0 {
+		taken := min(room, len(p))
+		c.head = append(c.head, p[:taken]...)
+		p = p[taken:]
+	}
+	c.tail = append(c.tail, p...)
+	if len(c.tail) > 2*c.half {
+		c.tail = append(c.tail[:0], c.tail[len(c.tail)-c.half:]...)
+	}
+	return n, nil
+}
+
+// Close flushes and closes the spill file.
+func (c *outputCapture) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.spill != nil {
+		c.spill.flush()
+	}
+	if c.file == nil {
+		return nil
+	}
+	return c.file.Close()
+}
+
+// Size returns how many bytes were written in total.
+func (c *outputCapture) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// Truncated reports whether String omits part of the output.
+func (c *outputCapture) Truncated() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total > int64(2*c.half)
+}
+
+// Path returns the spill file, or "" when the stream is not spilled.
+func (c *outputCapture) Path() string {
+	if c.file == nil {
+		return ""
+	}
+	return c.file.Name()
+}
+
+// String returns the captured output. When it exceeded the limit, the middle
+// is replaced by a note pointing at the spill file.
+func (c *outputCapture) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tail := c.tail
+	if len(tail) > c.half {
+		tail = tail[len(tail)-c.half:]
+	}
+	if c.total <= int64(2*c.half) {
+		return string(c.head) + string(tail)
+	}
+
+	// Don't split multi-byte characters at the cut points
+	head := c.head
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRune(head[i:]) {
+				head = head[:i]
+			}
+			break
+		}
+	}
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+
+	omitted := c.total - int64(len(head)) - int64(len(tail))
+	note := fmt.Sprintf("\n\n... [%d bytes omitted] ...\n\n", omitted)
+	if c.file != nil {
+		note = fmt.Sprintf("\n\n... [%d bytes omitted; the complete output is in %s] ...\n\n", omitted, c.file.Name())
+	}
+	return string(head) + note + string(tail)
+}
+
+// LimitOutput returns value cut in the middle to fit in MaxPublishedSize
+// bytes.
+func LimitOutput(value string) string {
+	return truncateMiddle(value, MaxPublishedSize)
+}
+
+// truncateMiddle returns s when it fits in limit bytes, otherwise its head
+// and tail around a note on the bytes omitted, at most limit bytes in all.
+func truncateMiddle(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	// The note is sized for the largest count it can hold
+	noteSize := len(fmt.Sprintf("\n\n... [%d bytes omitted] ...\n\n", len(s)))
+	keep := max(limit-noteSize, 0)
+	head, tail := s[:keep/2], s[len(s)-(keep-keep/2):]
+
+	// Don't split multi-byte characters at the cut points
+	for i := len(head) - 1; i >= 0 && i >= len(head)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(head[i]) {
+			if !utf8.FullRuneInString(head[i:]) {
+				head = head[:i]
+			}
+			break
+		}
+	}
+	for len(tail) > 0 && !utf8.RuneStart(tail[0]) {
+		tail = tail[1:]
+	}
+	note := fmt.Sprintf("\n\n... [%d bytes omitted] ...\n\n", len(s)-len(head)-len(tail))
+	if keep == 0 {
+		return note[:min(len(note), limit)]
+	}
+	return head + note + tail
+}
+
+// fitJSON marshals the value build returns for a per-field limit, halving
+// the limit until the JSON fits in MaxPublishedSize bytes.
+func fitJSON(limit int, build func(limit int) interface{}) (string, error) {
+	for {
+		data, err := json.Marshal(build(limit))
+		if err != nil {
+			return "", err
+		}
+		if len(data) <= MaxPublishedSize || limit == 0 {
+			return string(data), nil
+		}
+		limit /= 2
+	}
+}
+
+// lineRedactor cleans complete lines, redacting them at least, before
+// writing them to w, so secrets never reach the disk. Patterns spanning
+// several lines are not matched.
+type lineRedactor struct {
+	w       io.Writer
+	clean   func(string) string
+	pending []byte
+}
+
+func (l *lineRedactor) Write(p []byte) (int, error) {
+	l.pending = append(l.pending, p...)
+	for {
+		i := bytes.IndexByte(l.pending, '\n')
+		if i < 0 {
+			break
+		}
+		if _, err := io.WriteString(l.w, l.clean(string(l.pending[:i+1]))); err != nil {
+			return len(p), err
+		}
+		l.pending = l.pending[i+1:]
+	}
+	if len(l.pending) > maxPendingLine {
+		l.flush()
+	}
+	return len(p), nil
+}
+
+// flush writes an unterminated last line.
+func (l *lineRedactor) flush() {
+	if len(l.pending) > 0 {
+		io.WriteString(l.w, l.clean(string(l.pending)))
+		l.pending = nil
+	}
+}
+
+// transcript interleaves the lines of stdout and stderr in the order they
+// complete, each prefixed with the time it started and its stream.
+type transcript struct {
+	mu    sync.Mutex
+	w     io.Writer
+	clean func(string) string // Applied to every line, redacting it at least
+}
+
+// stream returns a writer for one stream of an invocation, tagged tag.
+func (t *transcript) stream(tag string) *transcriptStream {
+	return &transcriptStream{transcript: t, tag: tag}
+}
+
+// transcriptStream splits one stream into transcript lines. All streams of a
+// transcript share its lock, so lines are written in the order they complete.
+type transcriptStream struct {
+	transcript *transcript
+	tag        string
+	pending    []byte
+	start      time.Time // When the pending line began
+}
+
+func (s *transcriptStream) Write(p []byte) (int, error) {
+	s.transcript.mu.Lock()
+	defer s.transcript.mu.Unlock()
+
+	n := len(p)
+	for len(p) > 0 {
+		if len(s.pending) == 0 {
+			s.start = time.Now()
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			s.pending = append(s.pending, p...)
+			if len(s.pending) > maxPendingLine {
+				s.writeLine()
+			}
+			break
+		}
+		s.pending = append(s.pending, p[:i]...)
+		s.writeLine()
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// flush writes an unterminated last line.
+func (s *transcriptStream) flush() {
+	s.transcript.mu.Lock()
+	defer s.transcript.mu.Unlock()
+
+	if len(s.pending) > 0 {
+		s.writeLine()
+	}
+}
+
+func (s *transcriptStream) writeLine() {
+	line := s.transcript.clean(string(s.pending))
+	fmt.Fprintf(s.transcript.w, "%s [%s] %s\n", s.start.UTC().Format("2006-01-02T15:04:05.000Z"), s.tag, line)
+	s.pending = s.pending[:0]
+}
+
+// githubHome is where the runner mounts $RUNNER_TEMP/_github_home in the
+// container of a Docker action. RUNNER_TEMP itself is not mounted there.
+var githubHome = "/github/home"
+
+// tempParent returns the directory temporary and output directories are
+// created in: githubHome in the action's container, else RUNNER_TEMP when it
+// exists, else the system temporary directory.
+func tempParent() string {
+	if info, err := os.Stat(githubHome); err == nil && info.IsDir() {
+		return githubHome
+	}
+	if runnerTemp := os.Getenv("RUNNER_TEMP"); runnerTemp != "" {
+		if info, err := os.Stat(runnerTemp); err == nil && info.IsDir() {
+			return runnerTemp
+		}
+	}
+	return os.TempDir()
+}
+
+// hostPath returns the path later workflow steps see a file under
+// githubHome at; other paths are returned unchanged.
+func hostPath(path string) string {
+	runnerTemp := os.Getenv("RUNNER_TEMP")
+	if path == "" || runnerTemp == "" {
+		return path
+	}
+	rel, err := filepath.Rel(githubHome, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		return path
+	}
+	return filepath.Join(runnerTemp, "_github_home", rel)
+}
+
+// setupOutputFiles creates the directory for output files, the log file
+// that receives the complete output of every iflow invocation and, when
+// requested, the transcript. Unlike the home directories they are kept, so
+// later workflow steps can read them; outside GitHub Actions the caller
+// removes the directory.
+func (r *run) setupOutputFiles() error {
+	dir, err := os.MkdirTemp(tempParent(), "iflow-output-")
+	if err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	log, err := os.Create(filepath.Join(dir, "iflow.log"))
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %w", err)
+	}
+	r.addCleanup(func() { log.Close() })
+
+	r.outputDir = dir
+	r.log = log
+	r.info(fmt.Sprintf("Writing the complete iFlow CLI output to %s", hostPath(log.Name())))
+
+	if r.cfg.Transcript {
+		file, err := os.Create(filepath.Join(dir, "transcript.log"))
+		if err != nil {
+			return fmt.Errorf("failed to create transcript file: %w", err)
+		}
+		r.addCleanup(func() { file.Close() })
+		r.transcript = &transcript{w: file, clean: r.cleanLine}
+		r.info(fmt.Sprintf("Writing a timestamped transcript of stdout and stderr to %s", hostPath(file.Name())))
+	}
+	return nil
+}
+
+// cleanLine prepares iflow output for the result, output files and the
+// summary: terminal escape sequences are stripped when requested, then
+// secrets are redacted.
+func (r *run) cleanLine(line string) string {
+	if r.cfg.StripANSI {
+		line = stripANSI(line)
+	}
+	return r.redactor.Redact(line)
+}
+
+// ansiSequence matches the escape sequences terminals use for colours,
+// cursor movement and window titles.
+var ansiSequence = regexp.MustCompile(`\x1b(?:\[[0-?]*[ -/]*[@-~]|\][^\x07\x1b]*(?:\x07|\x1b\\)|[@-Z\\-_])`)
+
+// stripANSI removes terminal escape sequences from s and turns the CRLF
+// line endings of a terminal back into LF.
+func stripANSI(s string) string {
+	s = ansiSequence.ReplaceAllString(s, "")
+	return strings.ReplaceAll(s, "\r\n", "\n")
+}
+
+// newOutputPath reserves a file in the output directory for the complete
+// output of one invocation, or returns "" when output is not spilled.
+func (r *run) newOutputPath(pattern string) (string, error) {
+	if r.outputDir == "" {
+		return "", nil
+	}
+	file, err := os.CreateTemp(r.outputDir, pattern)
+	if err != nil {
+		return "", fmt.Errorf("failed to create output file: %w", err)
+	}
+	file.Close()
+	return file.Name(), nil
+}
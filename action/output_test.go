@@ -0,0 +1,389 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestOutputCapture(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	redactor.AddValue("sk-secret-value")
+
+	tests := []struct {
+		name      string
+		writes    []string
+		limit     int
+		expected  string
+		truncated bool
+	}{
+		{
+			name:     "Output within the limit is kept",
+			writes:   []string{"hello ", "world\n"},
+			limit:    1024,
+			expected: "hello world\n",
+		},
+		{
+			name:      "Head and tail are kept",
+			writes:    []string{"0123456789", "abcdefghij", "ABCDEFGHIJ"},
+			limit:     10,
+			expected:  "01234\n\n... [20 bytes omitted; the complete output is in %s] ...\n\nFGHIJ",
+			truncated: true,
+		},
+		{
+			name:      "Characters are not split",
+			writes:    []string{"ab€€€€cd"},
+			limit:     6,
+			expected:  "ab\n\n... [12 bytes omitted; the complete output is in %s] ...\n\ncd",
+			truncated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "output.log")
+			var log strings.Builder
+			capture, err := newOutputCapture(tt.limit, path, &log, redactor.Redact)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			for _, write := range tt.writes {
+				fmt.Fprint(capture, write)
+			}
+			if err := capture.Close(); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			expected := tt.expected
+			if tt.truncated {
+				expected = fmt.Sprintf(tt.expected, path)
+			}
+			if capture.String() != expected {
+				t.Errorf("Expected %q, got %q", expected, capture.String())
+			}
+			if capture.Truncated() != tt.truncated {
+				t.Errorf("Expected truncated %v, got %v", tt.truncated, capture.Truncated())
+			}
+
+			complete := strings.Join(tt.writes, "")
+			if capture.Size() != int64(len(complete)) {
+				t.Errorf("Expected size %d, got %d", len(complete), capture.Size())
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(data) != complete || log.String() != complete {
+				t.Errorf("Expected the complete output %q in the file and log, got %q and %q", complete, data, log.String())
+			}
+		})
+	}
+}
+
+func TestOutputCaptureRedactsFile(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	redactor.AddValue("sk-secret-value")
+
+	path := filepath.Join(t.TempDir(), "output.log")
+	capture, err := newOutputCapture(1024, path, nil, redactor.Redact)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The secret arrives split across two writes
+	fmt.Fprint(capture, "key=sk-secret")
+	fmt.Fprint(capture, "-value\nlast line")
+	capture.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != "key=***\nlast line" {
+		t.Errorf("Expected the secret to be redacted, got %q", data)
+	}
+}
+
+func TestRunnerRunOutputFiles(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	output := strings.Repeat("x", 3000)
+	executor := &fakeExecutor{output: output, exitCodes: []int{1, 0}}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-test"
+	cfg.IsolatedHome = true
+	cfg.MaxOutputSize = 1024
+	cfg.Retries = 1
+	cfg.RetryBackoff = 0
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !result.Truncated || len(result.Output) >= len(output) {
+		t.Errorf("Expected truncated output, got %d bytes", len(result.Output))
+	}
+	if result.OutputSize != int64(len(output)) {
+		t.Errorf("Expected output size %d, got %d", len(output), result.OutputSize)
+	}
+
+	data, err := os.ReadFile(result.OutputFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != output {
+		t.Errorf("Expected the complete output of the last attempt in the result file, got %d bytes", len(data))
+	}
+
+	data, err = os.ReadFile(result.LogFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != output+output {
+		t.Errorf("Expected the output of both attempts in the log file, got %d bytes", len(data))
+	}
+}
+
+// containerLayout reproduces what the container of a Docker action sees:
+// RUNNER_TEMP names a directory on the runner that does not exist in the
+// container, and only githubHome is mounted. It returns where files under
+// githubHome are found on the runner.
+func containerLayout(t *testing.T) string {
+	t.Helper()
+	runnerTemp := filepath.Join(t.TempDir(), "runner", "_temp")
+	t.Setenv("RUNNER_TEMP", runnerTemp)
+	home := githubHome
+	githubHome = t.TempDir()
+	t.Cleanup(func() { githubHome = home })
+	return filepath.Join(runnerTemp, "_github_home")
+}
+
+// mountedPath returns the file in the container behind path, a path on the
+// runner under mounted.
+func mountedPath(t *testing.T, mounted, path string) string {
+	t.Helper()
+	rel, err := filepath.Rel(mounted, path)
+	if err != nil || !filepath.IsLocal(rel) {
+		t.Fatalf("Expected %s to be under %s", path, mounted)
+	}
+	return filepath.Join(githubHome, rel)
+}
+
+func TestRunnerRunOutputFilesInContainer(t *testing.T) {
+	mounted := containerLayout(t)
+
+	runner := &Runner{
+		Executor: &fakeExecutor{output: "done"},
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-test"
+	cfg.IsolatedHome = true
+	cfg.DetectChanges = false
+	cfg.Transcript = true
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The files are written to the mounted home and reported at its path on
+	// the runner
+	for _, path := range []string{result.OutputDir, result.OutputFile, result.LogFile, result.TranscriptFile} {
+		if _, err := os.Stat(mountedPath(t, mounted, path)); err != nil {
+			t.Errorf("Expected %s to be written to the mounted home: %v", path, err)
+		}
+	}
+}
+
+func TestTempParent(t *testing.T) {
+	home := githubHome
+	githubHome = filepath.Join(t.TempDir(), "missing")
+	defer func() { githubHome = home }()
+
+	runnerTemp := t.TempDir()
+	t.Setenv("RUNNER_TEMP", runnerTemp)
+	if parent := tempParent(); parent != runnerTemp {
+		t.Errorf("Expected RUNNER_TEMP, got %s", parent)
+	}
+
+	t.Setenv("RUNNER_TEMP", filepath.Join(runnerTemp, "missing"))
+	if parent := tempParent(); parent != os.TempDir() {
+		t.Errorf("Expected the system temporary directory for a missing RUNNER_TEMP, got %s", parent)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	redactor, err := NewRedactor(nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	redactor.AddValue("sk-secret-value")
+
+	var out strings.Builder
+	tr := &transcript{w: &out, clean: redactor.Redact}
+	stdout := tr.stream("stdout")
+	stderr := tr.stream("analyze stderr")
+
+	fmt.Fprint(stdout, "first ")
+	fmt.Fprint(stderr, "warning: key sk-secret-value\n")
+	fmt.Fprint(stdout, "line\nunterminated")
+	stdout.flush()
+	stderr.flush()
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	expected := []string{
+		"[analyze stderr] warning: key ***",
+		"[stdout] first line",
+		"[stdout] unterminated",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("Expected %d lines, got %q", len(expected), out.String())
+	}
+	timestamp := regexp.MustCompile(`^\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{3}Z `)
+	for i, line := range lines {
+		if !timestamp.MatchString(line) {
+			t.Errorf("Expected a timestamp prefix, got %q", line)
+		}
+		if got := timestamp.ReplaceAllString(line, ""); got != expected[i] {
+			t.Errorf("Expected %q, got %q", expected[i], got)
+		}
+	}
+}
+
+// streamExecutor writes to both stdout and stderr of iflow.
+type streamExecutor struct{}
+
+func (streamExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if len(cmd.Args) > 0 && cmd.Args[0] == "--version" {
+		return 0, nil
+	}
+	fmt.Fprint(cmd.Stderr, "debug: starting\n")
+	fmt.Fprint(cmd.Stdout, "The answer\n")
+	fmt.Fprint(cmd.Stderr, "warning: slow response\n")
+	return 0, nil
+}
+
+func TestRunnerRunSeparateStreams(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	runner := &Runner{
+		Executor: streamExecutor{},
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-test"
+	cfg.IsolatedHome = true
+	cfg.Transcript = true
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Output != "The answer\n" {
+		t.Errorf("Expected stdout only in the output, got %q", result.Output)
+	}
+	if result.Stderr != "debug: starting\nwarning: slow response\n" {
+		t.Errorf("Expected stderr to be captured separately, got %q", result.Stderr)
+	}
+
+	data, err := os.ReadFile(result.TranscriptFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	transcript := regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(string(data), "")
+	expected := "[stderr] debug: starting\n[stdout] The answer\n[stderr] warning: slow response\n"
+	if transcript != expected {
+		t.Errorf("Expected transcript %q, got %q", expected, transcript)
+	}
+}
+
+func TestStripANSI(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "Colours",
+			input:    "\x1b[1;32mpassed\x1b[0m\r\n",
+			expected: "passed\n",
+		},
+		{
+			name:     "Cursor movement and erasing",
+			input:    "\x1b[2K\x1b[1Gdone\x1b[?25h",
+			expected: "done",
+		},
+		{
+			name:     "Window title",
+			input:    "\x1b]0;iflow\x07output",
+			expected: "output",
+		},
+		{
+			name:     "Plain text is unchanged",
+			input:    "a [bracket] and \\x1b\n",
+			expected: "a [bracket] and \\x1b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripANSI(tt.input); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestTruncateMiddle(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		limit    int
+		expected string
+	}{
+		{name: "fits", value: "short", limit: 5, expected: "short"},
+		{name: "cut", value: strings.Repeat("a", 50) + strings.Repeat("b", 50), limit: 60, expected: strings.Repeat("a", 14) + "\n\n... [71 bytes omitted] ...\n\n" + strings.Repeat("b", 15)},
+		{name: "runes", value: strings.Repeat("é", 50), limit: 40, expected: "éé\n\n... [92 bytes omitted] ...\n\néé"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			truncated := truncateMiddle(tt.value, tt.limit)
+			if truncated != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, truncated)
+			}
+			if len(truncated) > tt.limit {
+				t.Errorf("Expected at most %d bytes, got %d", tt.limit, len(truncated))
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+//go:build !unix
+
+package action
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// processGroup is a no-op on platforms without process groups.
+type processGroup struct{}
+
+// configureProcessGroup keeps the os/exec default of killing only the child
+// on platforms without process groups.
+func configureProcessGroup(ctx context.Context, cmd *exec.Cmd, grace time.Duration) *processGroup {
+	return &processGroup{}
+}
+
+// stop is a no-op on platforms without process groups.
+func (g *processGroup) stop() {}
+
+// processUsage returns the CPU time used by a process that exited; peak
+// memory is not reported on these platforms.
+func processUsage(state *os.ProcessState) ResourceUsage {
+	return ResourceUsage{UserCPU: state.UserTime(), SystemCPU: state.SystemTime()}
+}
@@ -0,0 +1,118 @@
+//go:build unix
+
+package action
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+	"time"
+)
+
+// processGroup stops the process group a command leads.
+type processGroup struct {
+	cmd      *exec.Cmd
+	grace    time.Duration
+	deadline time.Time   // When the group is killed once terminate sent SIGTERM
+	kill     *time.Timer // Kills the group at deadline
+}
+
+// configureProcessGroup starts cmd in a new process group and makes the end
+// of ctx terminate the whole group.
+func configureProcessGroup(ctx context.Context, cmd *exec.Cmd, grace time.Duration) *processGroup {
+	g := &processGroup{cmd: cmd, grace: grace}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return g.terminate(ctx) }
+	return g
+}
+
+// terminate sends SIGTERM to the group and SIGKILL once the grace period has
+// passed, or cancelGracePeriod when the run was cancelled.
+func (g *processGroup) terminate(ctx context.Context) error {
+	grace := g.grace
+	if cancelled(ctx) {
+		grace = min(grace, cancelGracePeriod)
+	}
+	pid := g.cmd.Process.Pid
+	g.deadline = time.Now().Add(grace)
+	g.kill = time.AfterFunc(grace, func() { syscall.Kill(-pid, syscall.SIGKILL) })
+	return syscall.Kill(-pid, syscall.SIGTERM)
+}
+
+// stop terminates processes left in the group after the leader exited:
+// SIGTERM first, SIGKILL once grace has passed. A group that was already
+// terminated only gets what is left of its grace period. Group members that
+// became our children are reaped so no zombies remain.
+func (g *processGroup) stop() {
+	// cmd.Wait returned, so terminate is done if it ran at all
+	if g.kill != nil {
+		g.kill.Stop()
+	}
+	pid := g.cmd.Process.Pid
+	if !processGroupAlive(pid) {
+		return
+	}
+
+	deadline := g.deadline
+	if deadline.IsZero() {
+		syscall.Kill(-pid, syscall.SIGTERM)
+		deadline = time.Now().Add(g.grace)
+	}
+	if waitProcessGroup(pid, time.Until(deadline)) {
+		return
+	}
+
+	syscall.Kill(-pid, syscall.SIGKILL)
+	waitProcessGroup(pid, time.Second)
+}
+
+// waitProcessGroup reaps group members until none are left or timeout
+// passes, and reports whether the group is gone.
+func waitProcessGroup(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		reapProcessGroup(pid)
+		if !processGroupAlive(pid) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// processGroupAlive reports whether any process remains in the group.
+func processGroupAlive(pid int) bool {
+	err := syscall.Kill(-pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// reapProcessGroup collects the exit status of group members that were
+// reparented to this process, e.g. when it runs as PID 1 in a container.
+func reapProcessGroup(pid int) {
+	for {
+		var status syscall.WaitStatus
+		reaped, err := syscall.Wait4(-pid, &status, syscall.WNOHANG, nil)
+		if err != nil || reaped <= 0 {
+			return
+		}
+	}
+}
+
+// processUsage returns the resources used by a process that exited and the
+// descendants it waited for.
+func processUsage(state *os.ProcessState) ResourceUsage {
+	usage := ResourceUsage{UserCPU: state.UserTime(), SystemCPU: state.SystemTime()}
+	if rusage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		// Reported in bytes on macOS and in kilobytes elsewhere
+		usage.PeakMemory = int64(rusage.Maxrss)
+		if runtime.GOOS != "darwin" && runtime.GOOS != "ios" {
+			usage.PeakMemory *= 1024
+		}
+	}
+	return usage
+}
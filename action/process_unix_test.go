@@ -0,0 +1,208 @@
+//go:build unix
+
+package action
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// processGone reports whether pid has exited; zombies waiting for a parent
+// that is not this process count as gone.
+func processGone(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return true
+	}
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	return err == nil && strings.Contains(string(stat), ") Z ")
+}
+
+func TestExecExecutorProcessGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		script  string
+		timeout time.Duration
+		cancel  bool          // Cancel the context at timeout instead of letting it expire
+		grace   time.Duration // Defaults to 200ms
+		within  time.Duration // Defaults to 5s
+	}{
+		{
+			name:    "Timeout stops descendants",
+			script:  "sleep 30 & echo $!; trap '' TERM; sleep 30",
+			timeout: 200 * time.Millisecond,
+		},
+		{
+			name:    "Orphaned descendants are stopped after exit",
+			script:  "sleep 30 & echo $!",
+			timeout: 30 * time.Second,
+		},
+		{
+			name:    "Grace period is waited for once",
+			script:  "(trap '' TERM; sleep 30) & echo $!; sleep 30",
+			timeout: 200 * time.Millisecond,
+			grace:   2 * time.Second,
+			within:  3500 * time.Millisecond,
+		},
+		{
+			name:    "Cancellation caps the grace period",
+			script:  "sleep 30 & echo $!; trap '' TERM; sleep 30",
+			timeout: 200 * time.Millisecond,
+			cancel:  true,
+			grace:   30 * time.Second,
+			within:  cancelGracePeriod + 1500*time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ctx context.Context
+			var cancel context.CancelFunc
+			if tt.cancel {
+				ctx, cancel = context.WithCancel(context.Background())
+				time.AfterFunc(tt.timeout, cancel)
+			} else {
+				ctx, cancel = context.WithTimeout(context.Background(), tt.timeout)
+			}
+			defer cancel()
+			grace, within := 200*time.Millisecond, 5*time.Second
+			if tt.grace > 0 {
+				grace, within = tt.grace, tt.within
+			}
+
+			var output bytes.Buffer
+			start := time.Now()
+			_, err := ExecExecutor{}.Run(ctx, Command{
+				Name:        "sh",
+				Args:        []string{"-c", tt.script},
+				Stdout:      &output,
+				Stderr:      &output,
+				GracePeriod: grace,
+			})
+			if err != nil && ctx.Err() == nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > within {
+				t.Errorf("Expected the command to be stopped promptly, took %s", elapsed)
+			}
+
+			pid, err := strconv.Atoi(strings.TrimSpace(output.String()))
+			if err != nil {
+				t.Fatalf("Expected background pid in output, got %q", output.String())
+			}
+			deadline := time.Now().Add(2 * time.Second)
+			for !processGone(pid) && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+			if !processGone(pid) {
+				syscall.Kill(pid, syscall.SIGKILL)
+				t.Errorf("Expected background process %d to be stopped", pid)
+			}
+		})
+	}
+}
+
+// serviceExecutor runs pre-commands with ExecExecutor and records whether the
+// process whose pid they wrote to pidFile is still running when iflow starts.
+type serviceExecutor struct {
+	pidFile string
+	pid     int
+	running bool
+}
+
+func (s *serviceExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if cmd.Name != "iflow" {
+		return ExecExecutor{}.Run(ctx, cmd)
+	}
+	if cmd.Args[0] == "--version" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(s.pidFile)
+	if err != nil {
+		return 1, err
+	}
+	s.pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	s.running = s.pid > 0 && !processGone(s.pid)
+	return 0, nil
+}
+
+func TestRunnerRunPreCmdBackgroundService(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+	pidFile := filepath.Join(t.TempDir(), "service.pid")
+	executor := &serviceExecutor{pidFile: pidFile}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Query the service"
+	cfg.APIKey = "sk-test"
+	cfg.IsolatedHome = true
+	cfg.DetectChanges = false
+	cfg.PreCmd = fmt.Sprintf("sleep 30 >/dev/null 2>&1 & echo $! > %s", pidFile)
+
+	if _, err := runner.Run(context.Background(), cfg); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if executor.pid > 0 {
+		syscall.Kill(executor.pid, syscall.SIGKILL)
+	}
+	if !executor.running {
+		t.Errorf("Expected the service started by precmd to be running when iflow starts")
+	}
+}
+
+func TestExecExecutorLimits(t *testing.T) {
+	var output bytes.Buffer
+	var usage ResourceUsage
+	exitCode, err := ExecExecutor{}.Run(context.Background(), Command{
+		Name:   "sh",
+		Args:   []string{"-c", "ulimit -n; ulimit -t"},
+		Stdout: &output,
+		Stderr: &output,
+		Limits: ResourceLimits{CPUSeconds: 60, OpenFiles: 256},
+		Usage:  &usage,
+	})
+	if err != nil || exitCode != 0 {
+		t.Fatalf("Unexpected result: exit code %d, %v", exitCode, err)
+	}
+	if output.String() != "256\n60\n" {
+		t.Errorf("Expected the limits to be in place at start, got %q", output.String())
+	}
+	if usage.PeakMemory <= 0 {
+		t.Errorf("Expected the peak memory to be reported, got %d", usage.PeakMemory)
+	}
+
+	// Exceeding the CPU time kills the process
+	start := time.Now()
+	exitCode, err = ExecExecutor{}.Run(context.Background(), Command{
+		Name:   "sh",
+		Args:   []string{"-c", "while :; do :; done"},
+		Limits: ResourceLimits{CPUSeconds: 1},
+		Usage:  &usage,
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exitCode == 0 {
+		t.Errorf("Expected the process to be killed")
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the CPU limit to stop the process, took %s", elapsed)
+	}
+	// The kernel accounts CPU time in ticks, so allow for some slack
+	if usage.UserCPU+usage.SystemCPU < 900*time.Millisecond {
+		t.Errorf("Expected about a second of CPU time, got %s user and %s system", usage.UserCPU, usage.SystemCPU)
+	}
+}
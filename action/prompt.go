@@ -0,0 +1,111 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// PromptData is the data passed to prompt templates.
+//
+//	{{ .Event.issue.title }}  fields from the GITHUB_EVENT_PATH payload
+//	{{ .GitHub.repository }}  GITHUB_* variables, lowercased without the prefix
+//	{{ .Env.HOME }}           any environment variable
+//	{{ .Steps.plan.Output }}  output of an earlier step of a multi-step run
+type PromptData struct {
+	Event  map[string]interface{}
+	GitHub map[string]string
+	Env    map[string]string
+	Steps  map[string]StepData
+}
+
+// resolvePrompt loads the prompt file when needed and renders the prompt
+// template, replacing c.Prompt with the final text.
+func (c *Config) resolvePrompt() error {
+	if c.Prompt != "" && c.PromptFile != "" {
+		return fmt.Errorf("prompt and prompt_file cannot both be set")
+	}
+	render := c.RenderPrompt
+
+	if c.Prompt == "" && c.PromptFile != "" {
+		data, err := os.ReadFile(c.PromptFile)
+		if err != nil {
+			return fmt.Errorf("failed to read prompt file: %w", err)
+		}
+		c.Prompt = strings.TrimSpace(string(data))
+		// Prompt files are versioned templates, always render them
+		render = true
+	}
+
+	if !render || c.Prompt == "" {
+		return nil
+	}
+
+	data, err := loadPromptData()
+	if err != nil {
+		return err
+	}
+
+	rendered, err := RenderPrompt(c.Prompt, data)
+	if err != nil {
+		return err
+	}
+	c.Prompt = strings.TrimSpace(rendered)
+	return nil
+}
+
+// RenderPrompt executes the prompt as a Go text/template. Referencing a
+// missing key is an error; use the index function for optional fields.
+func RenderPrompt(prompt string, data PromptData) (string, error) {
+	tmpl, err := parsePromptTemplate(prompt)
+	if err != nil {
+		return "", err
+	}
+
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// loadPromptData collects the event payload and environment for templates.
+func loadPromptData() (PromptData, error) {
+	data := PromptData{
+		Event:  map[string]interface{}{},
+		GitHub: map[string]string{},
+		Env:    map[string]string{},
+	}
+
+	for _, kv := range os.Environ() {
+		name, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		data.Env[name] = value
+		if suffix, found := strings.CutPrefix(name, "GITHUB_"); found {
+			data.GitHub[strings.ToLower(suffix)] = value
+		}
+	}
+
+	if eventPath := os.Getenv("GITHUB_EVENT_PATH"); eventPath != "" {
+		content, err := os.ReadFile(eventPath)
+		if err != nil {
+			return data, fmt.Errorf("failed to read GitHub event payload: %w", err)
+		}
+		if err := json.Unmarshal(content, &data.Event); err != nil {
+			return data, fmt.Errorf("failed to parse GitHub event payload: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
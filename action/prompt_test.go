@@ -0,0 +1,109 @@
+package action
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	data := PromptData{
+		Event: map[string]interface{}{
+			"issue": map[string]interface{}{"title": "Crash on startup", "number": 42},
+		},
+		GitHub: map[string]string{"repository": "iflow-ai/iflow-cli-action"},
+		Env:    map[string]string{"LABELS": "bug"},
+	}
+
+	tests := []struct {
+		name        string
+		prompt      string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "Event field",
+			prompt:   "Fix #{{ .Event.issue.number }}: {{ .Event.issue.title }}",
+			expected: "Fix #42: Crash on startup",
+		},
+		{
+			name:     "GitHub and env variables",
+			prompt:   "{{ .GitHub.repository }} {{ .Env.LABELS }}",
+			expected: "iflow-ai/iflow-cli-action bug",
+		},
+		{
+			name:     "Optional field with index",
+			prompt:   "{{ if index .Event \"pull_request\" }}PR{{ else }}issue{{ end }}",
+			expected: "issue",
+		},
+		{
+			name:     "toJSON function",
+			prompt:   "{{ toJSON .Env }}",
+			expected: `{"LABELS":"bug"}`,
+		},
+		{
+			name:        "Missing key",
+			prompt:      "{{ .Env.MISSING }}",
+			expectError: true,
+		},
+		{
+			name:        "Invalid syntax",
+			prompt:      "{{ .Event.issue.title ",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderPrompt(tt.prompt, data)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestResolvePromptFile(t *testing.T) {
+	tempDir := t.TempDir()
+	eventPath := filepath.Join(tempDir, "event.json")
+	if err := os.WriteFile(eventPath, []byte(`{"issue":{"title":"Add dark mode"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	promptPath := filepath.Join(tempDir, "prompt.md")
+	if err := os.WriteFile(promptPath, []byte("Implement: {{ .Event.issue.title }}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GITHUB_EVENT_PATH", eventPath)
+
+	cfg := &Config{PromptFile: promptPath}
+	if err := cfg.resolvePrompt(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Prompt != "Implement: Add dark mode" {
+		t.Errorf("Unexpected prompt: %q", cfg.Prompt)
+	}
+
+	// Inline prompts are left untouched unless rendering is requested
+	cfg = &Config{Prompt: "{{SEVERITY}} {{COMMENT_TEXT}}"}
+	if err := cfg.resolvePrompt(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if cfg.Prompt != "{{SEVERITY}} {{COMMENT_TEXT}}" {
+		t.Errorf("Inline prompt should not be rendered, got %q", cfg.Prompt)
+	}
+	// A prompt file is never silently ignored
+	cfg = &Config{Prompt: "Review the code", PromptFile: promptPath}
+	if err := cfg.resolvePrompt(); err == nil || !strings.Contains(err.Error(), "cannot both be set") {
+		t.Errorf("Expected an error for prompt and prompt_file, got %v", err)
+	}
+}
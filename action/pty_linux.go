@@ -0,0 +1,78 @@
+//go:build linux
+
+package action
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+	"unsafe"
+)
+
+// Size reported to programs running on the pseudo-terminal. It is wide
+// enough that progress output is not wrapped.
+const (
+	terminalRows    = 50
+	terminalColumns = 200
+)
+
+// openPTY opens a new pseudo-terminal and returns its master side and the
+// terminal the child runs on. The master stays non-blocking, so closing it
+// interrupts a pending read.
+func openPTY() (master, tty *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var number uint32
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&number)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to get terminal number: %w", err)
+	}
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		master.Close()
+		return nil, nil, fmt.Errorf("failed to unlock terminal: %w", err)
+	}
+
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", number), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		master.Close()
+		return nil, nil, err
+	}
+
+	size := struct{ rows, columns, x, y uint16 }{rows: terminalRows, columns: terminalColumns}
+	if err := ioctl(tty, syscall.TIOCSWINSZ, unsafe.Pointer(&size)); err != nil {
+		master.Close()
+		tty.Close()
+		return nil, nil, fmt.Errorf("failed to set terminal size: %w", err)
+	}
+	return master, tty, nil
+}
+
+// configureTerminal starts cmd in a new session with its stdin, the
+// terminal, as the controlling terminal. The session leader also leads a
+// process group with its own pid, so stopping the group works unchanged.
+func configureTerminal(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+}
+
+func ioctl(file *os.File, request uintptr, arg unsafe.Pointer) error {
+	conn, err := file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	err = conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	})
+	if err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+//go:build linux
+
+package action
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestExecExecutorPTY(t *testing.T) {
+	tests := []struct {
+		name         string
+		script       string
+		timeout      time.Duration
+		expected     string
+		expectedExit int
+	}{
+		{
+			name:     "Output goes through a terminal",
+			script:   "test -t 0 && test -t 1 && test -t 2 && echo tty; echo warning >&2; echo \"$TERM\"",
+			timeout:  30 * time.Second,
+			expected: "tty\nwarning\nxterm-256color\n",
+		},
+		{
+			name:         "Exit code is reported",
+			script:       "echo partial; exit 3",
+			timeout:      30 * time.Second,
+			expected:     "partial\n",
+			expectedExit: 3,
+		},
+		{
+			name:     "Timeout stops the session",
+			script:   "echo started; trap '' TERM; sleep 30",
+			timeout:  500 * time.Millisecond,
+			expected: "started\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), tt.timeout)
+			defer cancel()
+
+			var output bytes.Buffer
+			start := time.Now()
+			exitCode, err := ExecExecutor{}.Run(ctx, Command{
+				Name:        "sh",
+				Args:        []string{"-c", tt.script},
+				Env:         []string{"PATH=/usr/bin:/bin"},
+				Stdout:      &output,
+				GracePeriod: 200 * time.Millisecond,
+				PTY:         true,
+			})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Errorf("Expected the command to be stopped promptly, took %s", elapsed)
+			}
+			if ctx.Err() == nil && exitCode != tt.expectedExit {
+				t.Errorf("Expected exit code %d, got %d", tt.expectedExit, exitCode)
+			}
+			if got := stripANSI(output.String()); got != tt.expected {
+				t.Errorf("Expected output %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+package action
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// openPTY reports that pseudo-terminals are only supported on Linux.
+func openPTY() (master, tty *os.File, err error) {
+	return nil, nil, errors.New("pseudo-terminals are only supported on Linux")
+}
+
+// configureTerminal is a no-op where pseudo-terminals are not supported.
+func configureTerminal(cmd *exec.Cmd) {}
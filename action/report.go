@@ -0,0 +1,335 @@
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ReportVersion is the version of the run report format. It changes when
+// fields are removed or change meaning, not when fields are added.
+const ReportVersion = 1
+
+// Report is the machine-readable record of a run written to report_file.
+// Outputs and the config are redacted like everywhere else.
+type Report struct {
+	Version      int    `json:"version"`
+	IFlowVersion string `json:"iflow_version"`
+	Config       Config `json:"config"`
+	ReportExecution
+	LogFile        string             `json:"log_file"`
+	TranscriptFile string             `json:"transcript_file,omitempty"`
+	PreCommands    []ReportPreCommand `json:"pre_commands"`
+	JSON           json.RawMessage    `json:"json,omitempty"`
+	JSONErrors     []string           `json:"json_errors,omitempty"`
+	Changes        *ReportChanges     `json:"changes,omitempty"`
+	Commit         *ReportCommit      `json:"commit,omitempty"`
+	CommitError    string             `json:"commit_error,omitempty"`
+	Steps          []ReportStep       `json:"steps,omitempty"`
+	Models         []ReportModel      `json:"models,omitempty"`
+}
+
+// ReportExecution is an Execution in the report: the whole run, a step or a
+// model.
+type ReportExecution struct {
+	Outcome         string          `json:"outcome"`
+	ExitCode        int             `json:"exit_code"`
+	TimedOut        bool            `json:"timed_out"`
+	IdleTimedOut    bool            `json:"idle_timed_out"`
+	InvalidJSON     bool            `json:"invalid_json"`
+	Cancelled       bool            `json:"cancelled"`
+	StartTime       time.Time       `json:"start_time"`
+	EndTime         time.Time       `json:"end_time"`
+	DurationSeconds float64         `json:"duration_seconds"`
+	Attempts        []ReportAttempt `json:"attempts"`
+	Output          string          `json:"output"`
+	Stderr          string          `json:"stderr"`
+	OutputFile      string          `json:"output_file"`
+	OutputSize      int64           `json:"output_size"`
+	Truncated       bool            `json:"truncated"`
+	Usage           ReportUsage     `json:"usage"`
+}
+
+// ReportAttempt is one invocation of iflow in the report.
+type ReportAttempt struct {
+	Number          int     `json:"number"`
+	ExitCode        int     `json:"exit_code"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	TimedOut        bool    `json:"timed_out"`
+	IdleTimedOut    bool    `json:"idle_timed_out"`
+}
+
+// ReportUsage is the ResourceUsage of an execution in the report.
+type ReportUsage struct {
+	PeakMemoryBytes  int64   `json:"peak_memory_bytes"`
+	CPUUserSeconds   float64 `json:"cpu_user_seconds"`
+	CPUSystemSeconds float64 `json:"cpu_system_seconds"`
+}
+
+// ReportPreCommand is one line of precmd in the report.
+type ReportPreCommand struct {
+	Command         string  `json:"command"`
+	ExitCode        int     `json:"exit_code"`
+	DurationSeconds float64 `json:"duration_seconds"`
+}
+
+// ReportChanges are the Changes to the working tree in the report.
+type ReportChanges struct {
+	PatchFile string             `json:"patch_file"`
+	Files     []ReportFileChange `json:"files"`
+}
+
+// ReportFileChange is a changed file in the report.
+type ReportFileChange struct {
+	Path      string `json:"path"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary"`
+}
+
+// ReportCommit is the Commit of the changes in the report.
+type ReportCommit struct {
+	SHA     string `json:"sha"`
+	Branch  string `json:"branch"`
+	Message string `json:"message"`
+	Pushed  bool   `json:"pushed"`
+}
+
+// ReportStep is a step of a multi-step run in the report.
+type ReportStep struct {
+	Name            string `json:"name"`
+	Prompt          string `json:"prompt"`
+	ContinueOnError bool   `json:"continue_on_error"`
+	Skipped         bool   `json:"skipped"`
+	ReportExecution
+}
+
+// ReportModel is a model of a model matrix run in the report.
+type ReportModel struct {
+	Model string `json:"model"`
+	ReportExecution
+}
+
+// NewReport builds the report of a run from its redacted config and result.
+func NewReport(cfg Config, result *Result) *Report {
+	report := &Report{
+		Version:         ReportVersion,
+		IFlowVersion:    result.IFlowVersion,
+		Config:          cfg,
+		ReportExecution: newReportExecution(&result.Execution),
+		LogFile:         result.LogFile,
+		TranscriptFile:  result.TranscriptFile,
+		PreCommands:     make([]ReportPreCommand, 0, len(result.PreCommands)),
+		JSONErrors:      result.JSONErrors,
+		CommitError:     result.CommitError,
+	}
+	if result.JSON != "" {
+		report.JSON = json.RawMessage(result.JSON)
+	}
+	if result.Changes != nil {
+		report.Changes = &ReportChanges{
+			PatchFile: result.Changes.PatchFile,
+			Files:     make([]ReportFileChange, 0, len(result.Changes.Files)),
+		}
+		for _, file := range result.Changes.Files {
+			report.Changes.Files = append(report.Changes.Files, ReportFileChange(file))
+		}
+	}
+	if result.Commit != nil {
+		commit := ReportCommit(*result.Commit)
+		report.Commit = &commit
+	}
+	for _, pre := range result.PreCommands {
+		report.PreCommands = append(report.PreCommands, ReportPreCommand{
+			Command:         pre.Command,
+			ExitCode:        pre.ExitCode,
+			DurationSeconds: seconds(pre.Duration),
+		})
+	}
+	for i := range result.Steps {
+		step := &result.Steps[i]
+		execution := newReportExecution(&step.Execution)
+		execution.Outcome = step.Outcome()
+		report.Steps = append(report.Steps, ReportStep{
+			Name:            step.Name,
+			Prompt:          step.Prompt,
+			ContinueOnError: step.ContinueOnError,
+			Skipped:         step.Skipped,
+			ReportExecution: execution,
+		})
+	}
+	for i := range result.Models {
+		model := &result.Models[i]
+		report.Models = append(report.Models, ReportModel{
+			Model:           model.Model,
+			ReportExecution: newReportExecution(&model.Execution),
+		})
+	}
+	return report
+}
+
+func newReportExecution(e *Execution) ReportExecution {
+	execution := ReportExecution{
+		Outcome:         e.Outcome(),
+		ExitCode:        e.ExitCode,
+		TimedOut:        e.TimedOut,
+		IdleTimedOut:    e.IdleTimedOut,
+		InvalidJSON:     e.InvalidJSON,
+		Cancelled:       e.Cancelled,
+		StartTime:       e.StartTime,
+		EndTime:         e.EndTime,
+		DurationSeconds: seconds(e.Duration()),
+		Attempts:        make([]ReportAttempt, 0, len(e.Attempts)),
+		Output:          e.Output,
+		Stderr:          e.Stderr,
+		OutputFile:      e.OutputFile,
+		OutputSize:      e.OutputSize,
+		Truncated:       e.Truncated,
+		Usage: ReportUsage{
+			PeakMemoryBytes:  e.Usage.PeakMemory,
+			CPUUserSeconds:   seconds(e.Usage.UserCPU),
+			CPUSystemSeconds: seconds(e.Usage.SystemCPU),
+		},
+	}
+	for _, attempt := range e.Attempts {
+		execution.Attempts = append(execution.Attempts, ReportAttempt{
+			Number:          attempt.Number,
+			ExitCode:        attempt.ExitCode,
+			DurationSeconds: seconds(attempt.Duration),
+			TimedOut:        attempt.TimedOut,
+			IdleTimedOut:    attempt.IdleTimedOut,
+		})
+	}
+	return execution
+}
+
+// Result rebuilds the result the report was written from, e.g. to render
+// the step summary again with GenerateSummaryMarkdown.
+func (r *Report) Result() *Result {
+	result := &Result{
+		Execution:      r.ReportExecution.execution(),
+		IFlowVersion:   r.IFlowVersion,
+		LogFile:        r.LogFile,
+		TranscriptFile: r.TranscriptFile,
+		JSONErrors:     r.JSONErrors,
+	}
+	if len(r.JSON) > 0 {
+		var compact bytes.Buffer
+		if err := json.Compact(&compact, r.JSON); err == nil {
+			result.JSON = compact.String()
+		}
+	}
+	if r.Changes != nil {
+		result.Changes = &Changes{PatchFile: r.Changes.PatchFile}
+		for _, file := range r.Changes.Files {
+			result.Changes.Files = append(result.Changes.Files, FileChange(file))
+		}
+	}
+	if r.Commit != nil {
+		commit := Commit(*r.Commit)
+		result.Commit = &commit
+	}
+	result.CommitError = r.CommitError
+	for _, pre := range r.PreCommands {
+		result.PreCommands = append(result.PreCommands, PreCommandResult{
+			Command:  pre.Command,
+			ExitCode: pre.ExitCode,
+			Duration: duration(pre.DurationSeconds),
+		})
+	}
+	for _, step := range r.Steps {
+		result.Steps = append(result.Steps, StepResult{
+			Execution:       step.ReportExecution.execution(),
+			Name:            step.Name,
+			Prompt:          step.Prompt,
+			ContinueOnError: step.ContinueOnError,
+			Skipped:         step.Skipped,
+		})
+	}
+	for _, model := range r.Models {
+		result.Models = append(result.Models, ModelResult{
+			Execution: model.ReportExecution.execution(),
+			Model:     model.Model,
+		})
+	}
+	return result
+}
+
+func (e ReportExecution) execution() Execution {
+	execution := Execution{
+		Output:       e.Output,
+		OutputFile:   e.OutputFile,
+		OutputSize:   e.OutputSize,
+		Truncated:    e.Truncated,
+		Stderr:       e.Stderr,
+		ExitCode:     e.ExitCode,
+		TimedOut:     e.TimedOut,
+		IdleTimedOut: e.IdleTimedOut,
+		InvalidJSON:  e.InvalidJSON,
+		Cancelled:    e.Cancelled,
+		StartTime:    e.StartTime,
+		EndTime:      e.EndTime,
+		Usage: ResourceUsage{
+			PeakMemory: e.Usage.PeakMemoryBytes,
+			UserCPU:    duration(e.Usage.CPUUserSeconds),
+			SystemCPU:  duration(e.Usage.CPUSystemSeconds),
+		},
+	}
+	for _, attempt := range e.Attempts {
+		execution.Attempts = append(execution.Attempts, Attempt{
+			Number:       attempt.Number,
+			ExitCode:     attempt.ExitCode,
+			Duration:     duration(attempt.DurationSeconds),
+			TimedOut:     attempt.TimedOut,
+			IdleTimedOut: attempt.IdleTimedOut,
+		})
+	}
+	return execution
+}
+
+// WriteReport writes the report of a run to path, creating its directory.
+func WriteReport(path string, cfg Config, result *Result) error {
+	data, err := json.MarshalIndent(NewReport(cfg, result), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format report: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create report directory: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// ReadReport reads a report written by WriteReport. Reports of a newer
+// format version are rejected.
+func ReadReport(path string) (*Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report: %w", err)
+	}
+
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return nil, fmt.Errorf("failed to parse report %s: %w", path, err)
+	}
+	if report.Version < 1 || report.Version > ReportVersion {
+		return nil, fmt.Errorf("report %s has version %d, only versions 1 to %d are supported", path, report.Version, ReportVersion)
+	}
+	return &report, nil
+}
+
+// seconds converts d to fractional seconds, rounded to milliseconds.
+func seconds(d time.Duration) float64 {
+	return d.Round(time.Millisecond).Seconds()
+}
+
+// duration converts fractional seconds back to a Duration.
+func duration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Millisecond)
+}
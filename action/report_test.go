@@ -0,0 +1,135 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReportRoundTrip(t *testing.T) {
+	start := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review"
+	cfg.Retries = 1
+	cfg.Steps = []Step{{Name: "analyze", Prompt: "Analyze"}, {Name: "fix", Prompt: "Fix"}}
+
+	result := &Result{
+		Execution: Execution{
+			Output:    "fixed",
+			ExitCode:  2,
+			StartTime: start,
+			EndTime:   start.Add(90 * time.Second),
+			Attempts: []Attempt{
+				{Number: 1, ExitCode: 1, Duration: 30 * time.Second},
+				{Number: 2, ExitCode: 2, Duration: 1500 * time.Millisecond},
+			},
+			Usage: ResourceUsage{PeakMemory: 300 * 1024 * 1024, UserCPU: 4 * time.Second, SystemCPU: 250 * time.Millisecond},
+		},
+		IFlowVersion: "0.2.0",
+		LogFile:      "/tmp/iflow.log",
+		PreCommands:  []PreCommandResult{{Command: "npm ci", Duration: 12 * time.Second}},
+		Steps: []StepResult{
+			{Name: "analyze", Prompt: "Analyze", Execution: Execution{Output: "plan", StartTime: start, EndTime: start.Add(time.Minute)}},
+			{Name: "fix", Prompt: "Fix", Execution: Execution{Output: "fixed", ExitCode: 2, StartTime: start.Add(time.Minute), EndTime: start.Add(90 * time.Second)}},
+		},
+	}
+
+	path := filepath.Join(t.TempDir(), "reports", "run.json")
+	if err := WriteReport(path, cfg, result); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	report, err := ReadReport(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if report.Version != ReportVersion || report.Outcome != OutcomeFailure || report.DurationSeconds != 90 {
+		t.Errorf("Unexpected report %+v", report)
+	}
+	if len(report.PreCommands) != 1 || report.PreCommands[0].DurationSeconds != 12 {
+		t.Errorf("Expected the pre-command in the report, got %+v", report.PreCommands)
+	}
+
+	expected := GenerateSummaryMarkdown(cfg, result)
+	if got := GenerateSummaryMarkdown(report.Config, report.Result()); got != expected {
+		t.Errorf("Expected the summary to render the same from the report.\nExpected:\n%s\nGot:\n%s", expected, got)
+	}
+}
+
+func TestReadReportVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		err     string
+	}{
+		{name: "Newer version", content: `{"version": 99}`, err: "has version 99"},
+		{name: "Not a report", content: `{}`, err: "has version 0"},
+		{name: "Invalid JSON", content: `{`, err: "failed to parse report"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "report.json")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, err := ReadReport(path); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("Expected error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+}
+
+func TestRunnerRunReport(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	sink := &recordingSink{}
+	runner := &Runner{
+		Executor: &fakeExecutor{output: "done with sk-secret-value"},
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Sinks:    []Sink{sink},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-secret-value"
+	cfg.IsolatedHome = true
+	cfg.PreCmd = "echo sk-secret-value"
+	cfg.ReportFile = filepath.Join(t.TempDir(), "report.json")
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.ReportFile != cfg.ReportFile || sink.result.ReportFile != cfg.ReportFile {
+		t.Errorf("Expected the report file in the result, got %q", result.ReportFile)
+	}
+
+	data, err := os.ReadFile(cfg.ReportFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(string(data), "sk-secret-value") {
+		t.Errorf("Expected secrets to be redacted from the report, got:\n%s", data)
+	}
+
+	var report map[string]interface{}
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, key := range []string{"version", "iflow_version", "config", "start_time", "end_time", "duration_seconds", "exit_code", "attempts", "pre_commands", "output_file", "log_file"} {
+		if _, ok := report[key]; !ok {
+			t.Errorf("Expected %s in the report", key)
+		}
+	}
+	if report["pre_commands"].([]interface{})[0].(map[string]interface{})["command"] != "echo ***" {
+		t.Errorf("Expected the redacted pre-command, got %v", report["pre_commands"])
+	}
+}
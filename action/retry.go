@@ -0,0 +1,126 @@
+package action
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"regexp"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// maxRetries caps the retries input so a misconfiguration cannot spin for hours.
+const maxRetries = 10
+
+// Attempt records one invocation of iflow.
+type Attempt struct {
+	Number       int           // 1-based attempt number
+	ExitCode     int           // Exit code of this attempt
+	Duration     time.Duration // How long this attempt ran
+	TimedOut     bool          // The attempt was stopped by the overall timeout
+	IdleTimedOut bool          // The attempt was stopped because it produced no output within the idle timeout
+}
+
+// retryPolicy decides whether a failed attempt is retried. Entries of
+// retry_on that are integers match exit codes; all others are regular
+// expressions matched against the attempt's output. With no entries every
+// non-zero exit code is retried.
+type retryPolicy struct {
+	exitCodes map[int]bool
+	patterns  []*regexp.Regexp
+}
+
+// newRetryPolicy parses the retry_on entries.
+func newRetryPolicy(retryOn []string) (*retryPolicy, error) {
+	p := &retryPolicy{exitCodes: make(map[int]bool)}
+	for _, entry := range retryOn {
+		if code, err := strconv.Atoi(entry); err == nil {
+			p.exitCodes[code] = true
+			continue
+		}
+		re, err := regexp.Compile(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retry_on pattern %q: %w", entry, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+	return p, nil
+}
+
+// shouldRetry reports whether an attempt that exited with exitCode should be
+// retried. matched reports whether its output matched a pattern.
+func (p *retryPolicy) shouldRetry(exitCode int, matched bool) bool {
+	if exitCode == 0 {
+		return false
+	}
+	if len(p.exitCodes) == 0 && len(p.patterns) == 0 {
+		return true
+	}
+	if p.exitCodes[exitCode] {
+		return true
+	}
+	return matched
+}
+
+// outputMatch scans the streams of one attempt line by line for the retry_on
+// patterns as they are written, so a match in the middle of output too large
+// to keep in memory still counts. Patterns spanning several lines are not
+// matched.
+type outputMatch struct {
+	patterns []*regexp.Regexp
+	clean    func(string) string
+	streams  []*lineRedactor
+	matched  atomic.Bool
+}
+
+// newMatch returns an outputMatch for one attempt; clean is applied to every
+// line before it is matched.
+func (p *retryPolicy) newMatch(clean func(string) string) *outputMatch {
+	return &outputMatch{patterns: p.patterns, clean: clean}
+}
+
+// stream returns a writer for one stream of the attempt.
+func (m *outputMatch) stream() io.Writer {
+	if len(m.patterns) == 0 {
+		return io.Discard
+	}
+	l := &lineRedactor{w: m, clean: m.clean}
+	m.streams = append(m.streams, l)
+	return l
+}
+
+// Write matches one cleaned line, without its line ending.
+func (m *outputMatch) Write(line []byte) (int, error) {
+	if !m.matched.Load() {
+		trimmed := bytes.TrimRight(line, "\r\n")
+		for _, re := range m.patterns {
+			if re.Match(trimmed) {
+				m.matched.Store(true)
+				break
+			}
+		}
+	}
+	return len(line), nil
+}
+
+// Matched reports whether a line of any stream matched, including an
+// unterminated last line.
+func (m *outputMatch) Matched() bool {
+	for _, l := range m.streams {
+		l.flush()
+	}
+	return m.matched.Load()
+}
+
+// retryDelay returns the exponential backoff before the retry following
+// attempt, with equal jitter: half the delay is fixed, the other half random.
+func retryDelay(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	delay := base << (attempt - 1)
+	half := delay / 2
+	return half + rand.N(half+1)
+}
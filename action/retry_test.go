@@ -0,0 +1,125 @@
+package action
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		retryOn  []string
+		exitCode int
+		output   string
+		expected bool
+	}{
+		{name: "Success is never retried", retryOn: nil, exitCode: 0, expected: false},
+		{name: "Any failure without retry_on", retryOn: nil, exitCode: 1, expected: true},
+		{name: "Matching exit code", retryOn: []string{"2", "3"}, exitCode: 3, expected: true},
+		{name: "Other exit code", retryOn: []string{"2"}, exitCode: 1, expected: false},
+		{name: "Matching output", retryOn: []string{"API Error", `\b429\b`}, exitCode: 1, output: "HTTP 429 Too Many Requests", expected: true},
+		{name: "Other output", retryOn: []string{"API Error"}, exitCode: 1, output: "syntax error", expected: false},
+		{name: "Matching line", retryOn: []string{`^API Error$`}, exitCode: 1, output: "Retrying\nAPI Error\nGiving up", expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := newRetryPolicy(tt.retryOn)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			match := policy.newMatch(func(line string) string { return line })
+			io.WriteString(match.stream(), tt.output)
+			if got := policy.shouldRetry(tt.exitCode, match.Matched()); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+
+	if _, err := newRetryPolicy([]string{"("}); err == nil {
+		t.Errorf("Expected error for invalid pattern")
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	base := 4 * time.Second
+	for attempt := 1; attempt <= 4; attempt++ {
+		full := base << (attempt - 1)
+		for i := 0; i < 20; i++ {
+			delay := retryDelay(base, attempt)
+			if delay < full/2 || delay > full {
+				t.Fatalf("Attempt %d: delay %s outside [%s, %s]", attempt, delay, full/2, full)
+			}
+		}
+	}
+
+	if delay := retryDelay(0, 3); delay != 0 {
+		t.Errorf("Expected no delay without backoff, got %s", delay)
+	}
+}
+
+func TestRunnerRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		retries      int
+		retryOn      []string
+		output       string
+		exitCodes    []int
+		expectedExit int
+		attempts     int
+	}{
+		{name: "Succeeds after retries", retries: 3, exitCodes: []int{1, 1, 0}, expectedExit: 0, attempts: 3},
+		{name: "Gives up after retries", retries: 2, exitCodes: []int{1, 1, 1, 0}, expectedExit: 1, attempts: 3},
+		{name: "Non-retryable failure", retries: 2, retryOn: []string{"42"}, exitCodes: []int{1, 0}, expectedExit: 1, attempts: 1},
+		{name: "No retries", retries: 0, exitCodes: []int{1, 0}, expectedExit: 1, attempts: 1},
+		{
+			name:         "Pattern beyond the captured output",
+			retries:      1,
+			retryOn:      []string{"API Error"},
+			output:       strings.Repeat("x", 4096) + "\nAPI Error: 429\n" + strings.Repeat("y", 4096),
+			exitCodes:    []int{1, 0},
+			expectedExit: 0,
+			attempts:     2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := &Runner{
+				Executor: &fakeExecutor{output: tt.output, exitCodes: tt.exitCodes},
+				Logger:   ConsoleLogger{Out: io.Discard},
+				Stdout:   io.Discard,
+				Stderr:   io.Discard,
+			}
+
+			cfg := DefaultConfig()
+			cfg.Prompt = "Review the code"
+			cfg.APIKey = "sk-test"
+			cfg.IsolatedHome = true
+			cfg.Retries = tt.retries
+			cfg.RetryBackoff = 0
+			cfg.RetryOn = tt.retryOn
+			cfg.MaxOutputSize = 1024
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.ExitCode != tt.expectedExit {
+				t.Errorf("Expected exit code %d, got %d", tt.expectedExit, result.ExitCode)
+			}
+			if len(result.Attempts) != tt.attempts {
+				t.Fatalf("Expected %d attempts, got %d", tt.attempts, len(result.Attempts))
+			}
+			for i, attempt := range result.Attempts {
+				if attempt.Number != i+1 || attempt.ExitCode != tt.exitCodes[i] {
+					t.Errorf("Unexpected attempt %d: %+v", i+1, attempt)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,740 @@
+package action
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Exit codes reported when iFlow is stopped before it finishes.
+const (
+	ExitCodeTimeout     = 124 // The timeout elapsed
+	ExitCodeIdleTimeout = 125 // No output arrived within the idle timeout
+	ExitCodeCancelled   = 130 // The run was cancelled, e.g. the workflow was cancelled
+)
+
+// Execution describes the outcome of sending a prompt to iflow.
+type Execution struct {
+	Output       string        // Stdout of the last attempt, with secrets redacted and the middle omitted beyond max_output_size
+	OutputFile   string        // File with the complete, redacted stdout of the last attempt, if output files are written
+	OutputSize   int64         // Size in bytes of the complete stdout of the last attempt
+	Truncated    bool          // Output omits part of the complete stdout
+	Stderr       string        // Stderr of the last attempt, redacted and bounded like Output
+	ExitCode     int           // Exit code of the last iflow attempt
+	TimedOut     bool          // Execution was stopped because the timeout elapsed
+	IdleTimedOut bool          // The last attempt was stopped because it produced no output within the idle timeout
+	Cancelled    bool          // Execution was stopped because its context was cancelled
+	StartTime    time.Time     // When the first attempt was started
+	EndTime      time.Time     // When the last attempt exited
+	Attempts     []Attempt     // Every invocation of iflow, including retries
+	Usage        ResourceUsage // Resources used by every attempt together
+	InvalidJSON  bool          // iflow succeeded, but its output holds no JSON matching output_schema
+}
+
+// Duration returns how long iflow ran.
+func (e *Execution) Duration() time.Duration {
+	return e.EndTime.Sub(e.StartTime)
+}
+
+// Execution outcomes, as shown in the step summary and the steps and models
+// outputs.
+const (
+	OutcomeSuccess     = "success"
+	OutcomeFailure     = "failure"
+	OutcomeTimeout     = "timeout"
+	OutcomeIdleTimeout = "idle_timeout"
+	OutcomeInvalidJSON = "invalid_json"
+	OutcomeCancelled   = "cancelled"
+	OutcomeSkipped     = "skipped"
+)
+
+// Outcome summarizes the execution as one of the Outcome* constants.
+func (e *Execution) Outcome() string {
+	switch {
+	case e.Cancelled:
+		return OutcomeCancelled
+	case e.TimedOut:
+		return OutcomeTimeout
+	case e.IdleTimedOut:
+		return OutcomeIdleTimeout
+	case e.InvalidJSON:
+		return OutcomeInvalidJSON
+	case e.ExitCode != 0:
+		return OutcomeFailure
+	default:
+		return OutcomeSuccess
+	}
+}
+
+// Result describes a completed iFlow run. For a multi-step run the embedded
+// Execution holds the overall outcome: the output of the last step that ran
+// and the exit code of the step that stopped the pipeline, if any. For a
+// model matrix it holds the output of every model and the exit code of the
+// first model that failed.
+type Result struct {
+	Execution
+	IFlowVersion   string             // Output of iflow --version, if available
+	OutputDir      string             // Directory holding the output files; kept after Run, so callers outside GitHub Actions remove it
+	LogFile        string             // File with the complete, redacted output of every iflow invocation
+	TranscriptFile string             // File with timestamped stdout and stderr lines, if a transcript was requested
+	ReportFile     string             // File with the JSON run report, if one was requested
+	Changes        *Changes           // Files changed while iflow ran; nil unless detected
+	Commit         *Commit            // Commit of the changes; nil unless committed
+	CommitError    string             // Why the changes could not be committed or pushed; the exit code is then ExitCodeCommitFailed
+	PreCommands    []PreCommandResult // Pre-commands that ran, in order
+	JSON           string             // Compact JSON extracted from the output and matching output_schema
+	JSONErrors     []string           // Why the output did not match output_schema
+	Steps          []StepResult       // Outcome of each step of a multi-step run
+	Models         []ModelResult      // Outcome of each model of a model matrix run
+}
+
+// Sink receives the outcome of a run, e.g. to set GitHub Actions outputs or
+// write the step summary. The config passed to Publish is already redacted.
+type Sink interface {
+	Publish(cfg Config, result *Result) error
+}
+
+// Logger receives progress messages and secrets that the log backend should
+// hide.
+type Logger interface {
+	Info(message string)
+	Mask(value string)
+}
+
+// Runner runs iFlow CLI invocations. A Runner holds no per-run state, so one
+// Runner can execute several configs, including concurrently. Concurrent runs
+// that use ~/.iflow of the user's home directory, without IsolatedHome or
+// Models, take turns; separate processes on one machine, such as jobs sharing
+// a self-hosted runner, need IsolatedHome.
+type Runner struct {
+	Executor Executor  // Starts pre-commands and iflow
+	Logger   Logger    // Receives progress messages
+	Sinks    []Sink    // Receive the result after each run
+	Stdout   io.Writer // Live output from pre-commands and iflow
+	Stderr   io.Writer
+	Stdin    io.Reader // Passed to pre-commands
+}
+
+// NewRunner returns a Runner that executes commands with os/exec, streams
+// output to the process's stdout and stderr and logs to the console.
+func NewRunner() *Runner {
+	return &Runner{
+		Executor: ExecExecutor{},
+		Logger:   ConsoleLogger{Out: os.Stdout},
+		Stdout:   os.Stdout,
+		Stderr:   os.Stderr,
+		Stdin:    os.Stdin,
+	}
+}
+
+// run holds the state of a single Run call.
+type run struct {
+	runner     *Runner
+	cfg        Config
+	redactor   *Redactor
+	homeDir    string
+	outputDir  string      // Directory for the complete output of each invocation
+	log        io.Writer   // Receives the complete output of every invocation
+	transcript *transcript // Receives timestamped lines of every invocation; nil unless requested
+	hasher     *treeHasher // Hashes the working tree to detect changes; nil unless detecting
+	treeBefore string      // Hash of the working tree before iflow ran
+	workspace  string      // Throwaway copy of the working directory iflow runs in; empty unless in patch mode
+	// The changes are committed to commitBranch of the repository at
+	// commitTop when commitBranch is set
+	commitTop    string
+	commitBranch string
+	commitData   PromptData
+	cleanups     []func()
+}
+
+// Run resolves and validates cfg, configures iFlow, runs the pre-commands and
+// iflow, and publishes the result to the sinks. A non-zero exit code, a
+// timeout or a cancellation of ctx once commands are running is reported in
+// the Result, not as an error, and the output captured so far is published;
+// errors mean the run could not be carried out. Any changes to the machine
+// are undone before Run returns.
+func (rn *Runner) Run(ctx context.Context, cfg Config) (*Result, error) {
+	r := &run{runner: rn, cfg: cfg, redactor: &Redactor{}}
+	defer r.cleanup()
+
+	result := &Result{IFlowVersion: r.iflowVersion(ctx)}
+
+	// Validate configuration before any settings are written
+	if err := r.cfg.Resolve(); err != nil {
+		return nil, err
+	}
+
+	// Mask secrets before anything else is logged
+	redactor, err := NewConfigRedactor(&r.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up secret masking: %w", err)
+	}
+	r.redactor = redactor
+	for _, value := range redactor.Values() {
+		rn.Logger.Mask(value)
+	}
+
+	// Give this run its own home directory if requested
+	if r.cfg.IsolatedHome {
+		if err := r.setupIsolatedHome(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Configure iFlow settings, once per model for a model matrix
+	r.info("Configuring iFlow settings...")
+	var homes []string
+	if len(r.cfg.Models) > 0 {
+		homes, err = r.setupModelHomes()
+	} else {
+		if r.homeDir == "" {
+			if err := r.lockSharedHome(ctx); err != nil {
+				return nil, err
+			}
+		}
+		err = r.configureIFlow()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to configure iFlow: %w", err)
+	}
+
+	// Spill the complete output to files so memory use stays bounded
+	if err := r.setupOutputFiles(); err != nil {
+		return nil, err
+	}
+	result.OutputDir = r.outputDir
+	result.LogFile = filepath.Join(r.outputDir, "iflow.log")
+	if r.transcript != nil {
+		result.TranscriptFile = filepath.Join(r.outputDir, "transcript.log")
+	}
+
+	var schema interface{}
+	if r.cfg.OutputSchema != "" {
+		if schema, err = parseJSONSchema(r.cfg.OutputSchema); err != nil {
+			return nil, err
+		}
+	}
+
+	// Let iflow edit a throwaway copy of the working directory in patch mode
+	if r.cfg.Mode == ModePatch {
+		if err := r.setupPatchWorkspace(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Check the branch for the changes can be created before doing any work
+	if r.cfg.CommitChanges {
+		if err := r.prepareCommit(); err != nil {
+			return nil, err
+		}
+	}
+
+	// Execute pre-command if specified
+	if r.cfg.PreCmd != "" {
+		r.info(fmt.Sprintf("Executing pre-command: %s", r.cfg.PreCmd))
+		if err := r.executePreCmd(ctx, result); err != nil {
+			if !errors.Is(ctx.Err(), context.Canceled) {
+				return nil, fmt.Errorf("failed to execute pre-command: %w", err)
+			}
+			r.markCancelled(&result.Execution)
+			return r.publish(ctx, result), nil
+		}
+	}
+
+	// Remember the working tree to report the files iflow changes. This is
+	// best effort, unless the patch is all a patch mode run leaves behind
+	if r.cfg.DetectChanges {
+		if err := r.snapshotWorkingTree(); err != nil {
+			if r.cfg.Mode == ModePatch {
+				return nil, fmt.Errorf("failed to snapshot the working directory: %w", err)
+			}
+			r.info(fmt.Sprintf("Warning: change detection is disabled: %v", err))
+		}
+	}
+
+	// Run the prompt against every model, the steps one after another, or
+	// the single prompt
+	if len(r.cfg.Models) > 0 {
+		if err := r.executeModels(ctx, homes, result); err != nil {
+			return nil, fmt.Errorf("failed to execute iFlow CLI: %w", err)
+		}
+		return r.publish(ctx, result), nil
+	}
+
+	if len(r.cfg.Steps) > 0 {
+		if err := r.executeSteps(ctx, result); err != nil {
+			return nil, fmt.Errorf("failed to execute iFlow CLI: %w", err)
+		}
+		if schema != nil && result.ExitCode == 0 && !result.Cancelled && !r.checkJSON(schema, result) {
+			result.InvalidJSON = true
+			result.ExitCode = ExitCodeInvalidJSON
+		}
+		return r.publish(ctx, result), nil
+	}
+
+	if schema != nil {
+		err = r.executeJSONPrompt(ctx, schema, result)
+	} else {
+		err = r.executeIFlow(ctx, r.promptInvocation(), &result.Execution)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute iFlow CLI: %w", err)
+	}
+
+	return r.publish(ctx, result), nil
+}
+
+// publish scrubs secrets from the result and hands it to the sinks.
+func (r *run) publish(ctx context.Context, result *Result) *Result {
+	if r.hasher != nil {
+		r.detectChanges(result)
+	}
+	if r.commitBranch != "" && result.Changes != nil && result.ExitCode == 0 && !result.Cancelled {
+		r.commitChanges(ctx, result)
+	}
+
+	// Report the output files where later workflow steps can read them
+	result.OutputDir = hostPath(result.OutputDir)
+	result.OutputFile = hostPath(result.OutputFile)
+	result.LogFile = hostPath(result.LogFile)
+	result.TranscriptFile = hostPath(result.TranscriptFile)
+	if result.Changes != nil {
+		result.Changes.PatchFile = hostPath(result.Changes.PatchFile)
+	}
+	for i := range result.Steps {
+		result.Steps[i].OutputFile = hostPath(result.Steps[i].OutputFile)
+	}
+	for i := range result.Models {
+		result.Models[i].OutputFile = hostPath(result.Models[i].OutputFile)
+	}
+
+	// Scrub secrets from the captured output before it is published
+	result.Output = r.redactor.Redact(result.Output)
+	result.Stderr = r.redactor.Redact(result.Stderr)
+	result.JSON = r.redactor.Redact(result.JSON)
+	if result.Commit != nil {
+		result.Commit.Message = r.redactor.Redact(result.Commit.Message)
+	}
+	for i := range result.JSONErrors {
+		result.JSONErrors[i] = r.redactor.Redact(result.JSONErrors[i])
+	}
+	for i := range result.Steps {
+		result.Steps[i].Prompt = r.redactor.Redact(result.Steps[i].Prompt)
+		result.Steps[i].Output = r.redactor.Redact(result.Steps[i].Output)
+		result.Steps[i].Stderr = r.redactor.Redact(result.Steps[i].Stderr)
+	}
+	for i := range result.Models {
+		result.Models[i].Output = r.redactor.Redact(result.Models[i].Output)
+		result.Models[i].Stderr = r.redactor.Redact(result.Models[i].Stderr)
+	}
+
+	published := r.cfg.Redacted(r.redactor)
+	if r.cfg.ReportFile != "" {
+		if err := WriteReport(r.cfg.ReportFile, published, result); err != nil {
+			r.info(fmt.Sprintf("Warning: failed to write run report: %v", err))
+		} else {
+			result.ReportFile = r.cfg.ReportFile
+			r.info(fmt.Sprintf("Wrote the run report to %s", r.cfg.ReportFile))
+		}
+	}
+	for _, sink := range r.runner.Sinks {
+		if err := sink.Publish(published, result); err != nil {
+			r.info(fmt.Sprintf("Failed to publish result: %v", err))
+		}
+	}
+
+	return result
+}
+
+// markCancelled records that the run was cancelled.
+func (r *run) markCancelled(result *Execution) {
+	result.Cancelled = true
+	result.ExitCode = ExitCodeCancelled
+	r.info("Execution was cancelled, publishing the output captured so far")
+}
+
+// info logs a message with secrets redacted.
+func (r *run) info(message string) {
+	r.runner.Logger.Info(r.redactor.Redact(message))
+}
+
+// addCleanup schedules fn to run when Run returns. Cleanups run in reverse
+// registration order.
+func (r *run) addCleanup(fn func()) {
+	r.cleanups = append(r.cleanups, fn)
+}
+
+func (r *run) cleanup() {
+	for i := len(r.cleanups) - 1; i >= 0; i-- {
+		r.cleanups[i]()
+	}
+	r.cleanups = nil
+}
+
+// iflowVersion runs iflow --version and logs the result.
+func (r *run) iflowVersion(ctx context.Context) string {
+	var output bytes.Buffer
+	exitCode, err := r.runner.Executor.Run(ctx, Command{
+		Name:   "iflow",
+		Args:   []string{"--version"},
+		Stdout: &output,
+		Stderr: &output,
+	})
+	if err == nil && exitCode != 0 {
+		err = fmt.Errorf("exit status %d", exitCode)
+	}
+	if err != nil {
+		r.info(fmt.Sprintf("Warning: Failed to get iFlow version: %v", err))
+		return ""
+	}
+
+	version := strings.TrimSpace(output.String())
+	r.info(fmt.Sprintf("iFlow CLI version: %s", version))
+	return version
+}
+
+func (r *run) configureIFlow() error {
+	homeDir, err := r.iflowHomeDir()
+	if err != nil {
+		return fmt.Errorf("failed to get home directory: %w", err)
+	}
+
+	iflowDir := filepath.Join(homeDir, ".iflow")
+	settingsFile := filepath.Join(iflowDir, "settings.json")
+
+	// Back up existing settings so they can be restored on exit
+	var backup *settingsBackup
+	if r.cfg.RestoreSettings && !r.cfg.IsolatedHome {
+		backup, err = backupSettings(iflowDir, r.info)
+		if err != nil {
+			return err
+		}
+		r.addCleanup(func() {
+			if err := backup.restore(); err != nil {
+				r.info(fmt.Sprintf("Warning: failed to restore iFlow settings: %v", err))
+				return
+			}
+			r.info("Restored original iFlow settings")
+		})
+	}
+
+	if err := os.MkdirAll(iflowDir, 0755); err != nil {
+		return fmt.Errorf("failed to create .iflow directory: %w", err)
+	}
+
+	r.info(settingsSource(&r.cfg))
+	settings, err := buildSettings(&r.cfg)
+	if err != nil {
+		return err
+	}
+
+	// Layer the new settings on top of the ones already on the machine
+	if r.cfg.MergeExistingSettings {
+		var existing map[string]interface{}
+		if backup != nil {
+			existing, err = backup.existingSettings()
+		} else {
+			existing, err = readExistingSettings(settingsFile)
+		}
+		if err != nil {
+			return err
+		}
+		if existing != nil {
+			r.info("Merging with existing iFlow settings")
+			settings = deepMerge(existing, settings)
+		}
+	}
+
+	return r.writeSettings(settingsFile, settings)
+}
+
+// writeSettings writes settings to settingsFile, printing them first when
+// print_settings is set.
+func (r *run) writeSettings(settingsFile string, settings map[string]interface{}) error {
+	if r.cfg.PrintSettings {
+		redacted, err := json.MarshalIndent(redactSettings(settings), "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format redacted settings: %w", err)
+		}
+		r.info("Effective iFlow settings (redacted):")
+		fmt.Fprintln(r.runner.Stdout, r.redactor.Redact(string(redacted)))
+	}
+
+	settingsData, err := json.MarshalIndent(settings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to format settings JSON: %w", err)
+	}
+
+	if err := os.WriteFile(settingsFile, settingsData, 0644); err != nil {
+		return fmt.Errorf("failed to write settings file: %w", err)
+	}
+
+	r.info(fmt.Sprintf("iFlow settings configured at %s", settingsFile))
+	return nil
+}
+
+// PreCommandResult describes one line of precmd that ran.
+type PreCommandResult struct {
+	Command  string // With secrets redacted
+	ExitCode int
+	Duration time.Duration
+}
+
+func (r *run) executePreCmd(ctx context.Context, result *Result) error {
+	// Split the precmd into lines and execute each line
+	commands := strings.Split(r.cfg.PreCmd, "\n")
+
+	for _, command := range commands {
+		// Skip empty lines
+		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+
+		r.info(fmt.Sprintf("Executing pre-command: %s", command))
+
+		// Execute the command and wait for it to complete, with the same
+		// home directory as iflow so it can set up ~/.iflow. Services it
+		// starts in the background keep running for iflow
+		start := time.Now()
+		exitCode, err := r.runner.Executor.Run(ctx, Command{
+			Name:           "sh",
+			Args:           []string{"-c", command},
+			Dir:            r.workingDir(),
+			Env:            r.iflowEnv(r.homeDir),
+			Stdin:          r.runner.Stdin,
+			Stdout:         r.runner.Stdout,
+			Stderr:         r.runner.Stderr,
+			GracePeriod:    r.gracePeriod(),
+			KeepBackground: true,
+		})
+		if err != nil {
+			return fmt.Errorf("pre-command failed: %w", err)
+		}
+		result.PreCommands = append(result.PreCommands, PreCommandResult{
+			Command:  r.redactor.Redact(command),
+			ExitCode: exitCode,
+			Duration: time.Since(start),
+		})
+		if exitCode != 0 {
+			return fmt.Errorf("pre-command failed: exit status %d", exitCode)
+		}
+	}
+
+	return nil
+}
+
+// invocation is one prompt sent to iflow, with its per-invocation overrides.
+type invocation struct {
+	prompt    string
+	model     string // Passed with --model when set, overriding the settings
+	dir       string // Directory iflow runs in; empty runs it in the working directory
+	timeout   int    // Seconds for all attempts, including backoff delays
+	extraArgs string
+	env       []string  // Environment of the iflow process; nil inherits ours
+	stdout    io.Writer // Live output of iflow
+	stderr    io.Writer
+	log       io.Writer // Receives the complete output, redacted; may be nil
+	name      string    // Tags transcript lines, e.g. the step or model
+}
+
+// promptInvocation returns the invocation for the configured single prompt.
+func (r *run) promptInvocation() invocation {
+	return invocation{
+		prompt:    r.cfg.Prompt,
+		timeout:   r.cfg.Timeout,
+		extraArgs: r.cfg.ExtraArgs,
+		env:       r.iflowEnv(r.homeDir),
+		stdout:    r.runner.Stdout,
+		stderr:    r.runner.Stderr,
+		log:       r.log,
+	}
+}
+
+func (r *run) executeIFlow(ctx context.Context, inv invocation, result *Execution) error {
+	// Execute iFlow CLI command with --prompt and --yolo flags
+	r.info(fmt.Sprintf("Executing iFlow CLI prompt with --prompt and --yolo: %s", inv.prompt))
+	r.info(fmt.Sprintf("Command timeout set to: %d seconds", inv.timeout))
+
+	// The timeout is the budget for all attempts, including backoff delays
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(inv.timeout)*time.Second)
+	defer cancel()
+
+	dir := inv.dir
+	if dir == "" {
+		dir = r.workingDir()
+	}
+
+	// Prepare the command with --prompt and --yolo flags by default
+	// Use --prompt and --yolo flags for all commands
+	args := []string{"--yolo", "--prompt", inv.prompt}
+
+	if inv.model != "" {
+		args = append(args, "--model", inv.model)
+	}
+
+	// Parse and add extra arguments if provided
+	if inv.extraArgs != "" {
+		extraArgs := parseExtraArgs(inv.extraArgs)
+		args = append(args, extraArgs...)
+		r.info(fmt.Sprintf("Using additional arguments: %v", extraArgs))
+	}
+
+	policy, err := newRetryPolicy(r.cfg.RetryOn)
+	if err != nil {
+		return err
+	}
+
+	if limits := r.cfg.resourceLimits(); limits.Enabled() {
+		r.info(fmt.Sprintf("Limiting iFlow CLI to %s", limits))
+	}
+
+	outputPath, err := r.newOutputPath("output-*.log")
+	if err != nil {
+		return err
+	}
+
+	result.StartTime = time.Now()
+	defer func() { result.EndTime = time.Now() }()
+
+	for number := 1; ; number++ {
+		if number > 1 {
+			r.info(fmt.Sprintf("Retrying iFlow CLI (attempt %d of %d)", number, r.cfg.Retries+1))
+		}
+
+		// Capture stdout, the result, separately from stderr
+		output, err := newOutputCapture(r.cfg.MaxOutputSize, outputPath, inv.log, r.cleanLine)
+		if err != nil {
+			return err
+		}
+		stderr, err := newOutputCapture(r.cfg.MaxOutputSize, "", inv.log, r.cleanLine)
+		if err != nil {
+			output.Close()
+			return err
+		}
+		stdoutLines, stderrLines := r.transcriptStreams(inv.name)
+		match := policy.newMatch(r.cleanLine)
+
+		// Stop the attempt when neither stream produces output for too long
+		attemptCtx, activity, stopWatchdog := watchIdle(ctx, time.Duration(r.cfg.IdleTimeout)*time.Second)
+
+		var usage ResourceUsage
+		start := time.Now()
+		exitCode, err := r.runner.Executor.Run(attemptCtx, Command{
+			Name:        "iflow",
+			Args:        args,
+			Dir:         dir,
+			Env:         inv.env,
+			Stdout:      io.MultiWriter(inv.stdout, output, activity, stdoutLines, match.stream()),
+			Stderr:      io.MultiWriter(inv.stderr, stderr, activity, stderrLines, match.stream()),
+			GracePeriod: r.gracePeriod(),
+			PTY:         r.cfg.UsePTY,
+			Limits:      r.cfg.resourceLimits(),
+			Usage:       &usage,
+		})
+		idle := errors.Is(context.Cause(attemptCtx), errIdleTimeout)
+		stopWatchdog()
+		if closeErr := output.Close(); closeErr != nil {
+			r.info(fmt.Sprintf("Warning: failed to write output file: %v", closeErr))
+		}
+		stderr.Close()
+		flushPrefixed(stdoutLines, stderrLines)
+		result.Usage.add(usage)
+		if limit := r.cfg.MaxCPUSeconds; limit > 0 && usage.UserCPU+usage.SystemCPU >= time.Duration(limit)*time.Second {
+			r.info(fmt.Sprintf("iFlow CLI reached the CPU time limit of %d seconds", limit))
+		}
+		attempt := Attempt{Number: number, ExitCode: exitCode, Duration: time.Since(start)}
+		result.Output = output.String()
+		result.Stderr = stderr.String()
+		if r.cfg.StripANSI {
+			result.Output = stripANSI(result.Output)
+			result.Stderr = stripANSI(result.Stderr)
+		}
+		result.OutputFile = output.Path()
+		result.OutputSize = output.Size()
+		result.Truncated = output.Truncated()
+
+		// Check for timeout first
+		if ctx.Err() == context.DeadlineExceeded {
+			attempt.ExitCode = ExitCodeTimeout
+			attempt.TimedOut = true
+			result.Attempts = append(result.Attempts, attempt)
+			result.TimedOut = true
+			result.ExitCode = ExitCodeTimeout
+			r.info(fmt.Sprintf("Command timed out after %d seconds", inv.timeout))
+			return nil
+		}
+
+		if errors.Is(ctx.Err(), context.Canceled) {
+			attempt.ExitCode = ExitCodeCancelled
+			result.Attempts = append(result.Attempts, attempt)
+			r.markCancelled(result)
+			return nil
+		}
+
+		// A hung attempt counts as a failure, and can be retried like one
+		if idle {
+			exitCode, err = ExitCodeIdleTimeout, nil
+			attempt.ExitCode = ExitCodeIdleTimeout
+			attempt.IdleTimedOut = true
+			r.info(fmt.Sprintf("No output from iFlow CLI for %d seconds, stopped it", r.cfg.IdleTimeout))
+		}
+
+		if err != nil {
+			// Non-exit error (e.g., command not found)
+			return err
+		}
+
+		result.Attempts = append(result.Attempts, attempt)
+		result.ExitCode = exitCode
+		result.IdleTimedOut = idle
+
+		if number > r.cfg.Retries || !policy.shouldRetry(exitCode, match.Matched()) {
+			return nil
+		}
+
+		// Only retry if the backoff leaves time for another attempt
+		delay := retryDelay(time.Duration(r.cfg.RetryBackoff)*time.Second, number)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= delay {
+			r.info(fmt.Sprintf("Attempt %d failed with exit code %d, not enough time left to retry", number, exitCode))
+			return nil
+		}
+
+		r.info(fmt.Sprintf("Attempt %d failed with exit code %d, retrying in %s", number, exitCode, delay.Round(time.Millisecond)))
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			if errors.Is(ctx.Err(), context.Canceled) {
+				r.markCancelled(result)
+			}
+			return nil
+		}
+	}
+}
+
+// transcriptStreams returns the transcript writers for the stdout and stderr
+// of an invocation named name, or io.Discard when there is no transcript.
+func (r *run) transcriptStreams(name string) (io.Writer, io.Writer) {
+	if r.transcript == nil {
+		return io.Discard, io.Discard
+	}
+	tag := ""
+	if name != "" {
+		tag = name + " "
+	}
+	return r.transcript.stream(tag + "stdout"), r.transcript.stream(tag + "stderr")
+}
+
+// gracePeriod returns how long processes get to exit after SIGTERM.
+func (r *run) gracePeriod() time.Duration {
+	return time.Duration(r.cfg.KillGracePeriod) * time.Second
+}
@@ -0,0 +1,280 @@
+package action
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRun returns a run for cfg whose output is discarded.
+func newTestRun(cfg Config) *run {
+	runner := &Runner{
+		Executor: ExecExecutor{},
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+	return &run{runner: runner, cfg: cfg, redactor: &Redactor{}}
+}
+
+// fakeExecutor records commands and writes canned output instead of running
+// them. Each iflow invocation takes the next of outputs and exitCodes, then
+// output and exitCode.
+type fakeExecutor struct {
+	commands  []Command
+	output    string
+	outputs   []string
+	exitCode  int
+	exitCodes []int
+}
+
+func (f *fakeExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	f.commands = append(f.commands, cmd)
+	if cmd.Name == "iflow" && len(cmd.Args) > 0 && cmd.Args[0] == "--version" {
+		fmt.Fprint(cmd.Stdout, "0.2.0")
+		return 0, nil
+	}
+	output := f.output
+	if len(f.outputs) > 0 {
+		output = f.outputs[0]
+		f.outputs = f.outputs[1:]
+	}
+	fmt.Fprint(cmd.Stdout, output)
+	if len(f.exitCodes) > 0 {
+		exitCode := f.exitCodes[0]
+		f.exitCodes = f.exitCodes[1:]
+		return exitCode, nil
+	}
+	return f.exitCode, nil
+}
+
+// recordingSink keeps the last published config and result.
+type recordingSink struct {
+	cfg    Config
+	result *Result
+}
+
+func (s *recordingSink) Publish(cfg Config, result *Result) error {
+	s.cfg = cfg
+	s.result = result
+	return nil
+}
+
+func TestExecutePreCmd(t *testing.T) {
+	tests := []struct {
+		name        string
+		preCmd      string
+		expectError bool
+		ran         int
+	}{
+		{
+			name:        "Single command",
+			preCmd:      "echo 'single command'",
+			expectError: false,
+			ran:         1,
+		},
+		{
+			name:        "Multiple commands",
+			preCmd:      "echo 'first command'\necho 'second command'",
+			expectError: false,
+			ran:         2,
+		},
+		{
+			name:        "Multiple commands with empty lines",
+			preCmd:      "echo 'first command'\n\necho 'third command'",
+			expectError: false,
+			ran:         2,
+		},
+		{
+			name:        "Empty precmd",
+			preCmd:      "",
+			expectError: false,
+		},
+		{
+			name:        "Invalid command",
+			preCmd:      "nonexistentcommand12345",
+			expectError: true,
+			ran:         1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRun(Config{PreCmd: tt.preCmd, WorkingDir: t.TempDir()})
+
+			result := &Result{}
+			err := r.executePreCmd(context.Background(), result)
+
+			// Check if we expected an error
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error but got none")
+			} else if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if len(result.PreCommands) != tt.ran {
+				t.Errorf("Expected %d pre-command results, got %d", tt.ran, len(result.PreCommands))
+			}
+		})
+	}
+}
+
+func TestExecutePreCmdIsolatedHome(t *testing.T) {
+	home := t.TempDir()
+	r := newTestRun(Config{PreCmd: fmt.Sprintf("test \"$HOME\" = %q", home), WorkingDir: t.TempDir()})
+	r.homeDir = home
+
+	if err := r.executePreCmd(context.Background(), &Result{}); err != nil {
+		t.Errorf("Expected the pre-command to run with the isolated home: %v", err)
+	}
+}
+
+func TestRunnerRun(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	executor := &fakeExecutor{output: "done with sk-secret-value", exitCode: 3}
+	sink := &recordingSink{}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Sinks:    []Sink{sink},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-secret-value"
+	cfg.IsolatedHome = true
+	cfg.ExtraArgs = "--debug"
+
+	result, err := runner.Run(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.ExitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", result.ExitCode)
+	}
+	if result.IFlowVersion != "0.2.0" {
+		t.Errorf("Expected iFlow version 0.2.0, got %q", result.IFlowVersion)
+	}
+	if strings.Contains(result.Output, "sk-secret-value") {
+		t.Errorf("Expected API key to be redacted from output, got %q", result.Output)
+	}
+
+	iflow := executor.commands[len(executor.commands)-1]
+	expectedArgs := []string{"--yolo", "--prompt", "Review the code", "--debug"}
+	if strings.Join(iflow.Args, " ") != strings.Join(expectedArgs, " ") {
+		t.Errorf("Expected args %v, got %v", expectedArgs, iflow.Args)
+	}
+
+	if sink.result != result {
+		t.Errorf("Expected sink to receive the result")
+	}
+	if sink.cfg.APIKey != "***" {
+		t.Errorf("Expected sink config to be redacted, got API key %q", sink.cfg.APIKey)
+	}
+
+	// The isolated home is removed once the run finishes
+	var home string
+	for _, env := range iflow.Env {
+		if strings.HasPrefix(env, "HOME=") {
+			home = strings.TrimPrefix(env, "HOME=")
+		}
+	}
+	if home == "" {
+		t.Fatalf("Expected iflow to run with an isolated HOME")
+	}
+	if _, err := os.Stat(filepath.Join(home, ".iflow")); !os.IsNotExist(err) {
+		t.Errorf("Expected isolated home to be removed after the run")
+	}
+}
+
+func TestRunnerRunInvalidConfig(t *testing.T) {
+	executor := &fakeExecutor{}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.APIKey = "sk-test"
+	if _, err := runner.Run(context.Background(), cfg); err == nil {
+		t.Errorf("Expected error for missing prompt")
+	}
+	for _, cmd := range executor.commands {
+		if len(cmd.Args) == 0 || cmd.Args[0] != "--version" {
+			t.Errorf("Expected no commands besides the version check, got %v", cmd.Args)
+		}
+	}
+}
+
+// blockingExecutor writes partial output for iflow and blocks until ctx is done.
+type blockingExecutor struct {
+	started chan struct{}
+}
+
+func (b *blockingExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if len(cmd.Args) > 0 && cmd.Args[0] == "--version" {
+		return 0, nil
+	}
+	fmt.Fprint(cmd.Stdout, "partial output")
+	close(b.started)
+	<-ctx.Done()
+	return -1, nil
+}
+
+func TestRunnerRunCancelled(t *testing.T) {
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	executor := &blockingExecutor{started: make(chan struct{})}
+	sink := &recordingSink{}
+	runner := &Runner{
+		Executor: executor,
+		Logger:   ConsoleLogger{Out: io.Discard},
+		Sinks:    []Sink{sink},
+		Stdout:   io.Discard,
+		Stderr:   io.Discard,
+	}
+
+	cfg := DefaultConfig()
+	cfg.Prompt = "Review the code"
+	cfg.APIKey = "sk-test"
+	cfg.IsolatedHome = true
+	cfg.Retries = 3
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-executor.started
+		cancel()
+	}()
+
+	result, err := runner.Run(ctx, cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !result.Cancelled || result.TimedOut {
+		t.Errorf("Expected a cancelled result, got %+v", result)
+	}
+	if result.ExitCode != ExitCodeCancelled {
+		t.Errorf("Expected exit code %d, got %d", ExitCodeCancelled, result.ExitCode)
+	}
+	if len(result.Attempts) != 1 {
+		t.Errorf("Expected cancellation to stop retries, got %d attempts", len(result.Attempts))
+	}
+	if sink.result == nil || sink.result.Output != "partial output" {
+		t.Fatalf("Expected partial output to be published, got %+v", sink.result)
+	}
+
+	summary := GenerateSummaryMarkdown(sink.cfg, sink.result)
+	if !strings.Contains(summary, "Summary - Cancelled") || strings.Contains(summary, "Timeout Information") {
+		t.Errorf("Expected a cancelled summary, got:\n%s", summary)
+	}
+}
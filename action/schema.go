@@ -0,0 +1,255 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// inputSchema describes one action input in the JSON Schema.
+type inputSchema struct {
+	Name        string
+	Type        string // JSON Schema type of the value in a config file
+	Description string
+	Enum        []string
+	Minimum     int
+	Maximum     int
+	Items       map[string]interface{} // Schema of array items; strings when nil
+}
+
+// inputSchemas lists every input that can be set in a config file, in the
+// order of action.yml.
+var inputSchemas = []inputSchema{
+	{Name: "prompt", Type: "string", Description: "The prompt to execute with iFlow CLI (required unless prompt_file is set)"},
+	{Name: "prompt_file", Type: "string", Description: "Path to a file containing the prompt, rendered as a Go template"},
+	{Name: "render_prompt", Type: "boolean", Description: "Render the inline prompt as a Go template"},
+	{Name: "api_key", Type: "string", Description: "iFlow API key for authentication"},
+	{Name: "settings_json", Type: "string", Description: "Complete iFlow settings.json content (JSON string)"},
+	{Name: "settings_file", Type: "string", Description: "Path to a settings.json template, used when settings_json is empty"},
+	{Name: "settings_merge", Type: "string", Description: "How settings_json combines with api_key, base_url and model",
+		Enum: []string{SettingsMergeReplace, SettingsMergeJSONOverInputs, SettingsMergeInputsOverJSON}},
+	{Name: "print_settings", Type: "boolean", Description: "Print the effective settings.json with secrets redacted"},
+	{Name: "restore_settings", Type: "boolean", Description: "Restore the original ~/.iflow/settings.json on exit"},
+	{Name: "merge_existing_settings", Type: "boolean", Description: "Merge with the existing ~/.iflow/settings.json instead of overwriting it"},
+	{Name: "isolated_home", Type: "boolean", Description: "Run iFlow with a temporary per-run home directory"},
+	{Name: "base_url", Type: "string", Description: "Custom base URL for iFlow API"},
+	{Name: "model", Type: "string", Description: "Model name to use"},
+	{Name: "working_directory", Type: "string", Description: "Working directory to run iFlow CLI from"},
+	{Name: "timeout", Type: "integer", Description: "Timeout for iFlow CLI execution in seconds", Minimum: 1, Maximum: 86400},
+	{Name: "idle_timeout", Type: "integer", Description: "Seconds without any output from iFlow CLI after which it is stopped; 0 disables the watchdog", Minimum: 0, Maximum: 86400},
+	{Name: "kill_grace_period", Type: "integer", Description: "Seconds iFlow CLI and its descendants get to exit after SIGTERM before they are killed", Minimum: 0, Maximum: 300},
+	{Name: "retries", Type: "integer", Description: "How many times to re-run iFlow CLI after a retryable failure", Minimum: 0, Maximum: maxRetries},
+	{Name: "retry_backoff", Type: "integer", Description: "Base delay in seconds before the first retry, doubled for each further retry", Minimum: 0, Maximum: 3600},
+	{Name: "max_output_size", Type: "integer", Description: "Bytes of output kept in memory and published in the result output; the complete output is written to result_file and log_file", Minimum: minOutputSize, Maximum: maxOutputSize},
+	{Name: "transcript", Type: "boolean", Description: "Write a transcript of stdout and stderr lines, each prefixed with a timestamp and its stream, to transcript_file"},
+	{Name: "output_schema", Type: "string", Description: "JSON Schema, inline or the path of a file, that the last JSON code block or object in the output must match; published in the json output"},
+	{Name: "json_retries", Type: "integer", Description: "How often iFlow CLI is asked to rewrite its answer with the validation errors when its JSON answer is missing or invalid", Minimum: 0, Maximum: maxJSONRetries},
+	{Name: "detect_changes", Type: "boolean", Description: "Report the files iFlow CLI added, modified and deleted in the working tree, with a patch of the changes"},
+	{Name: "mode", Type: "string", Description: "direct lets iFlow CLI edit the working directory; patch runs it in a throwaway git worktree or copy and only returns the patch and changed files",
+		Enum: []string{ModeDirect, ModePatch}},
+	{Name: "commit_changes", Type: "boolean", Description: "Commit the changes of a successful run to a new local branch"},
+	{Name: "branch_name", Type: "string", Description: "Template of the name of the new branch; it must not exist yet"},
+	{Name: "commit_message", Type: "string", Description: "Template of the commit message, with the changed files in .Files"},
+	{Name: "generate_commit_message", Type: "boolean", Description: "Let iFlow CLI write the commit message from the patch, falling back to commit_message"},
+	{Name: "commit_author_name", Type: "string", Description: "Name of the author and committer of the commit"},
+	{Name: "commit_author_email", Type: "string", Description: "Email of the author and committer of the commit"},
+	{Name: "commit_signoff", Type: "boolean", Description: "Add a Signed-off-by trailer for the author to the commit message"},
+	{Name: "push_changes", Type: "boolean", Description: "Push the new branch to origin after committing"},
+	{Name: "use_pty", Type: "boolean", Description: "Run iFlow CLI on a pseudo-terminal instead of pipes (Linux only); stdout and stderr are merged into the result"},
+	{Name: "strip_ansi", Type: "boolean", Description: "Remove terminal escape sequences such as colours from the result, the output files and the step summary"},
+	{Name: "max_memory_mb", Type: "integer", Description: "Memory limit in MB for iFlow CLI and its descendants, enforced by a cgroup v2 sub-group where possible and the data segment rlimit otherwise; 0 is unlimited", Minimum: 0, Maximum: maxMemoryMB},
+	{Name: "max_cpu_seconds", Type: "integer", Description: "CPU time limit in seconds for iFlow CLI, which is killed when it uses more; 0 is unlimited", Minimum: 0, Maximum: maxCPUSeconds},
+	{Name: "max_open_files", Type: "integer", Description: "Open file descriptor limit for iFlow CLI; 0 is unlimited", Minimum: 0, Maximum: maxOpenFiles},
+	{Name: "report_file", Type: "string", Description: "Path of a versioned JSON report of the run, with the redacted config, timings, attempts and output files; the step summary can be re-rendered from it"},
+	{Name: "extra_args", Type: "string", Description: "Additional command line arguments to pass to iFlow CLI"},
+	{Name: "precmd", Type: "string", Description: "Shell command(s) to execute before running iFlow CLI"},
+	{Name: "mask_values", Type: "array", Description: "Additional secret values to mask in logs, outputs and the step summary"},
+	{Name: "redact_patterns", Type: "array", Description: "Additional regular expressions to redact"},
+	{Name: "retry_on", Type: "array", Description: "Exit codes and output regular expressions that make a failure retryable"},
+	{Name: "steps", Type: "array", Description: "Prompts run one after another; each can reference earlier steps with {{ .Steps.<name>.Output }}", Items: stepSchema},
+	{Name: "models", Type: "array", Description: "Models to run the prompt against, each with its own settings, for a side-by-side comparison"},
+	{Name: "model_concurrency", Type: "integer", Description: "How many models of the matrix run at the same time", Minimum: 1, Maximum: maxModelConcurrency},
+}
+
+// stepSchema describes one entry of the steps input.
+var stepSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"name":              map[string]interface{}{"type": "string", "pattern": stepNamePattern.String(), "description": "Name used to reference the step as {{ .Steps.<name> }}"},
+		"prompt":            map[string]interface{}{"type": "string", "description": "Prompt template for this step"},
+		"prompt_file":       map[string]interface{}{"type": "string", "description": "Path to a file containing the prompt template"},
+		"model":             map[string]interface{}{"type": "string", "description": "Model for this step"},
+		"timeout":           map[string]interface{}{"type": "integer", "minimum": 1, "maximum": 86400, "description": "Timeout for this step in seconds"},
+		"extra_args":        map[string]interface{}{"type": "string", "description": "Additional command line arguments for this step"},
+		"continue_on_error": map[string]interface{}{"type": "boolean", "description": "Run the next steps even if this one fails"},
+	},
+	"additionalProperties": false,
+}
+
+// InputsSchema returns a JSON Schema describing the action inputs as they
+// appear in a config file, including named profiles.
+func InputsSchema() ([]byte, error) {
+	properties := make(map[string]interface{}, len(inputSchemas))
+	for _, input := range inputSchemas {
+		property := map[string]interface{}{
+			"type":        input.Type,
+			"description": input.Description,
+		}
+		if len(input.Enum) > 0 {
+			property["enum"] = input.Enum
+		}
+		if input.Maximum > 0 {
+			property["minimum"] = input.Minimum
+			property["maximum"] = input.Maximum
+		}
+		if input.Items != nil {
+			property["items"] = input.Items
+		} else if input.Type == "array" {
+			property["items"] = map[string]interface{}{"type": "string"}
+		}
+		properties[input.Name] = property
+	}
+
+	// The top level accepts the inputs plus profiles; profiles accept only the inputs
+	topLevel := make(map[string]interface{}, len(properties)+1)
+	for name, property := range properties {
+		topLevel[name] = property
+	}
+	topLevel["profiles"] = map[string]interface{}{
+		"type":                 "object",
+		"description":          "Named bundles of inputs selected with the profile input",
+		"additionalProperties": map[string]interface{}{"$ref": "#/$defs/inputs"},
+	}
+
+	schema := map[string]interface{}{
+		"$schema":              "https://json-schema.org/draft/2020-12/schema",
+		"$id":                  "https://github.com/iflow-ai/iflow-cli-action/schema/inputs.json",
+		"title":                "iFlow CLI Action configuration",
+		"description":          "Inputs of the iFlow CLI Action, as used in a config_file",
+		"type":                 "object",
+		"properties":           topLevel,
+		"additionalProperties": false,
+		"$defs": map[string]interface{}{
+			"inputs": map[string]interface{}{
+				"type":                 "object",
+				"properties":           properties,
+				"additionalProperties": false,
+			},
+		},
+	}
+
+	return json.MarshalIndent(schema, "", "  ")
+}
+
+// settingsKeyTypes lists the iFlow settings.json keys the action knows about
+// and the JSON type of their values.
+var settingsKeyTypes = map[string]string{
+	"theme":                            "string",
+	"selectedAuthType":                 "string",
+	"apiKey":                           "string",
+	"baseUrl":                          "string",
+	"modelName":                        "string",
+	"searchApiKey":                     "string",
+	"mcpServers":                       "object",
+	"contextFileName":                  "string|array",
+	"sandbox":                          "boolean|string",
+	"coreTools":                        "array",
+	"excludeTools":                     "array",
+	"allowMCPServers":                  "array",
+	"excludeMCPServers":                "array",
+	"autoAccept":                       "boolean",
+	"checkpointing":                    "object",
+	"preferredEditor":                  "string",
+	"telemetry":                        "object",
+	"usageStatisticsEnabled":           "boolean",
+	"showMemoryUsage":                  "boolean",
+	"hideTips":                         "boolean",
+	"hideBanner":                       "boolean",
+	"maxSessionTurns":                  "number",
+	"fileFiltering":                    "object",
+	"disableAutoUpdate":                "boolean",
+	"memoryDiscoveryMaxDirs":           "number",
+	"summarizeToolOutput":              "object",
+	"toolDiscoveryCommand":             "string",
+	"toolCallCommand":                  "string",
+	"includeDirectories":               "array",
+	"chatCompression":                  "object",
+	"vimMode":                          "boolean",
+	"customThemes":                     "object",
+	"excludedProjectEnvVars":           "array",
+	"dnsResolutionOrder":               "string",
+	"loadMemoryFromIncludeDirectories": "boolean",
+}
+
+// CheckSettings checks settings_json against the known iFlow settings keys
+// and returns every unknown key and mistyped value.
+func CheckSettings(settingsJSON string) []error {
+	var settings map[string]interface{}
+	if err := json.Unmarshal([]byte(settingsJSON), &settings); err != nil {
+		return []error{fmt.Errorf("invalid settings_json provided: %w", err)}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []error
+	for _, key := range keys {
+		expected, ok := settingsKeyTypes[key]
+		if !ok {
+			problems = append(problems, fmt.Errorf("settings_json: unknown iFlow settings key %q", key))
+			continue
+		}
+		if actual := jsonType(settings[key]); !matchesType(expected, actual) {
+			problems = append(problems, fmt.Errorf("settings_json: %s must be of type %s, got %s", key, expected, actual))
+		}
+	}
+
+	if servers, ok := settings["mcpServers"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(servers))
+		for name := range servers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := servers[name].(map[string]interface{}); !ok {
+				problems = append(problems, fmt.Errorf("settings_json: mcpServers.%s must be of type object, got %s", name, jsonType(servers[name])))
+			}
+		}
+	}
+
+	return problems
+}
+
+// jsonType returns the JSON type name of a decoded value.
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// matchesType reports whether actual is one of the |-separated expected types.
+func matchesType(expected, actual string) bool {
+	for _, name := range strings.Split(expected, "|") {
+		if name == actual {
+			return true
+		}
+	}
+	return false
+}
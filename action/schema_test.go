@@ -0,0 +1,80 @@
+package action
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInputsSchema(t *testing.T) {
+	data, err := InputsSchema()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var schema struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("Schema is not valid JSON: %v", err)
+	}
+
+	// Every config file key must be described by the schema
+	fields := reflect.TypeOf(FileConfig{})
+	for i := 0; i < fields.NumField(); i++ {
+		key := fields.Field(i).Tag.Get("yaml")
+		if _, ok := schema.Properties[key]; !ok {
+			t.Errorf("Schema is missing config file key %q", key)
+		}
+	}
+	if len(schema.Properties) != fields.NumField() {
+		t.Errorf("Expected %d schema properties, got %d", fields.NumField(), len(schema.Properties))
+	}
+}
+
+func TestCheckSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings string
+		expected []string
+	}{
+		{
+			name:     "Known keys",
+			settings: `{"theme":"Default","apiKey":"sk-test","maxSessionTurns":10,"mcpServers":{"github":{"command":"npx"}}}`,
+		},
+		{
+			name:     "Unknown key",
+			settings: `{"modelname":"Qwen3-Coder"}`,
+			expected: []string{`unknown iFlow settings key "modelname"`},
+		},
+		{
+			name:     "Wrong types",
+			settings: `{"hideTips":"yes","coreTools":"ShellTool","mcpServers":{"github":"npx"}}`,
+			expected: []string{
+				"coreTools must be of type array, got string",
+				"hideTips must be of type boolean, got string",
+				"mcpServers.github must be of type object, got string",
+			},
+		},
+		{
+			name:     "Not an object",
+			settings: `[1, 2]`,
+			expected: []string{"invalid settings_json provided"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := CheckSettings(tt.settings)
+			if len(problems) != len(tt.expected) {
+				t.Fatalf("Expected %d problems, got %v", len(tt.expected), problems)
+			}
+			for i, problem := range problems {
+				if !strings.Contains(problem.Error(), tt.expected[i]) {
+					t.Errorf("Expected problem containing %q, got %q", tt.expected[i], problem)
+				}
+			}
+		})
+	}
+}
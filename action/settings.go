@@ -0,0 +1,173 @@
+package action
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+)
+
+// Settings merge modes control how settings_json combines with the
+// individual api_key, base_url and model inputs.
+const (
+	SettingsMergeReplace        = "replace"          // settings_json replaces the individual inputs
+	SettingsMergeJSONOverInputs = "json-over-inputs" // inputs form the base, settings_json is deep-merged on top
+	SettingsMergeInputsOverJSON = "inputs-over-json" // settings_json forms the base, inputs are deep-merged on top
+)
+
+// IFlowSettings represents the iFlow configuration
+type IFlowSettings struct {
+	Theme            string `json:"theme"`
+	SelectedAuthType string `json:"selectedAuthType"`
+	APIKey           string `json:"apiKey"`
+	BaseURL          string `json:"baseUrl"`
+	ModelName        string `json:"modelName"`
+	SearchAPIKey     string `json:"searchApiKey"`
+}
+
+// secretKeyPattern matches settings keys whose values must not be printed.
+var secretKeyPattern = regexp.MustCompile(`(?i)(key|token|secret|password|credential|authorization)`)
+
+// buildSettings produces the settings.json content according to the
+// configured merge mode.
+func buildSettings(cfg *Config) (map[string]interface{}, error) {
+	inputs, err := inputSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.SettingsJSON == "" {
+		return inputs, nil
+	}
+
+	var provided map[string]interface{}
+	if err := json.Unmarshal([]byte(cfg.SettingsJSON), &provided); err != nil {
+		return nil, fmt.Errorf("invalid settings_json provided: %w", err)
+	}
+
+	switch cfg.SettingsMerge {
+	case "", SettingsMergeReplace:
+		return provided, nil
+	case SettingsMergeJSONOverInputs:
+		return deepMerge(inputs, provided), nil
+	case SettingsMergeInputsOverJSON:
+		// Defaults only fill keys settings_json leaves out; inputs that were
+		// set replace its values
+		return deepMerge(deepMerge(inputs, provided), setInputSettings(cfg)), nil
+	default:
+		return nil, fmt.Errorf("invalid settings_merge value %q (expected %s, %s or %s)",
+			cfg.SettingsMerge, SettingsMergeReplace, SettingsMergeJSONOverInputs, SettingsMergeInputsOverJSON)
+	}
+}
+
+// settingsSource describes where the settings written by buildSettings come from.
+func settingsSource(cfg *Config) string {
+	switch {
+	case cfg.SettingsJSON == "":
+		return "Creating settings from individual parameters"
+	case cfg.SettingsMerge == SettingsMergeJSONOverInputs:
+		return "Merging settings_json on top of individual parameters"
+	case cfg.SettingsMerge == SettingsMergeInputsOverJSON:
+		return "Merging individual parameters on top of settings_json"
+	default:
+		return "Using provided settings.json content"
+	}
+}
+
+// inputSettings converts the individual inputs into a generic settings map.
+func inputSettings(cfg *Config) (map[string]interface{}, error) {
+	settings := IFlowSettings{
+		Theme:            "Default",
+		SelectedAuthType: "iflow",
+		APIKey:           cfg.APIKey,
+		BaseURL:          cfg.BaseURL,
+		ModelName:        cfg.Model,
+		SearchAPIKey:     cfg.APIKey,
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal settings: %w", err)
+	}
+
+	var result map[string]interface{}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to convert settings: %w", err)
+	}
+	return result, nil
+}
+
+// SetExplicit records that the named input (api_key, base_url or model) was
+// provided by the user, so it replaces settings_json values in the
+// inputs-over-json merge mode even when it equals the default.
+func (c *Config) SetExplicit(input string) {
+	if c.ExplicitInputs == nil {
+		c.ExplicitInputs = make(map[string]bool)
+	}
+	c.ExplicitInputs[input] = true
+}
+
+// setInputSettings returns the settings of the individual inputs that were
+// provided explicitly rather than left at their defaults.
+func setInputSettings(cfg *Config) map[string]interface{} {
+	settings := make(map[string]interface{})
+	if cfg.APIKey != "" || cfg.ExplicitInputs["api_key"] {
+		settings["apiKey"] = cfg.APIKey
+		settings["searchApiKey"] = cfg.APIKey
+	}
+	if cfg.ExplicitInputs["base_url"] {
+		settings["baseUrl"] = cfg.BaseURL
+	}
+	if cfg.ExplicitInputs["model"] {
+		settings["modelName"] = cfg.Model
+	}
+	return settings
+}
+
+// deepMerge returns base with overlay merged on top. Nested objects are merged
+// recursively; any other overlay value replaces the base value.
+func deepMerge(base, overlay map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(base)+len(overlay))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range overlay {
+		overlayMap, overlayIsMap := v.(map[string]interface{})
+		baseMap, baseIsMap := result[k].(map[string]interface{})
+		if overlayIsMap && baseIsMap {
+			result[k] = deepMerge(baseMap, overlayMap)
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// redactSettings returns a copy of the settings with secret-looking values
+// replaced, suitable for printing.
+func redactSettings(settings map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(settings))
+	for k, v := range settings {
+		result[k] = redactValue(k, v)
+	}
+	return result
+}
+
+func redactValue(key string, value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return redactSettings(v)
+	case []interface{}:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = redactValue(key, item)
+		}
+		return items
+	case string:
+		if v != "" && secretKeyPattern.MatchString(key) {
+			return "***"
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,197 @@
+package action
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildSettings(t *testing.T) {
+	settingsJSON := `{"modelName":"from-json","mcpServers":{"deepwiki":{"serverUrl":"https://mcp.deepwiki.com/sse"}}}`
+
+	tests := []struct {
+		name        string
+		mode        string
+		expected    map[string]interface{}
+		expectError bool
+	}{
+		{
+			name: "Replace",
+			mode: SettingsMergeReplace,
+			expected: map[string]interface{}{
+				"modelName":  "from-json",
+				"mcpServers": map[string]interface{}{"deepwiki": map[string]interface{}{"serverUrl": "https://mcp.deepwiki.com/sse"}},
+			},
+		},
+		{
+			name: "JSON over inputs",
+			mode: SettingsMergeJSONOverInputs,
+			expected: map[string]interface{}{
+				"theme":            "Default",
+				"selectedAuthType": "iflow",
+				"apiKey":           "sk-test",
+				"baseUrl":          "https://apis.iflow.cn/v1",
+				"modelName":        "from-json",
+				"searchApiKey":     "sk-test",
+				"mcpServers":       map[string]interface{}{"deepwiki": map[string]interface{}{"serverUrl": "https://mcp.deepwiki.com/sse"}},
+			},
+		},
+		{
+			name: "Inputs over JSON",
+			mode: SettingsMergeInputsOverJSON,
+			expected: map[string]interface{}{
+				"theme":            "Default",
+				"selectedAuthType": "iflow",
+				"apiKey":           "sk-test",
+				"baseUrl":          "https://apis.iflow.cn/v1",
+				"modelName":        "from-json",
+				"searchApiKey":     "sk-test",
+				"mcpServers":       map[string]interface{}{"deepwiki": map[string]interface{}{"serverUrl": "https://mcp.deepwiki.com/sse"}},
+			},
+		},
+		{
+			name:        "Invalid mode",
+			mode:        "bogus",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				APIKey:        "sk-test",
+				BaseURL:       "https://apis.iflow.cn/v1",
+				Model:         "Qwen3-Coder",
+				SettingsJSON:  settingsJSON,
+				SettingsMerge: tt.mode,
+			}
+
+			settings, err := buildSettings(cfg)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(settings, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, settings)
+			}
+		})
+	}
+}
+
+func TestBuildSettingsInputsOverJSON(t *testing.T) {
+	settingsJSON := `{"apiKey":"sk-from-json","modelName":"GLM-4.5"}`
+
+	tests := []struct {
+		name     string
+		apiKey   string
+		model    string
+		explicit []string
+		expected map[string]interface{}
+	}{
+		{
+			name: "Unset inputs keep JSON",
+			expected: map[string]interface{}{
+				"theme":            "Default",
+				"selectedAuthType": "iflow",
+				"apiKey":           "sk-from-json",
+				"baseUrl":          "https://apis.iflow.cn/v1",
+				"modelName":        "GLM-4.5",
+				"searchApiKey":     "",
+			},
+		},
+		{
+			name:     "Set inputs replace JSON",
+			apiKey:   "sk-from-input",
+			model:    "Kimi-K2",
+			explicit: []string{"api_key", "model"},
+			expected: map[string]interface{}{
+				"theme":            "Default",
+				"selectedAuthType": "iflow",
+				"apiKey":           "sk-from-input",
+				"baseUrl":          "https://apis.iflow.cn/v1",
+				"modelName":        "Kimi-K2",
+				"searchApiKey":     "sk-from-input",
+			},
+		},
+		{
+			name:     "Inputs set to their defaults replace JSON",
+			model:    DefaultModel,
+			explicit: []string{"base_url", "model"},
+			expected: map[string]interface{}{
+				"theme":            "Default",
+				"selectedAuthType": "iflow",
+				"apiKey":           "sk-from-json",
+				"baseUrl":          DefaultBaseURL,
+				"modelName":        DefaultModel,
+				"searchApiKey":     "",
+			},
+		},
+		{
+			name:  "Inputs that were not provided keep JSON",
+			model: "Kimi-K2",
+			expected: map[string]interface{}{
+				"theme":            "Default",
+				"selectedAuthType": "iflow",
+				"apiKey":           "sk-from-json",
+				"baseUrl":          "https://apis.iflow.cn/v1",
+				"modelName":        "GLM-4.5",
+				"searchApiKey":     "",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			cfg.APIKey = tt.apiKey
+			if tt.model != "" {
+				cfg.Model = tt.model
+			}
+			for _, input := range tt.explicit {
+				cfg.SetExplicit(input)
+			}
+			cfg.SettingsJSON = settingsJSON
+			cfg.SettingsMerge = SettingsMergeInputsOverJSON
+
+			settings, err := buildSettings(&cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(settings, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, settings)
+			}
+		})
+	}
+}
+
+func TestRedactSettings(t *testing.T) {
+	settings := map[string]interface{}{
+		"apiKey":    "sk-secret",
+		"modelName": "Qwen3-Coder",
+		"mcpServers": map[string]interface{}{
+			"github": map[string]interface{}{
+				"env": map[string]interface{}{"GITHUB_PERSONAL_ACCESS_TOKEN": "ghp_secret"},
+			},
+		},
+	}
+
+	redacted := redactSettings(settings)
+
+	if redacted["apiKey"] != "***" {
+		t.Errorf("Expected apiKey to be redacted, got %v", redacted["apiKey"])
+	}
+	if redacted["modelName"] != "Qwen3-Coder" {
+		t.Errorf("Expected modelName to be kept, got %v", redacted["modelName"])
+	}
+	env := redacted["mcpServers"].(map[string]interface{})["github"].(map[string]interface{})["env"].(map[string]interface{})
+	if env["GITHUB_PERSONAL_ACCESS_TOKEN"] != "***" {
+		t.Errorf("Expected nested token to be redacted, got %v", env["GITHUB_PERSONAL_ACCESS_TOKEN"])
+	}
+	if settings["apiKey"] != "sk-secret" {
+		t.Errorf("Redaction must not modify the original settings")
+	}
+}
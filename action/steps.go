@@ -0,0 +1,238 @@
+package action
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Step is one prompt of a multi-step pipeline. Its prompt is always rendered
+// as a template and can reference earlier steps, e.g.
+// {{ .Steps.analyze.Output }}. Empty overrides fall back to the run's values.
+type Step struct {
+	Name            string `yaml:"name" toml:"name" json:"name"`
+	Prompt          string `yaml:"prompt" toml:"prompt" json:"prompt"`
+	PromptFile      string `yaml:"prompt_file" toml:"prompt_file" json:"prompt_file"`
+	Model           string `yaml:"model" toml:"model" json:"model"`
+	Timeout         int    `yaml:"timeout" toml:"timeout" json:"timeout"`
+	ExtraArgs       string `yaml:"extra_args" toml:"extra_args" json:"extra_args"`
+	ContinueOnError bool   `yaml:"continue_on_error" toml:"continue_on_error" json:"continue_on_error"`
+}
+
+// StepData is what a step's template sees of an earlier step.
+type StepData struct {
+	Output   string // Stdout of the step
+	Stderr   string
+	ExitCode int
+}
+
+// StepResult describes the outcome of one step.
+type StepResult struct {
+	Execution
+	Name            string
+	Prompt          string // Rendered prompt, with secrets redacted
+	ContinueOnError bool
+	Skipped         bool // Not run because an earlier step failed or the run was cancelled
+}
+
+// Outcome summarizes the step as one of the Outcome* constants.
+func (s *StepResult) Outcome() string {
+	if s.Skipped {
+		return OutcomeSkipped
+	}
+	return s.Execution.Outcome()
+}
+
+// stepNamePattern keeps step names usable as {{ .Steps.name }}.
+var stepNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ParseSteps decodes the steps input, a YAML list of steps.
+func ParseSteps(data string) ([]Step, error) {
+	var steps []Step
+	decoder := yaml.NewDecoder(strings.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&steps); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse steps: %w", err)
+	}
+	return steps, nil
+}
+
+// resolveSteps names unnamed steps and loads their prompt files.
+func (c *Config) resolveSteps() error {
+	for i := range c.Steps {
+		step := &c.Steps[i]
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if step.Prompt != "" && step.PromptFile != "" {
+			return fmt.Errorf("step %s: prompt and prompt_file cannot both be set", step.Name)
+		}
+		if step.PromptFile != "" {
+			data, err := os.ReadFile(step.PromptFile)
+			if err != nil {
+				return fmt.Errorf("step %s: failed to read prompt file: %w", step.Name, err)
+			}
+			step.Prompt = strings.TrimSpace(string(data))
+		}
+	}
+	return nil
+}
+
+// validateSteps returns every problem with the configured steps.
+func (c *Config) validateSteps() []error {
+	if len(c.Steps) == 0 {
+		return nil
+	}
+
+	var problems []error
+	if c.Prompt != "" || c.PromptFile != "" {
+		problems = append(problems, fmt.Errorf("prompt and prompt_file cannot be combined with steps"))
+	}
+
+	seen := make(map[string]bool, len(c.Steps))
+	for i, step := range c.Steps {
+		name := step.Name
+		if name == "" {
+			name = fmt.Sprintf("step%d", i+1)
+		}
+		if !stepNamePattern.MatchString(name) {
+			problems = append(problems, fmt.Errorf("step name %q must start with a letter or underscore and contain only letters, digits and underscores", name))
+		}
+		if seen[name] {
+			problems = append(problems, fmt.Errorf("step name %q is used more than once", name))
+		}
+		seen[name] = true
+
+		if step.Prompt == "" && step.PromptFile == "" {
+			problems = append(problems, fmt.Errorf("step %s: prompt or prompt_file is required", name))
+		} else if _, err := parsePromptTemplate(step.Prompt); err != nil {
+			problems = append(problems, fmt.Errorf("step %s: %w", name, err))
+		}
+		if step.Timeout < 0 || step.Timeout > 86400 {
+			problems = append(problems, fmt.Errorf("step %s: timeout value %d is out of range. Timeout must be between 1 and 86400 seconds (24 hours)", name, step.Timeout))
+		}
+	}
+	return problems
+}
+
+// executeSteps runs the steps in order. A failed step stops the pipeline
+// unless it is marked continue_on_error; cancellation always stops it.
+func (r *run) executeSteps(ctx context.Context, result *Result) error {
+	data, err := loadPromptData()
+	if err != nil {
+		return err
+	}
+	data.Steps = make(map[string]StepData, len(r.cfg.Steps))
+
+	result.StartTime = time.Now()
+	defer func() { result.EndTime = time.Now() }()
+
+	var stopped *StepResult
+	for _, step := range r.cfg.Steps {
+		stepResult := StepResult{Name: step.Name, ContinueOnError: step.ContinueOnError}
+		if stopped != nil {
+			stepResult.Skipped = true
+			result.Steps = append(result.Steps, stepResult)
+			continue
+		}
+
+		r.info(fmt.Sprintf("Running step %s", step.Name))
+		if err := r.executeStep(ctx, step, data, &stepResult); err != nil {
+			return err
+		}
+		result.Steps = append(result.Steps, stepResult)
+		data.Steps[step.Name] = StepData{Output: stepResult.Output, Stderr: stepResult.Stderr, ExitCode: stepResult.ExitCode}
+
+		result.Output = stepResult.Output
+		result.OutputFile = stepResult.OutputFile
+		result.OutputSize = stepResult.OutputSize
+		result.Truncated = stepResult.Truncated
+		result.Stderr = stepResult.Stderr
+		result.Usage.add(stepResult.Usage)
+		if stepResult.Cancelled || (stepResult.ExitCode != 0 && !step.ContinueOnError) {
+			stopped = &result.Steps[len(result.Steps)-1]
+		} else if stepResult.ExitCode != 0 {
+			r.info(fmt.Sprintf("Step %s failed with exit code %d, continuing", step.Name, stepResult.ExitCode))
+		}
+	}
+
+	if stopped != nil {
+		result.ExitCode = stopped.ExitCode
+		result.TimedOut = stopped.TimedOut
+		result.IdleTimedOut = stopped.IdleTimedOut
+		result.Cancelled = stopped.Cancelled
+	}
+	return nil
+}
+
+// executeStep renders the step's prompt against the earlier steps and runs
+// it. A prompt that fails to render counts as a failed step.
+func (r *run) executeStep(ctx context.Context, step Step, data PromptData, result *StepResult) error {
+	prompt, err := RenderPrompt(step.Prompt, data)
+	if err != nil {
+		result.ExitCode = 1
+		result.Output = err.Error()
+		r.info(fmt.Sprintf("Step %s: %v", step.Name, err))
+		return nil
+	}
+	result.Prompt = strings.TrimSpace(prompt)
+
+	inv := r.promptInvocation()
+	inv.prompt = result.Prompt
+	inv.name = step.Name
+	inv.model = step.Model
+	if step.Timeout > 0 {
+		inv.timeout = step.Timeout
+	}
+	if step.ExtraArgs != "" {
+		inv.extraArgs = step.ExtraArgs
+	}
+	return r.executeIFlow(ctx, inv, &result.Execution)
+}
+
+// parsePromptTemplate parses a prompt template without executing it.
+func parsePromptTemplate(prompt string) (*template.Template, error) {
+	tmpl, err := template.New("prompt").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"toJSON": toJSON}).
+		Parse(prompt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt template: %w", err)
+	}
+	return tmpl, nil
+}
+
+// StepsJSON renders the step results as the JSON array published in the
+// steps output.
+func StepsJSON(steps []StepResult) (string, error) {
+	type stepOutput struct {
+		Name     string `json:"name"`
+		Outcome  string `json:"outcome"`
+		ExitCode int    `json:"exit_code"`
+		Output   string `json:"output"`
+		Stderr   string `json:"stderr"`
+	}
+
+	// Outputs share the size limit of the output
+	return fitJSON(MaxPublishedSize/max(2*len(steps), 1), func(limit int) interface{} {
+		outputs := make([]stepOutput, 0, len(steps))
+		for _, step := range steps {
+			outputs = append(outputs, stepOutput{
+				Name:     step.Name,
+				Outcome:  step.Outcome(),
+				ExitCode: step.ExitCode,
+				Output:   truncateMiddle(step.Output, limit),
+				Stderr:   truncateMiddle(step.Stderr, limit),
+			})
+		}
+		return outputs
+	})
+}
@@ -0,0 +1,233 @@
+package action
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// echoExecutor answers each iflow prompt with "done: <prompt>" and fails
+// prompts that start with "fail".
+type echoExecutor struct {
+	prompts []string
+	models  []string
+}
+
+func (e *echoExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if len(cmd.Args) > 0 && cmd.Args[0] == "--version" {
+		return 0, nil
+	}
+	prompt := cmd.Args[2]
+	model := ""
+	for i, arg := range cmd.Args {
+		if arg == "--model" {
+			model = cmd.Args[i+1]
+		}
+	}
+	e.prompts = append(e.prompts, prompt)
+	e.models = append(e.models, model)
+	fmt.Fprintf(cmd.Stdout, "done: %s", prompt)
+	if strings.HasPrefix(prompt, "fail") {
+		return 2, nil
+	}
+	return 0, nil
+}
+
+func TestParseSteps(t *testing.T) {
+	steps, err := ParseSteps(`
+- name: analyze
+  prompt: Analyze the code
+  model: GLM-4.5
+  timeout: 600
+- name: plan
+  prompt_file: .iflow/plan.md
+  continue_on_error: true
+`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []Step{
+		{Name: "analyze", Prompt: "Analyze the code", Model: "GLM-4.5", Timeout: 600},
+		{Name: "plan", PromptFile: ".iflow/plan.md", ContinueOnError: true},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("Expected %d steps, got %+v", len(expected), steps)
+	}
+	for i := range expected {
+		if steps[i] != expected[i] {
+			t.Errorf("Expected step %+v, got %+v", expected[i], steps[i])
+		}
+	}
+
+	if _, err := ParseSteps("- name: analyze\n  promt: typo\n"); err == nil {
+		t.Errorf("Expected error for unknown step key")
+	}
+}
+
+func TestValidateSteps(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.APIKey = "sk-test"
+	cfg.Prompt = "Review"
+	cfg.Steps = []Step{
+		{Name: "analyze", Prompt: "Analyze"},
+		{Name: "analyze", Prompt: "{{ .Steps.analyze.Output "},
+		{Name: "bad-name", Prompt: "Plan"},
+		{Name: "empty"},
+	}
+
+	problems := cfg.validateSteps()
+	expected := []string{
+		"prompt and prompt_file cannot be combined with steps",
+		`step name "analyze" is used more than once`,
+		"step analyze: failed to parse prompt template",
+		`step name "bad-name" must start with a letter`,
+		"step empty: prompt or prompt_file is required",
+	}
+	if len(problems) != len(expected) {
+		t.Fatalf("Expected %d problems, got %v", len(expected), problems)
+	}
+	for i, problem := range problems {
+		if !strings.Contains(problem.Error(), expected[i]) {
+			t.Errorf("Expected problem containing %q, got %q", expected[i], problem)
+		}
+	}
+}
+
+func TestRunnerRunSteps(t *testing.T) {
+	tests := []struct {
+		name         string
+		steps        []Step
+		expectedExit int
+		outcomes     []string
+		prompts      []string
+		models       []string
+		output       string
+	}{
+		{
+			name: "Outputs are chained",
+			steps: []Step{
+				{Name: "analyze", Prompt: "Analyze", Model: "GLM-4.5"},
+				{Name: "plan", Prompt: "Plan from {{ .Steps.analyze.Output }}"},
+			},
+			outcomes: []string{OutcomeSuccess, OutcomeSuccess},
+			prompts:  []string{"Analyze", "Plan from done: Analyze"},
+			models:   []string{"GLM-4.5", ""},
+			output:   "done: Plan from done: Analyze",
+		},
+		{
+			name: "Failure stops the pipeline",
+			steps: []Step{
+				{Name: "analyze", Prompt: "fail analysis"},
+				{Name: "plan", Prompt: "Plan"},
+			},
+			expectedExit: 2,
+			outcomes:     []string{OutcomeFailure, OutcomeSkipped},
+			prompts:      []string{"fail analysis"},
+			output:       "done: fail analysis",
+		},
+		{
+			name: "Continue on error",
+			steps: []Step{
+				{Name: "analyze", Prompt: "fail analysis", ContinueOnError: true},
+				{Name: "plan", Prompt: "Plan after exit {{ .Steps.analyze.ExitCode }}"},
+			},
+			outcomes: []string{OutcomeFailure, OutcomeSuccess},
+			prompts:  []string{"fail analysis", "Plan after exit 2"},
+			output:   "done: Plan after exit 2",
+		},
+		{
+			name: "Reference to a later step fails the step",
+			steps: []Step{
+				{Name: "analyze", Prompt: "Analyze {{ .Steps.plan.Output }}"},
+				{Name: "plan", Prompt: "Plan"},
+			},
+			expectedExit: 1,
+			outcomes:     []string{OutcomeFailure, OutcomeSkipped},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+			t.Setenv("GITHUB_EVENT_PATH", "")
+
+			executor := &echoExecutor{}
+			runner := &Runner{
+				Executor: executor,
+				Logger:   ConsoleLogger{Out: io.Discard},
+				Stdout:   io.Discard,
+				Stderr:   io.Discard,
+			}
+
+			cfg := DefaultConfig()
+			cfg.APIKey = "sk-test"
+			cfg.IsolatedHome = true
+			cfg.Steps = tt.steps
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.ExitCode != tt.expectedExit {
+				t.Errorf("Expected exit code %d, got %d", tt.expectedExit, result.ExitCode)
+			}
+			if len(result.Steps) != len(tt.outcomes) {
+				t.Fatalf("Expected %d step results, got %d", len(tt.outcomes), len(result.Steps))
+			}
+			for i, step := range result.Steps {
+				if step.Outcome() != tt.outcomes[i] {
+					t.Errorf("Step %s: expected outcome %s, got %s", step.Name, tt.outcomes[i], step.Outcome())
+				}
+			}
+			if strings.Join(executor.prompts, "|") != strings.Join(tt.prompts, "|") {
+				t.Errorf("Expected prompts %q, got %q", tt.prompts, executor.prompts)
+			}
+			if tt.models != nil && strings.Join(executor.models, "|") != strings.Join(tt.models, "|") {
+				t.Errorf("Expected models %q, got %q", tt.models, executor.models)
+			}
+			if tt.output != "" && result.Output != tt.output {
+				t.Errorf("Expected output %q, got %q", tt.output, result.Output)
+			}
+		})
+	}
+}
+
+func TestStepsJSON(t *testing.T) {
+	steps := []StepResult{
+		{Name: "analyze", Execution: Execution{Output: "line \"one\"\n", ExitCode: 0}},
+		{Name: "plan", Skipped: true},
+	}
+	data, err := StepsJSON(steps)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := `[{"name":"analyze","outcome":"success","exit_code":0,"output":"line \"one\"\n","stderr":""},{"name":"plan","outcome":"skipped","exit_code":0,"output":"","stderr":""}]`
+	if data != expected {
+		t.Errorf("Expected %s, got %s", expected, data)
+	}
+}
+
+func TestStepsJSONLimit(t *testing.T) {
+	// Each output alone fits in max_output_size, all of them together don't
+	var steps []StepResult
+	for i := range 8 {
+		output := strings.Repeat("<line>\n", maxOutputSize/7)
+		steps = append(steps, StepResult{Name: fmt.Sprintf("step-%d", i), Execution: Execution{Output: output, Stderr: output}})
+	}
+
+	data, err := StepsJSON(steps)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(data) > MaxPublishedSize {
+		t.Errorf("Expected at most %d bytes, got %d", MaxPublishedSize, len(data))
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal([]byte(data), &decoded); err != nil || len(decoded) != len(steps) {
+		t.Errorf("Expected a JSON array of %d steps, got %v", len(steps), err)
+	}
+}
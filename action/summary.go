@@ -0,0 +1,456 @@
+package action
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GenerateSummaryMarkdown renders the GitHub Actions step summary for a run.
+func GenerateSummaryMarkdown(cfg Config, result *Result) string {
+	exitCode := result.ExitCode
+
+	var summary strings.Builder
+
+	// Add header with emoji based on status
+	if result.Cancelled {
+		summary.WriteString("## 🛑 iFlow CLI Execution Summary - Cancelled\n\n")
+	} else if result.TimedOut {
+		summary.WriteString("## ⏰ iFlow CLI Execution Summary - Timeout\n\n")
+	} else if result.IdleTimedOut {
+		summary.WriteString("## 💤 iFlow CLI Execution Summary - Idle Timeout\n\n")
+	} else if exitCode == 0 {
+		summary.WriteString("## ✅ iFlow CLI Execution Summary\n\n")
+	} else {
+		summary.WriteString("## ❌ iFlow CLI Execution Summary\n\n")
+	}
+
+	// Add execution status with more detail
+	summary.WriteString("### 📊 Status\n\n")
+	if result.Cancelled {
+		summary.WriteString("🛑 **Execution**: Cancelled\n")
+		summary.WriteString(fmt.Sprintf("💥 **Exit Code**: %d\n\n", exitCode))
+	} else if result.TimedOut {
+		summary.WriteString("⏰ **Execution**: Timed Out\n")
+		summary.WriteString(fmt.Sprintf("🕒 **Timeout Duration**: %d seconds\n", cfg.Timeout))
+		summary.WriteString(fmt.Sprintf("💥 **Exit Code**: %d\n\n", exitCode))
+	} else if result.IdleTimedOut {
+		summary.WriteString("💤 **Execution**: Idle Timeout\n")
+		summary.WriteString(fmt.Sprintf("🕒 **Idle Timeout**: %d seconds without output\n", cfg.IdleTimeout))
+		summary.WriteString(fmt.Sprintf("💥 **Exit Code**: %d\n\n", exitCode))
+	} else if exitCode == 0 {
+		summary.WriteString("🎉 **Execution**: Successful\n")
+		summary.WriteString("🎯 **Exit Code**: 0\n\n")
+	} else {
+		summary.WriteString("⚠️ **Execution**: Failed\n")
+		summary.WriteString(fmt.Sprintf("💥 **Exit Code**: %d\n\n", exitCode))
+	}
+
+	// Add retry attempts when iflow was re-invoked
+	if len(result.Attempts) > 1 {
+		summary.WriteString("### 🔁 Attempts\n\n")
+		summary.WriteString("| Attempt | Exit Code | Duration |\n")
+		summary.WriteString("|---------|-----------|----------|\n")
+		for _, attempt := range result.Attempts {
+			exitCode := fmt.Sprintf("%d", attempt.ExitCode)
+			if attempt.TimedOut {
+				exitCode += " (timeout)"
+			} else if attempt.IdleTimedOut {
+				exitCode += " (idle timeout)"
+			}
+			summary.WriteString(fmt.Sprintf("| %d | %s | %s |\n", attempt.Number, exitCode, attempt.Duration.Round(time.Millisecond)))
+		}
+		summary.WriteString("\n")
+	}
+
+	// Add configuration details in a table format
+	summary.WriteString("### ⚙️ Configuration\n\n")
+	summary.WriteString("| Setting | Value |\n")
+	summary.WriteString("|---------|-------|\n")
+	if cfg.Profile != "" {
+		summary.WriteString(fmt.Sprintf("| Profile | `%s` |\n", cfg.Profile))
+	}
+	if len(cfg.Models) > 0 {
+		summary.WriteString(fmt.Sprintf("| Models | `%s` |\n", strings.Join(cfg.Models, "`, `")))
+		summary.WriteString(fmt.Sprintf("| Model Concurrency | %d |\n", cfg.ModelConcurrency))
+	} else {
+		summary.WriteString(fmt.Sprintf("| Model | `%s` |\n", cfg.Model))
+	}
+	summary.WriteString(fmt.Sprintf("| Base URL | `%s` |\n", cfg.BaseURL))
+	summary.WriteString(fmt.Sprintf("| Timeout | %d seconds |\n", cfg.Timeout))
+	if cfg.IdleTimeout > 0 {
+		summary.WriteString(fmt.Sprintf("| Idle Timeout | %d seconds |\n", cfg.IdleTimeout))
+	}
+	summary.WriteString(fmt.Sprintf("| Working Directory | `%s` |\n", cfg.WorkingDir))
+	if cfg.Mode == ModePatch {
+		summary.WriteString("| Mode | `patch` (working directory left untouched) |\n")
+	}
+	if cfg.Retries > 0 {
+		summary.WriteString(fmt.Sprintf("| Retries | %d (backoff %d seconds) |\n", cfg.Retries, cfg.RetryBackoff))
+	}
+	if cfg.IsolatedHome {
+		summary.WriteString("| Isolated Home | ✅ |\n")
+	}
+	if cfg.UsePTY {
+		summary.WriteString("| Pseudo-Terminal | ✅ |\n")
+	}
+	if limits := cfg.resourceLimits(); limits.Enabled() {
+		summary.WriteString(fmt.Sprintf("| Resource Limits | %s |\n", limits))
+	}
+	if cfg.ExtraArgs != "" {
+		summary.WriteString(fmt.Sprintf("| Extra Arguments | `%s` |\n", cfg.ExtraArgs))
+	}
+	summary.WriteString("\n")
+
+	// Add the steps of a multi-step run, or the prompt section
+	if len(result.Steps) > 0 {
+		writeStepsSummary(&summary, result.Steps)
+	} else {
+		summary.WriteString("### 📝 Input Prompt\n\n")
+		summary.WriteString(fmt.Sprintf("> %s\n\n", summaryPrompt(cfg.Prompt)))
+	}
+
+	// Compare the models of a model matrix side by side
+	if len(result.Models) > 0 {
+		writeModelsSummary(&summary, result.Models)
+	}
+
+	// Add result section with better formatting
+	summary.WriteString("### Output\n\n")
+	if exitCode == 0 {
+		displayResult := result.Output
+		if len(result.Output) > 3000 {
+			displayResult = result.Output[:3000] + "\n\n... *(Output truncated. See full output in action logs)*"
+		}
+
+		// Check if result contains markdown or code blocks
+		if strings.Contains(result.Output, "```") {
+			// Result already contains code blocks, display as-is
+			summary.WriteString(fmt.Sprintf("%s\n\n", displayResult))
+		} else if containsCode(result.Output) {
+			// Result looks like code, wrap in code block
+			summary.WriteString(fmt.Sprintf("```\n%s\n```\n\n", displayResult))
+		} else {
+			// Regular text result, format as blockquote for readability
+			lines := strings.Split(displayResult, "\n")
+			for _, line := range lines {
+				if strings.TrimSpace(line) != "" {
+					summary.WriteString(fmt.Sprintf("> %s\n", line))
+				} else {
+					summary.WriteString(">\n")
+				}
+			}
+			summary.WriteString("\n")
+		}
+	} else {
+		// Error output, always in code block
+		summary.WriteString("```\n")
+		summary.WriteString(truncateMiddle(result.Output, maxSummaryOutput))
+		summary.WriteString("\n```\n\n")
+		if result.Stderr != "" {
+			summary.WriteString("#### Stderr\n\n")
+			summary.WriteString(fmt.Sprintf("```\n%s\n```\n\n", summaryStderr(result.Stderr)))
+		}
+
+		// Add troubleshooting hints for common errors
+		if result.Cancelled {
+			summary.WriteString("#### 🛑 Cancellation Information\n\n")
+			summary.WriteString("- **Reason**: The run was cancelled before iFlow CLI finished, e.g. the workflow was cancelled\n")
+			summary.WriteString("- **Output**: The output above is what iFlow CLI produced before it was stopped\n")
+			summary.WriteString(fmt.Sprintf("- **Exit Code**: %d (cancelled)\n\n", ExitCodeCancelled))
+		} else if result.TimedOut {
+			summary.WriteString("#### ⏰ Timeout Information\n\n")
+			summary.WriteString(fmt.Sprintf("- **Configured Timeout**: %d seconds\n", cfg.Timeout))
+			summary.WriteString("- **Reason**: The iFlow CLI command did not complete within the specified timeout period\n")
+			summary.WriteString(fmt.Sprintf("- **Termination**: SIGTERM to iFlow CLI and its descendants, SIGKILL after %d seconds\n", cfg.KillGracePeriod))
+			summary.WriteString("- **Exit Code**: 124 (timeout)\n\n")
+
+			summary.WriteString("#### 🔧 Timeout Troubleshooting\n\n")
+			summary.WriteString("- **Increase timeout**: Consider increasing the timeout value if the task legitimately needs more time\n")
+			summary.WriteString("- **Optimize prompt**: Try breaking down complex prompts into smaller, more focused requests\n")
+			summary.WriteString("- **Check model performance**: Some models may require longer processing time\n")
+			summary.WriteString("- **Network issues**: Verify network connectivity and API response times\n")
+			summary.WriteString("- **Resource constraints**: Check if the system has sufficient resources (CPU, memory)\n\n")
+		} else if result.IdleTimedOut {
+			summary.WriteString("#### 💤 Idle Timeout Information\n\n")
+			summary.WriteString(fmt.Sprintf("- **Configured Idle Timeout**: %d seconds\n", cfg.IdleTimeout))
+			summary.WriteString("- **Reason**: iFlow CLI produced no output on stdout or stderr for the idle timeout, e.g. it was stuck waiting on an MCP server or the API\n")
+			summary.WriteString(fmt.Sprintf("- **Termination**: SIGTERM to iFlow CLI and its descendants, SIGKILL after %d seconds\n", cfg.KillGracePeriod))
+			summary.WriteString(fmt.Sprintf("- **Exit Code**: %d (idle timeout)\n\n", ExitCodeIdleTimeout))
+		} else if result.InvalidJSON {
+			summary.WriteString("#### 🧾 Invalid JSON Output\n\n")
+			summary.WriteString("iFlow CLI succeeded, but its output does not contain JSON matching `output_schema`:\n\n")
+			for _, problem := range result.JSONErrors {
+				summary.WriteString(fmt.Sprintf("- %s\n", problem))
+			}
+			summary.WriteString(fmt.Sprintf("\n- **Exit Code**: %d (invalid JSON)\n\n", ExitCodeInvalidJSON))
+		} else if strings.Contains(result.Output, "API Error") || strings.Contains(result.Stderr, "API Error") {
+			summary.WriteString("#### 🔧 Troubleshooting Hints\n\n")
+			summary.WriteString("- Check if your API key is valid and active\n")
+			summary.WriteString("- Verify the base URL is accessible\n")
+			summary.WriteString("- Ensure the selected model is available\n")
+			summary.WriteString("- Try increasing the timeout value\n\n")
+		}
+	}
+
+	// Show the structured answer extracted from the output
+	if result.JSON != "" {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(result.JSON), "", "  "); err != nil {
+			indented.Reset()
+			indented.WriteString(result.JSON)
+		}
+		summary.WriteString("### 🧾 JSON Output\n\n")
+		summary.WriteString(fmt.Sprintf("```json\n%s\n```\n\n", indented.String()))
+	}
+
+	// Show what iflow changed in the working tree
+	if result.Changes != nil {
+		writeChangesSummary(&summary, result.Changes)
+	}
+	if result.Commit != nil {
+		summary.WriteString("### 🌿 Commit\n\n")
+		pushed := ""
+		if result.Commit.Pushed {
+			pushed = " and pushed to `origin`"
+		}
+		summary.WriteString(fmt.Sprintf("Committed `%s` to the new branch `%s`%s.\n\n", result.Commit.SHA, result.Commit.Branch, pushed))
+		summary.WriteString(fmt.Sprintf("```\n%s\n```\n\n", result.Commit.Message))
+	}
+	if result.CommitError != "" {
+		if result.Commit == nil {
+			summary.WriteString("### 🌿 Commit\n\n")
+		}
+		summary.WriteString(fmt.Sprintf("❌ %s (exit code %d)\n\n", result.CommitError, ExitCodeCommitFailed))
+	}
+
+	// Keep warnings and debug logs of a successful run out of the way
+	if exitCode == 0 && result.Stderr != "" {
+		summary.WriteString("<details>\n<summary>Stderr</summary>\n\n")
+		summary.WriteString(fmt.Sprintf("```\n%s\n```\n\n</details>\n\n", summaryStderr(result.Stderr)))
+	}
+
+	// Add performance metrics if available
+	summary.WriteString("### 📈 Metrics\n\n")
+	executionTime := result.EndTime
+	if executionTime.IsZero() {
+		executionTime = time.Now()
+	}
+	summary.WriteString(fmt.Sprintf("- **Execution Time**: %s\n", executionTime.UTC().Format("2006-01-02 15:04:05 UTC")))
+	summary.WriteString(fmt.Sprintf("- **Output Length**: %d characters\n", len(result.Output)))
+	if result.Truncated {
+		summary.WriteString(fmt.Sprintf("- **Complete Output**: %d bytes, written to the `result_file` output\n", result.OutputSize))
+	}
+	if len(result.Attempts) > 1 {
+		summary.WriteString(fmt.Sprintf("- **Attempts**: %d\n", len(result.Attempts)))
+	}
+	if duration := result.Duration(); duration > 0 {
+		summary.WriteString(fmt.Sprintf("- **Wall Time**: %s\n", duration.Round(time.Millisecond)))
+	}
+	if usage := result.Usage; usage.UserCPU+usage.SystemCPU > 0 {
+		summary.WriteString(fmt.Sprintf("- **CPU Time**: %s user, %s system\n", usage.UserCPU.Round(time.Millisecond), usage.SystemCPU.Round(time.Millisecond)))
+	}
+	if result.Usage.PeakMemory > 0 {
+		summary.WriteString(fmt.Sprintf("- **Peak Memory**: %.1f MB\n", result.Usage.PeakMemoryMB()))
+	}
+	if result.Cancelled {
+		summary.WriteString("- **Success Rate**: 0% (Cancelled)\n\n")
+	} else if result.TimedOut {
+		summary.WriteString(fmt.Sprintf("- **Timeout Duration**: %d seconds\n", cfg.Timeout))
+		summary.WriteString("- **Success Rate**: 0% (Timeout)\n\n")
+	} else if result.IdleTimedOut {
+		summary.WriteString("- **Success Rate**: 0% (Idle Timeout)\n\n")
+	} else if exitCode == 0 {
+		summary.WriteString("- **Success Rate**: 100%\n\n")
+	} else {
+		summary.WriteString("- **Success Rate**: 0%\n\n")
+	}
+
+	// Add footer
+	summary.WriteString("---\n")
+	summary.WriteString("*🤖 Generated by [iFlow CLI Action](https://github.com/iflow-ai/iflow-cli-action)*\n\n")
+
+	return summary.String()
+}
+
+// writeStepsSummary adds a table with the outcome of each step, followed by
+// the prompt and output of every step that ran.
+func writeStepsSummary(summary *strings.Builder, steps []StepResult) {
+	summary.WriteString("### 🪜 Steps\n\n")
+	summary.WriteString("| Step | Status | Exit Code | Duration |\n")
+	summary.WriteString("|------|--------|-----------|----------|\n")
+	for _, step := range steps {
+		if step.Skipped {
+			summary.WriteString(fmt.Sprintf("| `%s` | ⏭️ Skipped | - | - |\n", step.Name))
+			continue
+		}
+		summary.WriteString(fmt.Sprintf("| `%s` | %s | %d | %s |\n",
+			step.Name, stepStatus(&step), step.ExitCode, step.Duration().Round(time.Millisecond)))
+	}
+	summary.WriteString("\n")
+
+	for _, step := range steps {
+		if step.Skipped {
+			continue
+		}
+		output := step.Output
+		if len(output) > 1000 {
+			output = output[:1000] + "\n... (truncated)"
+		}
+		summary.WriteString(fmt.Sprintf("<details>\n<summary>Step <code>%s</code></summary>\n\n", step.Name))
+		summary.WriteString(fmt.Sprintf("> %s\n\n", summaryPrompt(step.Prompt)))
+		summary.WriteString(fmt.Sprintf("```\n%s\n```\n\n</details>\n\n", output))
+	}
+}
+
+// writeModelsSummary adds a table with one column per model comparing
+// their outcome, duration and output.
+func writeModelsSummary(summary *strings.Builder, models []ModelResult) {
+	summary.WriteString("### ⚖️ Model Comparison\n\n")
+
+	rows := []struct {
+		label string
+		value func(model *ModelResult) string
+	}{
+		{"Status", func(model *ModelResult) string { return outcomeStatus(model.Outcome()) }},
+		{"Exit Code", func(model *ModelResult) string { return fmt.Sprintf("%d", model.ExitCode) }},
+		{"Duration", func(model *ModelResult) string { return model.Duration().Round(time.Millisecond).String() }},
+		{"Attempts", func(model *ModelResult) string { return fmt.Sprintf("%d", len(model.Attempts)) }},
+		{"Output Length", func(model *ModelResult) string { return fmt.Sprintf("%d characters", len(model.Output)) }},
+		{"Output", func(model *ModelResult) string { return tableCell(model.Output, 500) }},
+	}
+
+	summary.WriteString("| |")
+	for _, model := range models {
+		summary.WriteString(fmt.Sprintf(" `%s` |", model.Model))
+	}
+	summary.WriteString("\n|---|")
+	summary.WriteString(strings.Repeat("---|", len(models)))
+	summary.WriteString("\n")
+	for _, row := range rows {
+		summary.WriteString(fmt.Sprintf("| **%s** |", row.label))
+		for i := range models {
+			summary.WriteString(fmt.Sprintf(" %s |", row.value(&models[i])))
+		}
+		summary.WriteString("\n")
+	}
+	summary.WriteString("\n")
+}
+
+// maxChangedFileRows caps the rows of the changed files table.
+const maxChangedFileRows = 100
+
+// writeChangesSummary adds a diff stat of the files changed by iflow.
+func writeChangesSummary(summary *strings.Builder, changes *Changes) {
+	summary.WriteString("### 📝 Changed Files\n\n")
+	if len(changes.Files) == 0 {
+		summary.WriteString("No files were changed.\n\n")
+		return
+	}
+
+	additions, deletions := changes.Lines()
+	summary.WriteString(fmt.Sprintf("%d files changed, %d insertions(+), %d deletions(-)\n\n", len(changes.Files), additions, deletions))
+	summary.WriteString("| File | Status | Additions | Deletions |\n")
+	summary.WriteString("|------|--------|-----------|-----------|\n")
+	for i, file := range changes.Files {
+		if i == maxChangedFileRows {
+			summary.WriteString(fmt.Sprintf("| ... and %d more | | | |\n", len(changes.Files)-i))
+			break
+		}
+		added, deleted := fmt.Sprintf("+%d", file.Additions), fmt.Sprintf("-%d", file.Deletions)
+		if file.Binary {
+			added, deleted = "binary", "binary"
+		}
+		summary.WriteString(fmt.Sprintf("| `%s` | %s | %s | %s |\n", tableCell(file.Path, 200), changeStatus(file.Status), added, deleted))
+	}
+	summary.WriteString("\n")
+}
+
+// changeStatus describes the status of a changed file.
+func changeStatus(status string) string {
+	switch status {
+	case ChangeAdded:
+		return "🟢 Added"
+	case ChangeDeleted:
+		return "🔴 Deleted"
+	default:
+		return "🟡 Modified"
+	}
+}
+
+// tableCell shortens text to limit characters and escapes it for a
+// markdown table cell.
+func tableCell(text string, limit int) string {
+	text = strings.TrimSpace(text)
+	if len(text) > limit {
+		text = text[:limit] + "..."
+	}
+	text = strings.ReplaceAll(text, "|", "\\|")
+	return strings.ReplaceAll(text, "\n", "<br>")
+}
+
+// stepStatus describes a step's outcome for the steps table.
+func stepStatus(step *StepResult) string {
+	if step.ContinueOnError && step.Outcome() == OutcomeFailure {
+		return "⚠️ Failed (continued)"
+	}
+	return outcomeStatus(step.Outcome())
+}
+
+// outcomeStatus describes one of the Outcome* constants for the steps and
+// models tables.
+func outcomeStatus(outcome string) string {
+	switch outcome {
+	case OutcomeCancelled:
+		return "🛑 Cancelled"
+	case OutcomeTimeout:
+		return "⏰ Timed Out"
+	case OutcomeIdleTimeout:
+		return "💤 Idle Timeout"
+	case OutcomeInvalidJSON:
+		return "🧾 Invalid JSON"
+	case OutcomeFailure:
+		return "❌ Failed"
+	case OutcomeSkipped:
+		return "⏭️ Skipped"
+	default:
+		return "✅ Succeeded"
+	}
+}
+
+// summaryStderr shortens stderr for the summary, keeping its end, where
+// errors usually are.
+func summaryStderr(stderr string) string {
+	if len(stderr) > 3000 {
+		return "... (truncated)\n" + stderr[len(stderr)-3000:]
+	}
+	return stderr
+}
+
+// summaryPrompt shortens a prompt and escapes it for a blockquote.
+func summaryPrompt(prompt string) string {
+	if len(prompt) > 300 {
+		prompt = prompt[:300] + "..."
+	}
+	// Escape any markdown characters in the prompt
+	return strings.ReplaceAll(prompt, "`", "\\`")
+}
+
+// Helper function to detect if text looks like code
+func containsCode(text string) bool {
+	codeIndicators := []string{
+		"function", "class", "def ", "import ", "const ", "let ", "var ",
+		"public ", "private ", "protected", "return ", "if (", "for (", "while (",
+		"{", "}", ";", "//", "/*", "*/", "#include", "package ", "use ",
+	}
+
+	lowerText := strings.ToLower(text)
+	for _, indicator := range codeIndicators {
+		if strings.Contains(lowerText, indicator) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package action
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Modes of a run.
+const (
+	ModeDirect = "direct" // iflow edits the working directory
+	ModePatch  = "patch"  // iflow edits a throwaway copy; only the patch of its changes is kept
+)
+
+// validateMode returns every problem with mode.
+func (c *Config) validateMode() []error {
+	var problems []error
+	switch c.Mode {
+	case "", ModeDirect:
+	case ModePatch:
+		if !c.DetectChanges {
+			problems = append(problems, fmt.Errorf("mode %s requires detect_changes", ModePatch))
+		}
+	default:
+		problems = append(problems, fmt.Errorf("invalid mode value %q (expected %s or %s)", c.Mode, ModeDirect, ModePatch))
+	}
+	return problems
+}
+
+// workingDir returns the directory precmd and iflow run in.
+func (r *run) workingDir() string {
+	if r.workspace != "" {
+		return r.workspace
+	}
+	return r.cfg.WorkingDir
+}
+
+// setupPatchWorkspace gives iflow a throwaway copy of the working directory
+// to edit: in a repository a detached worktree of HEAD with the uncommitted
+// changes copied over, otherwise a plain copy. The copy is removed when the
+// run finishes, leaving only the patch of the changes behind.
+func (r *run) setupPatchWorkspace() error {
+	dir, err := filepath.Abs(r.cfg.WorkingDir)
+	if err == nil {
+		dir, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+
+	parent, err := os.MkdirTemp(tempParent(), "iflow-workspace-")
+	if err != nil {
+		return fmt.Errorf("failed to create patch workspace: %w", err)
+	}
+	r.addCleanup(func() { os.RemoveAll(parent) })
+	copyDir := filepath.Join(parent, "workspace")
+
+	top, err := gitOutput(dir, nil, "rev-parse", "--show-toplevel")
+	if err == nil {
+		_, err = gitOutput(dir, nil, "rev-parse", "--verify", "--quiet", "HEAD")
+	}
+	if err != nil {
+		// Not a repository, or one without commits to check out
+		if err := copyTree(dir, copyDir, parent); err != nil {
+			return fmt.Errorf("failed to copy working directory: %w", err)
+		}
+		r.workspace = copyDir
+		r.info(fmt.Sprintf("Running in patch mode in a copy of the working directory at %s", copyDir))
+		return nil
+	}
+
+	if _, err := gitOutput(top, nil, "worktree", "add", "--detach", "--quiet", copyDir, "HEAD"); err != nil {
+		return fmt.Errorf("failed to create patch workspace: %w", err)
+	}
+	r.addCleanup(func() {
+		if _, err := gitOutput(top, nil, "worktree", "remove", "--force", copyDir); err != nil {
+			r.info(fmt.Sprintf("Warning: failed to remove the patch workspace: %v", err))
+		}
+	})
+	if err := copyUncommitted(top, copyDir); err != nil {
+		return fmt.Errorf("failed to copy uncommitted changes to the patch workspace: %w", err)
+	}
+
+	rel, err := filepath.Rel(top, dir)
+	if err != nil {
+		return fmt.Errorf("failed to resolve working directory: %w", err)
+	}
+	r.workspace = filepath.Join(copyDir, rel)
+	r.info(fmt.Sprintf("Running in patch mode in a worktree of %s at %s", top, copyDir))
+	return nil
+}
+
+// copyUncommitted makes the files of worktree match the modified, deleted
+// and untracked files of the working tree at top. Ignored files are not
+// copied.
+func copyUncommitted(top, worktree string) error {
+	status, err := gitOutput(top, nil, "status", "--porcelain", "-z", "--untracked-files=all", "--no-renames")
+	if err != nil {
+		return err
+	}
+	for _, entry := range strings.Split(status, "\x00") {
+		if len(entry) < 4 {
+			continue
+		}
+		name := filepath.FromSlash(entry[3:])
+		src, dst := filepath.Join(top, name), filepath.Join(worktree, name)
+
+		info, err := os.Lstat(src)
+		if os.IsNotExist(err) {
+			if err := os.RemoveAll(dst); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			// Submodules are checked out by themselves
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return err
+		}
+		if err := os.RemoveAll(dst); err != nil {
+			return err
+		}
+		if err := copyEntry(src, dst, info); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyTree copies the directory src to dst, leaving out skip.
+func copyTree(src, dst, skip string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == skip {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if entry.IsDir() {
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		}
+		return copyEntry(path, target, info)
+	})
+}
+
+// copyEntry copies a regular file or a symbolic link. Other files such as
+// sockets are skipped.
+func copyEntry(src, dst string, info fs.FileInfo) error {
+	switch {
+	case info.Mode()&fs.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		return os.Symlink(target, dst)
+	case info.Mode().IsRegular():
+		return copyFile(src, dst)
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package action
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{name: "default", cfg: Config{}},
+		{name: "direct", cfg: Config{Mode: ModeDirect}},
+		{name: "patch", cfg: Config{Mode: ModePatch, DetectChanges: true}},
+		{name: "patch without detection", cfg: Config{Mode: ModePatch}, expected: "mode patch requires detect_changes"},
+		{name: "unknown", cfg: Config{Mode: "dry-run"}, expected: `invalid mode value "dry-run"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := tt.cfg.validateMode()
+			if tt.expected == "" {
+				if len(problems) != 0 {
+					t.Errorf("Expected no problems, got %v", problems)
+				}
+				return
+			}
+			if len(problems) != 1 || !strings.Contains(problems[0].Error(), tt.expected) {
+				t.Errorf("Expected a problem containing %q, got %v", tt.expected, problems)
+			}
+		})
+	}
+}
+
+// inspectingExecutor is a writingExecutor that also records the directory
+// iflow ran in and the content it found there.
+type inspectingExecutor struct {
+	writingExecutor
+	inspect string
+	dir     string
+	found   string
+}
+
+func (e *inspectingExecutor) Run(ctx context.Context, cmd Command) (int, error) {
+	if cmd.Name == "iflow" && cmd.Args[0] != "--version" {
+		e.dir = cmd.Dir
+		data, _ := os.ReadFile(filepath.Join(cmd.Dir, e.inspect))
+		e.found = string(data)
+	}
+	return e.writingExecutor.Run(ctx, cmd)
+}
+
+func TestRunnerRunPatchMode(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	tests := []struct {
+		name      string
+		repo      bool
+		container bool
+		expected  []string
+	}{
+		{name: "repository", repo: true, expected: []string{"src/fix.go", "src/main.go"}},
+		{name: "plain directory", expected: []string{"fix.go", "main.go"}},
+		{name: "repository in the action's container", repo: true, container: true, expected: []string{"src/fix.go", "src/main.go"}},
+		{name: "plain directory in the action's container", container: true, expected: []string{"fix.go", "main.go"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("RUNNER_TEMP", t.TempDir())
+			parent := os.Getenv("RUNNER_TEMP")
+			var mounted string
+			if tt.container {
+				mounted = containerLayout(t)
+				parent = githubHome
+			}
+			top := t.TempDir()
+			dir := top
+			if tt.repo {
+				dir = filepath.Join(top, "src")
+			}
+			writeFiles(t, dir, map[string]string{
+				"main.go":  "package main\n",
+				"notes.md": "committed\n",
+			})
+			if tt.repo {
+				runGit(t, top, "init", "--quiet")
+				runGit(t, top, "add", "--all")
+				runGit(t, top, "commit", "--quiet", "-m", "Initial commit")
+			}
+			// Uncommitted changes are part of the workspace, not of the patch
+			writeFiles(t, dir, map[string]string{"notes.md": "uncommitted\n", "todo.md": "untracked\n"})
+
+			executor := &inspectingExecutor{
+				writingExecutor: writingExecutor{files: map[string]string{
+					"main.go": "package main\n\nfunc main() {}\n",
+					"fix.go":  "package main\n",
+				}},
+				inspect: "notes.md",
+			}
+			runner := &Runner{
+				Executor: executor,
+				Logger:   ConsoleLogger{Out: io.Discard},
+				Stdout:   io.Discard,
+				Stderr:   io.Discard,
+			}
+			cfg := DefaultConfig()
+			cfg.Prompt = "Fix the bug"
+			cfg.APIKey = "sk-test"
+			cfg.WorkingDir = dir
+			cfg.Mode = ModePatch
+
+			result, err := runner.Run(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !strings.HasPrefix(executor.dir, parent) {
+				t.Errorf("Expected iflow to run in a copy of %s, ran in %s", dir, executor.dir)
+			}
+			if executor.found != "uncommitted\n" {
+				t.Errorf("Expected the workspace to contain the uncommitted changes, found %q", executor.found)
+			}
+			if _, err := os.Stat(executor.dir); !os.IsNotExist(err) {
+				t.Errorf("Expected the workspace to be removed, got %v", err)
+			}
+
+			// The working directory is left untouched
+			if _, err := os.Stat(filepath.Join(dir, "fix.go")); !os.IsNotExist(err) {
+				t.Errorf("Expected fix.go not to be written to the working directory")
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, "main.go")); string(data) != "package main\n" {
+				t.Errorf("Expected main.go to be unchanged, got %q", data)
+			}
+
+			if result.Changes == nil {
+				t.Fatalf("Expected changes to be detected")
+			}
+			if paths := result.Changes.Paths(""); !reflect.DeepEqual(paths, tt.expected) {
+				t.Errorf("Expected changed files %v, got %v", tt.expected, paths)
+			}
+
+			// The patch applies to the working directory
+			patch := result.Changes.PatchFile
+			if tt.container {
+				patch = mountedPath(t, mounted, patch)
+			}
+			runGit(t, top, "apply", "--check", patch)
+			if tt.repo {
+				if worktrees := runGit(t, top, "worktree", "list"); strings.Count(worktrees, "\n") != 1 {
+					t.Errorf("Expected the worktree to be removed, got %q", worktrees)
+				}
+			}
+		})
+	}
+}
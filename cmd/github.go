@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iflow-ai/iflow-cli-action/action"
+)
+
+func isGitHubActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// Helper functions for GitHub Actions
+func getInput(name string) string {
+	// GitHub Actions sets inputs as environment variables with INPUT_ prefix
+	envName := "INPUT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+	return os.Getenv(envName)
+}
+
+// parseBoolInput parses a boolean action input such as "true" or "false"
+func parseBoolInput(name, value string) (bool, error) {
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("invalid %s value: '%s'. Must be true or false", name, value)
+	}
+	return parsed, nil
+}
+
+func setOutput(name, value string) {
+	// Keep every output below the size GitHub accepts
+	value = action.LimitOutput(value)
+
+	// GitHub Actions outputs can be set using the GITHUB_OUTPUT file
+	if outputFile := os.Getenv("GITHUB_OUTPUT"); outputFile != "" {
+		f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			fmt.Printf("::error::Failed to open output file: %v\n", err)
+			return
+		}
+		defer f.Close()
+
+		// Use proper GitHub Actions output format with multiline support
+		delimiter := fmt.Sprintf("EOF_%d", os.Getpid())
+		_, err = f.WriteString(fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter))
+		if err != nil {
+			fmt.Printf("::error::Failed to write output: %v\n", err)
+		}
+	} else {
+		// Fallback to legacy format if GITHUB_OUTPUT is not available
+		fmt.Printf("::set-output name=%s::%s\n", name, value)
+	}
+}
+
+func writeStepSummary(cfg action.Config, result *action.Result) error {
+	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
+	if summaryFile == "" {
+		// Not in GitHub Actions environment or summary not supported
+		return nil
+	}
+
+	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open step summary file: %w", err)
+	}
+	defer f.Close()
+
+	// Write summary in Markdown format
+	_, err = f.WriteString(action.GenerateSummaryMarkdown(cfg, result))
+	if err != nil {
+		return fmt.Errorf("failed to write to step summary: %w", err)
+	}
+
+	return nil
+}
+
+// githubSink sets the action outputs and writes the step summary.
+type githubSink struct{}
+
+// Publish implements action.Sink.
+func (githubSink) Publish(cfg action.Config, result *action.Result) error {
+	setOutput("result", result.Output)
+	setOutput("stderr", result.Stderr)
+	setOutput("exit_code", fmt.Sprintf("%d", result.ExitCode))
+	setOutput("result_file", result.OutputFile)
+	setOutput("log_file", result.LogFile)
+	if result.TranscriptFile != "" {
+		setOutput("transcript_file", result.TranscriptFile)
+	}
+	if result.ReportFile != "" {
+		setOutput("report_file", result.ReportFile)
+	}
+	if cfg.OutputSchema != "" {
+		setOutput("json", result.JSON)
+	}
+	if result.Changes != nil {
+		setOutput("changed_files", strings.Join(result.Changes.Paths(""), "\n"))
+		setOutput("added", strings.Join(result.Changes.Paths(action.ChangeAdded), "\n"))
+		setOutput("modified", strings.Join(result.Changes.Paths(action.ChangeModified), "\n"))
+		setOutput("deleted", strings.Join(result.Changes.Paths(action.ChangeDeleted), "\n"))
+		setOutput("patch_file", result.Changes.PatchFile)
+	}
+	if result.Commit != nil {
+		setOutput("commit_sha", result.Commit.SHA)
+		setOutput("branch", result.Commit.Branch)
+	}
+	setOutput("peak_memory_mb", fmt.Sprintf("%.1f", result.Usage.PeakMemoryMB()))
+	setOutput("cpu_user_seconds", fmt.Sprintf("%.3f", result.Usage.UserCPU.Seconds()))
+	setOutput("cpu_system_seconds", fmt.Sprintf("%.3f", result.Usage.SystemCPU.Seconds()))
+	setOutput("wall_time_seconds", fmt.Sprintf("%.3f", result.Duration().Seconds()))
+	if len(result.Steps) > 0 {
+		steps, err := action.StepsJSON(result.Steps)
+		if err != nil {
+			return fmt.Errorf("failed to format steps output: %w", err)
+		}
+		setOutput("steps", steps)
+	}
+	if len(result.Models) > 0 {
+		models, err := action.ModelsJSON(result.Models)
+		if err != nil {
+			return fmt.Errorf("failed to format models output: %w", err)
+		}
+		setOutput("models", models)
+	}
+
+	fmt.Println(result.Output)
+
+	// Write to GitHub Actions step summary
+	return writeStepSummary(cfg, result)
+}
+
+// consoleSink prints the result in CLI mode.
+type consoleSink struct{}
+
+// Publish implements action.Sink.
+func (consoleSink) Publish(cfg action.Config, result *action.Result) error {
+	for _, step := range result.Steps {
+		fmt.Printf("Step %s: %s (exit code %d)\n", step.Name, step.Outcome(), step.ExitCode)
+	}
+	for _, model := range result.Models {
+		fmt.Printf("Model %s: %s (exit code %d, %s)\n", model.Model, model.Outcome(), model.ExitCode, model.Duration().Round(time.Millisecond))
+	}
+	fmt.Printf("Exit Code: %d\n", result.ExitCode)
+	fmt.Printf("Resources: %s wall, %s user CPU, %s system CPU, %.1f MB peak memory\n",
+		result.Duration().Round(time.Millisecond), result.Usage.UserCPU.Round(time.Millisecond),
+		result.Usage.SystemCPU.Round(time.Millisecond), result.Usage.PeakMemoryMB())
+	if result.OutputDir != "" {
+		fmt.Printf("Output Directory: %s (kept, remove it when done)\n", result.OutputDir)
+	}
+	if result.LogFile != "" {
+		fmt.Printf("Log File: %s\n", result.LogFile)
+	}
+	if result.TranscriptFile != "" {
+		fmt.Printf("Transcript File: %s\n", result.TranscriptFile)
+	}
+	if result.ReportFile != "" {
+		fmt.Printf("Report File: %s\n", result.ReportFile)
+	}
+	if result.Changes != nil {
+		fmt.Printf("Changed Files: %d\n", len(result.Changes.Files))
+		for _, file := range result.Changes.Files {
+			fmt.Printf("  %s %s\n", strings.ToUpper(file.Status[:1]), file.Path)
+		}
+		if result.Changes.PatchFile != "" {
+			fmt.Printf("Patch File: %s\n", result.Changes.PatchFile)
+		}
+	}
+	if result.Commit != nil {
+		fmt.Printf("Commit: %s on branch %s\n", result.Commit.SHA, result.Commit.Branch)
+	}
+	if result.JSON != "" {
+		fmt.Printf("JSON: %s\n", result.JSON)
+	}
+	for _, problem := range result.JSONErrors {
+		fmt.Printf("JSON Error: %s\n", problem)
+	}
+	fmt.Printf("Result:\n%s\n", result.Output)
+	return nil
+}
@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iflow-ai/iflow-cli-action/action"
+	"github.com/spf13/cobra"
+)
+
+// summaryCmd renders the step summary again from a run report
+var summaryCmd = &cobra.Command{
+	Use:   "summary <report-file>",
+	Short: "Render the step summary of a run from its JSON report",
+	Long: `Read a report written with --report-file / report_file and print the step
+summary Markdown of that run. With --step-summary it is appended to
+GITHUB_STEP_SUMMARY instead, e.g. from a later job.`,
+	Args:         cobra.ExactArgs(1),
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := action.ReadReport(args[0])
+		if err != nil {
+			return err
+		}
+		if stepSummary {
+			if os.Getenv("GITHUB_STEP_SUMMARY") == "" {
+				return fmt.Errorf("GITHUB_STEP_SUMMARY is not set")
+			}
+			return writeStepSummary(report.Config, report.Result())
+		}
+		fmt.Fprint(cmd.OutOrStdout(), action.GenerateSummaryMarkdown(report.Config, report.Result()))
+		return nil
+	},
+}
+
+var stepSummary bool
+
+func init() {
+	summaryCmd.Flags().BoolVar(&stepSummary, "step-summary", false, "Append the summary to GITHUB_STEP_SUMMARY instead of printing it")
+	rootCmd.AddCommand(summaryCmd)
+}
@@ -1,50 +1,26 @@
 package cmd
 
 import (
-	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"os/signal"
 	"strconv"
 	"strings"
-	"sync"
-	"time"
+	"syscall"
 
+	"github.com/iflow-ai/iflow-cli-action/action"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-// Config holds all configuration options
-type Config struct {
-	Prompt       string
-	APIKey       string
-	SettingsJSON string
-	BaseURL      string
-	Model        string
-	WorkingDir   string
-	Timeout      int
-	ExtraArgs    string // Additional command line arguments for iFlow CLI
-	PreCmd       string // Shell command(s) to execute before running iFlow CLI
-	UseEnvVars   bool   // Flag to indicate whether to use environment variables (GitHub Actions mode)
-	IsTimeout    bool   // Flag to indicate if execution timed out
-}
-
-// IFlowSettings represents the iFlow configuration
-type IFlowSettings struct {
-	Theme            string `json:"theme"`
-	SelectedAuthType string `json:"selectedAuthType"`
-	APIKey           string `json:"apiKey"`
-	BaseURL          string `json:"baseUrl"`
-	ModelName        string `json:"modelName"`
-	SearchAPIKey     string `json:"searchApiKey"`
-}
-
-var config Config
+var (
+	config     action.Config
+	stepsYAML  string // Value of --steps, parsed into config.Steps
+	useEnvVars bool   // Use environment variables for configuration (GitHub Actions mode)
+)
 
 // For testing purposes, expose the config
-func GetConfig() Config {
+func GetConfig() action.Config {
 	return config
 }
 
@@ -56,9 +32,14 @@ var rootCmd = &cobra.Command{
 	
 This tool can run in two modes:
 1. GitHub Actions mode: Uses environment variables (INPUT_*) for configuration
-2. CLI mode: Uses command-line flags for configuration`,
+2. CLI mode: Uses command-line flags for configuration
+
+Configuration is layered in the following order, later sources winning:
+defaults < config file (--config / config_file) < selected profile (--profile / profile)
+< INPUT_* variables < explicit flags`,
+	SilenceUsage: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runIFlowAction()
+		return runIFlowAction(cmd)
 	},
 }
 
@@ -66,635 +47,645 @@ This tool can run in two modes:
 func Execute() {
 	err := rootCmd.Execute()
 	if err != nil {
+		if actionsMode() {
+			fmt.Printf("::error::%s\n", err)
+		}
 		os.Exit(1)
 	}
 }
 
 func init() {
 	// Define flags
-	rootCmd.Flags().StringVarP(&config.Prompt, "prompt", "p", "", "The prompt to send to iFlow CLI (required in CLI mode)")
-	rootCmd.Flags().StringVar(&config.APIKey, "api-key", "", "API key for iFlow authentication")
-	rootCmd.Flags().StringVar(&config.SettingsJSON, "settings-json", "", "Complete settings JSON configuration")
-	rootCmd.Flags().StringVar(&config.BaseURL, "base-url", "https://apis.iflow.cn/v1", "Base URL for the iFlow API")
-	rootCmd.Flags().StringVar(&config.Model, "model", "Qwen3-Coder", "Model name to use")
-	rootCmd.Flags().StringVar(&config.WorkingDir, "working-directory", ".", "Working directory for execution")
-	rootCmd.Flags().IntVar(&config.Timeout, "timeout", 3600, "Timeout in seconds (1-86400)")
-	rootCmd.Flags().StringVar(&config.ExtraArgs, "extra-args", "", "Additional command line arguments to pass to iFlow CLI")
-	rootCmd.Flags().StringVar(&config.PreCmd, "precmd", "", "Shell command(s) to execute before running iFlow CLI")
-	rootCmd.Flags().BoolVar(&config.UseEnvVars, "use-env-vars", false, "Use environment variables for configuration (GitHub Actions mode)")
+	rootCmd.PersistentFlags().StringVarP(&config.Prompt, "prompt", "p", "", "The prompt to send to iFlow CLI (required in CLI mode)")
+	rootCmd.PersistentFlags().StringVar(&config.PromptFile, "prompt-file", "", "Path to a file containing the prompt (rendered as a Go template)")
+	rootCmd.PersistentFlags().BoolVar(&config.RenderPrompt, "render-prompt", false, "Render the inline prompt as a Go template against the GitHub event payload")
+	rootCmd.PersistentFlags().StringVar(&config.APIKey, "api-key", "", "API key for iFlow authentication")
+	rootCmd.PersistentFlags().StringVar(&config.SettingsJSON, "settings-json", "", "Complete settings JSON configuration")
+	rootCmd.PersistentFlags().StringVar(&config.SettingsFile, "settings-file", "", "Path to a settings.json template, used when settings-json is empty")
+	rootCmd.PersistentFlags().StringVar(&config.SettingsMerge, "settings-merge", action.SettingsMergeReplace, "How settings-json combines with individual flags: replace, json-over-inputs or inputs-over-json")
+	rootCmd.PersistentFlags().BoolVar(&config.PrintSettings, "print-settings", false, "Print the effective settings.json with secrets redacted")
+	rootCmd.PersistentFlags().BoolVar(&config.RestoreSettings, "restore-settings", true, "Restore the original ~/.iflow/settings.json on exit")
+	rootCmd.PersistentFlags().BoolVar(&config.MergeExistingSettings, "merge-existing-settings", false, "Merge with the existing ~/.iflow/settings.json instead of overwriting it")
+	rootCmd.PersistentFlags().BoolVar(&config.IsolatedHome, "isolated-home", false, "Run iFlow with a temporary per-run home directory")
+	rootCmd.PersistentFlags().StringVar(&config.BaseURL, "base-url", action.DefaultBaseURL, "Base URL for the iFlow API")
+	rootCmd.PersistentFlags().StringVar(&config.Model, "model", action.DefaultModel, "Model name to use")
+	rootCmd.PersistentFlags().StringVar(&config.WorkingDir, "working-directory", action.DefaultWorkingDir, "Working directory for execution")
+	rootCmd.PersistentFlags().IntVar(&config.Timeout, "timeout", action.DefaultTimeout, "Timeout in seconds (1-86400)")
+	rootCmd.PersistentFlags().IntVar(&config.IdleTimeout, "idle-timeout", 0, "Stop iFlow CLI after this many seconds without output (0 disables)")
+	rootCmd.PersistentFlags().IntVar(&config.KillGracePeriod, "kill-grace-period", action.DefaultKillGracePeriod, "Seconds iFlow CLI and its descendants get to exit after SIGTERM before they are killed (0-300)")
+	rootCmd.PersistentFlags().IntVar(&config.Retries, "retries", 0, "How many times to re-run iFlow CLI after a retryable failure (0-10)")
+	rootCmd.PersistentFlags().IntVar(&config.RetryBackoff, "retry-backoff", action.DefaultRetryBackoff, "Base delay in seconds before the first retry, doubled for each further retry")
+	rootCmd.PersistentFlags().StringArrayVar(&config.RetryOn, "retry-on", nil, "Exit code or output regular expression that makes a failure retryable (repeatable; default: any failure)")
+	rootCmd.PersistentFlags().IntVar(&config.MaxOutputSize, "max-output-size", action.DefaultMaxOutputSize, "Bytes of iFlow CLI output kept in memory; the complete output is written to a log file")
+	rootCmd.PersistentFlags().BoolVar(&config.Transcript, "transcript", false, "Write a timestamped transcript of stdout and stderr lines")
+	rootCmd.PersistentFlags().StringVar(&config.ReportFile, "report-file", "", "Write a JSON report of the run to this path")
+	rootCmd.PersistentFlags().StringVar(&config.OutputSchema, "output-schema", "", "JSON Schema, inline or a file path, that the last JSON object in the output must match")
+	rootCmd.PersistentFlags().IntVar(&config.JSONRetries, "json-retries", 0, "How often to ask iFlow CLI to rewrite its answer when its JSON answer is missing or invalid (0-5)")
+	rootCmd.PersistentFlags().StringVar(&config.Mode, "mode", action.ModeDirect, "direct lets iFlow CLI edit the working directory; patch runs it in a throwaway copy and only returns the patch")
+	rootCmd.PersistentFlags().BoolVar(&config.CommitChanges, "commit-changes", false, "Commit the changes of a successful run to a new local branch")
+	rootCmd.PersistentFlags().StringVar(&config.BranchName, "branch-name", action.DefaultBranchName, "Template of the name of the new branch")
+	rootCmd.PersistentFlags().StringVar(&config.CommitMessage, "commit-message", action.DefaultCommitMessage, "Template of the commit message")
+	rootCmd.PersistentFlags().BoolVar(&config.GenerateCommitMessage, "generate-commit-message", false, "Let iFlow CLI write the commit message from the patch")
+	rootCmd.PersistentFlags().StringVar(&config.CommitAuthorName, "commit-author-name", action.DefaultCommitAuthorName, "Name of the commit author and committer")
+	rootCmd.PersistentFlags().StringVar(&config.CommitAuthorEmail, "commit-author-email", action.DefaultCommitAuthorEmail, "Email of the commit author and committer")
+	rootCmd.PersistentFlags().BoolVar(&config.CommitSignoff, "commit-signoff", false, "Add a Signed-off-by trailer to the commit message")
+	rootCmd.PersistentFlags().BoolVar(&config.PushChanges, "push-changes", false, "Push the new branch to origin after committing")
+	rootCmd.PersistentFlags().BoolVar(&config.DetectChanges, "detect-changes", true, "Report the files iFlow CLI changes in the working directory and write a patch of them")
+	rootCmd.PersistentFlags().BoolVar(&config.UsePTY, "use-pty", false, "Run iFlow CLI on a pseudo-terminal instead of pipes (Linux only)")
+	rootCmd.PersistentFlags().BoolVar(&config.StripANSI, "strip-ansi", true, "Remove terminal escape sequences from the result, output files and summary")
+	rootCmd.PersistentFlags().IntVar(&config.MaxMemoryMB, "max-memory-mb", 0, "Memory limit in MB for iFlow CLI and its descendants (0 is unlimited)")
+	rootCmd.PersistentFlags().IntVar(&config.MaxCPUSeconds, "max-cpu-seconds", 0, "CPU time limit in seconds for iFlow CLI (0 is unlimited)")
+	rootCmd.PersistentFlags().IntVar(&config.MaxOpenFiles, "max-open-files", 0, "Open file descriptor limit for iFlow CLI (0 is unlimited)")
+	rootCmd.PersistentFlags().StringVar(&config.ExtraArgs, "extra-args", "", "Additional command line arguments to pass to iFlow CLI")
+	rootCmd.PersistentFlags().StringVar(&config.PreCmd, "precmd", "", "Shell command(s) to execute before running iFlow CLI")
+	rootCmd.PersistentFlags().StringArrayVar(&config.MaskValues, "mask-value", nil, "Value to mask in logs, outputs and the summary (repeatable)")
+	rootCmd.PersistentFlags().StringArrayVar(&config.RedactPatterns, "redact-pattern", nil, "Regular expression to redact from logs, outputs and the summary (repeatable)")
+	rootCmd.PersistentFlags().StringVar(&stepsYAML, "steps", "", "YAML list of steps to run one after another instead of --prompt")
+	rootCmd.PersistentFlags().StringSliceVar(&config.Models, "models", nil, "Models to run the prompt against for a side-by-side comparison (comma-separated or repeatable)")
+	rootCmd.PersistentFlags().IntVar(&config.ModelConcurrency, "model-concurrency", action.DefaultModelConcurrency, "How many models of --models run at the same time (1-10); above 1 requires --mode patch")
+	rootCmd.PersistentFlags().StringVar(&config.ConfigFile, "config", "", "Path to a YAML or TOML config file with shared defaults")
+	rootCmd.PersistentFlags().StringVar(&config.Profile, "profile", "", "Name of a profile from the config file to apply")
+	rootCmd.PersistentFlags().BoolVar(&useEnvVars, "use-env-vars", false, "Use environment variables for configuration (GitHub Actions mode)")
 
 	// Mark required flags only if not in GitHub Actions mode - this will be validated later
 }
 
-func runIFlowAction() error {
-	// Print iFlow CLI version
-	printIFlowVersion()
+// actionsMode reports whether the command runs as a GitHub Action.
+func actionsMode() bool {
+	return useEnvVars || isGitHubActions()
+}
 
-	// If use-env-vars is set or we detect GitHub Actions environment, use environment variables
-	if config.UseEnvVars || isGitHubActions() {
-		if err := loadConfigFromEnv(); err != nil {
-			return fmt.Errorf("failed to load config from environment: %w", err)
-		}
-	}
+func runIFlowAction(cmd *cobra.Command) error {
+	logger := action.ConsoleLogger{Out: os.Stdout, GitHub: actionsMode()}
 
-	// Validate configuration
-	if err := validateConfig(); err != nil {
+	cfg, err := resolveConfig(cmd.Flags(), config, logger)
+	if err != nil {
 		return err
 	}
 
-	// Setup working directory
-	if config.WorkingDir != "." && config.WorkingDir != "" {
-		if err := os.Chdir(config.WorkingDir); err != nil {
-			return fmt.Errorf("failed to change working directory: %w", err)
-		}
+	runner := action.NewRunner()
+	runner.Logger = logger
+	if actionsMode() {
+		runner.Sinks = []action.Sink{githubSink{}}
+	} else {
+		runner.Sinks = []action.Sink{consoleSink{}}
 	}
 
+	// Stop iflow, publish a partial result and undo changes to the machine
+	// when the job is cancelled. A second signal terminates immediately.
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
 	// iFlow CLI is pre-installed in Docker image
-	info("iFlow CLI is pre-installed and ready to use")
+	logger.Info("iFlow CLI is pre-installed and ready to use")
 
-	// Configure iFlow settings
-	info("Configuring iFlow settings...")
-	if err := configureIFlow(); err != nil {
-		return fmt.Errorf("failed to configure iFlow: %w", err)
+	result, err := runner.Run(ctx, cfg)
+	if err != nil {
+		return err
 	}
 
-	// Execute pre-command if specified
-	if config.PreCmd != "" {
-		info(fmt.Sprintf("Executing pre-command: %s", config.PreCmd))
-		if err := executePreCmd(); err != nil {
-			return fmt.Errorf("failed to execute pre-command: %w", err)
-		}
+	if result.Cancelled {
+		return fmt.Errorf("iFlow CLI execution was cancelled")
 	}
 
-	// Execute iFlow CLI command with --prompt and --yolo flags
-	info(fmt.Sprintf("Executing iFlow CLI prompt with --prompt and --yolo: %s", config.Prompt))
-	info(fmt.Sprintf("Command timeout set to: %d seconds", config.Timeout))
-	result, exitCode, err := executeIFlow()
-	if err != nil {
-		return fmt.Errorf("failed to execute iFlow CLI: %w", err)
+	if result.CommitError != "" {
+		return fmt.Errorf("%s", result.CommitError)
 	}
 
-	// Set outputs (GitHub Actions mode) or print results (CLI mode)
-	if config.UseEnvVars || isGitHubActions() {
-		setOutput("result", result)
-		setOutput("exit_code", fmt.Sprintf("%d", exitCode))
+	if result.ExitCode != 0 {
+		return fmt.Errorf("iFlow CLI exited with code %d", result.ExitCode)
+	}
 
-		fmt.Println(result)
+	logger.Info("iFlow CLI execution completed successfully")
+	return nil
+}
 
-		// Write to GitHub Actions step summary
-		if err := writeStepSummary(result, exitCode); err != nil {
-			info(fmt.Sprintf("Failed to write step summary: %v", err))
+// resolveConfig layers the config file, the selected profile and the INPUT_*
+// variables over the flag defaults, keeping explicitly passed flags on top.
+func resolveConfig(flags *pflag.FlagSet, explicit action.Config, logger action.Logger) (action.Config, error) {
+	if flags.Changed("steps") {
+		steps, err := action.ParseSteps(stepsYAML)
+		if err != nil {
+			return explicit, err
 		}
-	} else {
-		fmt.Printf("Exit Code: %d\n", exitCode)
-		fmt.Printf("Result:\n%s\n", result)
+		explicit.Steps = steps
 	}
+	cfg := explicit
 
-	if exitCode != 0 {
-		if config.UseEnvVars || isGitHubActions() {
-			setFailed(fmt.Sprintf("iFlow CLI exited with code %d", exitCode))
+	if actionsMode() {
+		if cfg.ConfigFile == "" {
+			cfg.ConfigFile = strings.TrimSpace(getInput("config_file"))
+		}
+		if cfg.Profile == "" {
+			cfg.Profile = strings.TrimSpace(getInput("profile"))
 		}
-		return fmt.Errorf("iFlow CLI exited with code %d", exitCode)
 	}
 
-	info("iFlow CLI execution completed successfully")
-	return nil
-}
+	// Layer the repository config file over the flag defaults
+	if err := action.LoadConfigFile(&cfg); err != nil {
+		return cfg, fmt.Errorf("failed to load config file: %w", err)
+	}
+	if cfg.ConfigFile != "" {
+		logger.Info(fmt.Sprintf("Loaded configuration from %s", cfg.ConfigFile))
+	}
+	if cfg.Profile != "" {
+		logger.Info(fmt.Sprintf("Using profile: %s", cfg.Profile))
+	}
+
+	// If use-env-vars is set or we detect GitHub Actions environment, use environment variables.
+	// Invalid inputs are returned together with the otherwise complete config
+	var inputErr error
+	if actionsMode() {
+		if err := LoadConfigFromEnv(&cfg, logger); err != nil {
+			inputErr = fmt.Errorf("failed to load config from environment: %w", err)
+		}
+	}
 
-func isGitHubActions() bool {
-	return os.Getenv("GITHUB_ACTIONS") == "true"
+	applyExplicitFlags(flags, &cfg, explicit)
+	return cfg, inputErr
 }
 
 // LoadConfigFromEnv loads configuration from environment variables (GitHub Actions convention)
 // This function is exported for testing purposes
-func LoadConfigFromEnv() error {
+func LoadConfigFromEnv(cfg *action.Config, logger action.Logger) error {
+	// Collect every invalid input instead of stopping at the first one; the
+	// value below an invalid input is kept
+	var problems []error
+
 	// Load configuration from environment variables (GitHub Actions convention)
 	if prompt := getInput("prompt"); prompt != "" {
-		config.Prompt = strings.TrimSpace(prompt)
+		cfg.Prompt = strings.TrimSpace(prompt)
+	}
+	if promptFile := getInput("prompt_file"); promptFile != "" {
+		cfg.PromptFile = strings.TrimSpace(promptFile)
+	}
+	if renderPrompt := getInput("render_prompt"); renderPrompt != "" {
+		render, err := parseBoolInput("render_prompt", renderPrompt)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.RenderPrompt = render
+		}
 	}
 	if apiKey := getInput("api_key"); apiKey != "" {
-		config.APIKey = apiKey
+		cfg.APIKey = apiKey
+		cfg.SetExplicit("api_key")
 	}
 	if settingsJSON := getInput("settings_json"); settingsJSON != "" {
-		config.SettingsJSON = settingsJSON
+		cfg.SettingsJSON = settingsJSON
+	}
+	if settingsFile := getInput("settings_file"); settingsFile != "" {
+		cfg.SettingsFile = strings.TrimSpace(settingsFile)
+	}
+	if settingsMerge := getInput("settings_merge"); settingsMerge != "" {
+		cfg.SettingsMerge = strings.TrimSpace(settingsMerge)
+	}
+	if printSettings := getInput("print_settings"); printSettings != "" {
+		enabled, err := parseBoolInput("print_settings", printSettings)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.PrintSettings = enabled
+		}
+	}
+	if restoreSettings := getInput("restore_settings"); restoreSettings != "" {
+		enabled, err := parseBoolInput("restore_settings", restoreSettings)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.RestoreSettings = enabled
+		}
+	}
+	if mergeExisting := getInput("merge_existing_settings"); mergeExisting != "" {
+		enabled, err := parseBoolInput("merge_existing_settings", mergeExisting)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.MergeExistingSettings = enabled
+		}
+	}
+	if isolatedHome := getInput("isolated_home"); isolatedHome != "" {
+		enabled, err := parseBoolInput("isolated_home", isolatedHome)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.IsolatedHome = enabled
+		}
 	}
 	if baseURL := getInput("base_url"); baseURL != "" {
-		config.BaseURL = baseURL
+		cfg.BaseURL = baseURL
+		cfg.SetExplicit("base_url")
 	}
 	if model := getInput("model"); model != "" {
-		config.Model = model
+		cfg.Model = model
+		cfg.SetExplicit("model")
 	}
 	if workingDir := getInput("working_directory"); workingDir != "" {
-		config.WorkingDir = workingDir
+		cfg.WorkingDir = workingDir
 	}
 	if timeoutStr := getInput("timeout"); timeoutStr != "" {
-		info(fmt.Sprintf("Parsing timeout value from input: '%s'", timeoutStr))
+		logger.Info(fmt.Sprintf("Parsing timeout value from input: '%s'", timeoutStr))
 		timeout, err := strconv.Atoi(timeoutStr)
 		if err != nil {
-			if config.UseEnvVars || isGitHubActions() {
-				setFailed(fmt.Sprintf("Invalid timeout value: '%s'. Timeout must be a valid integer between 1 and 86400 seconds.", timeoutStr))
-			}
-			return fmt.Errorf("invalid timeout value: '%s'. Timeout must be a valid integer between 1 and 86400 seconds", timeoutStr)
+			problems = append(problems, fmt.Errorf("invalid timeout value: '%s'. Timeout must be a valid integer between 1 and 86400 seconds", timeoutStr))
+		} else {
+			cfg.Timeout = timeout
+			logger.Info(fmt.Sprintf("Timeout value set to: %d seconds", cfg.Timeout))
 		}
-		config.Timeout = timeout
-		info(fmt.Sprintf("Timeout value set to: %d seconds", config.Timeout))
 	}
 
-	if extraArgs := getInput("extra_args"); extraArgs != "" {
-		config.ExtraArgs = strings.TrimSpace(extraArgs)
-		info(fmt.Sprintf("Extra arguments set to: '%s'", config.ExtraArgs))
-	}
-
-	if preCmd := getInput("precmd"); preCmd != "" {
-		config.PreCmd = strings.TrimSpace(preCmd)
-		info(fmt.Sprintf("Pre-command set to: '%s'", config.PreCmd))
-	}
-
-	return nil
-}
-
-// For backward compatibility
-func loadConfigFromEnv() error {
-	return LoadConfigFromEnv()
-}
-
-func validateConfig() error {
-	// Validate required inputs
-	if config.Prompt == "" {
-		if config.UseEnvVars || isGitHubActions() {
-			setFailed("prompt input is required and cannot be empty")
-			return fmt.Errorf("prompt input is required and cannot be empty")
+	if idleStr := getInput("idle_timeout"); idleStr != "" {
+		idle, err := strconv.Atoi(strings.TrimSpace(idleStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid idle_timeout value: '%s'. Idle timeout must be a valid number of seconds", idleStr))
+		} else {
+			cfg.IdleTimeout = idle
 		}
-		return fmt.Errorf("prompt is required and cannot be empty")
 	}
 
-	if config.APIKey == "" && config.SettingsJSON == "" {
-		if config.UseEnvVars || isGitHubActions() {
-			setFailed("api_key input is required and cannot be empty")
-			return fmt.Errorf("api_key input is required and cannot be empty")
+	if graceStr := getInput("kill_grace_period"); graceStr != "" {
+		grace, err := strconv.Atoi(strings.TrimSpace(graceStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid kill_grace_period value: '%s'. Kill grace period must be a valid number of seconds", graceStr))
+		} else {
+			cfg.KillGracePeriod = grace
 		}
-		return fmt.Errorf("api-key is required when settings-json is not provided")
 	}
 
-	// Validate timeout range (1 second to 24 hours)
-	if config.Timeout < 1 || config.Timeout > 86400 {
-		if config.UseEnvVars || isGitHubActions() {
-			setFailed(fmt.Sprintf("Timeout value %d is out of range. Timeout must be between 1 and 86400 seconds (24 hours).", config.Timeout))
+	if retriesStr := getInput("retries"); retriesStr != "" {
+		retries, err := strconv.Atoi(strings.TrimSpace(retriesStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid retries value: '%s'. Retries must be a valid integer between 0 and 10", retriesStr))
+		} else {
+			cfg.Retries = retries
 		}
-		return fmt.Errorf("timeout value %d is out of range. Timeout must be between 1 and 86400 seconds (24 hours)", config.Timeout)
 	}
 
-	return nil
-}
-
-// Helper functions for GitHub Actions
-func getInput(name string) string {
-	// GitHub Actions sets inputs as environment variables with INPUT_ prefix
-	envName := "INPUT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
-	return os.Getenv(envName)
-}
-
-func setOutput(name, value string) {
-	// GitHub Actions outputs can be set using the GITHUB_OUTPUT file
-	if outputFile := os.Getenv("GITHUB_OUTPUT"); outputFile != "" {
-		f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if backoffStr := getInput("retry_backoff"); backoffStr != "" {
+		backoff, err := strconv.Atoi(strings.TrimSpace(backoffStr))
 		if err != nil {
-			fmt.Printf("::error::Failed to open output file: %v\n", err)
-			return
+			problems = append(problems, fmt.Errorf("invalid retry_backoff value: '%s'. Retry backoff must be a valid number of seconds", backoffStr))
+		} else {
+			cfg.RetryBackoff = backoff
 		}
-		defer f.Close()
+	}
+
+	if retryOn := getInput("retry_on"); retryOn != "" {
+		cfg.RetryOn = action.SplitLines(retryOn)
+	}
 
-		// Use proper GitHub Actions output format with multiline support
-		delimiter := fmt.Sprintf("EOF_%d", os.Getpid())
-		_, err = f.WriteString(fmt.Sprintf("%s<<%s\n%s\n%s\n", name, delimiter, value, delimiter))
+	if stepsInput := getInput("steps"); stepsInput != "" {
+		steps, err := action.ParseSteps(stepsInput)
 		if err != nil {
-			fmt.Printf("::error::Failed to write output: %v\n", err)
+			problems = append(problems, err)
+		} else {
+			cfg.Steps = steps
 		}
-	} else {
-		// Fallback to legacy format if GITHUB_OUTPUT is not available
-		fmt.Printf("::set-output name=%s::%s\n", name, value)
 	}
-}
 
-func info(message string) {
-	if isGitHubActions() {
-		fmt.Printf("::notice::%s\n", message)
-	} else {
-		fmt.Printf("INFO: %s\n", message)
+	if models := getInput("models"); models != "" {
+		cfg.Models = action.SplitLines(models)
 	}
-}
-
-func setFailed(message string) {
-	fmt.Printf("::error::%s\n", message)
-	os.Exit(1)
-}
 
-func printIFlowVersion() {
-	// Run iflow --version and print the output
-	cmd := exec.Command("iflow", "--version")
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		info(fmt.Sprintf("Warning: Failed to get iFlow version: %v", err))
-		return
+	if concurrencyStr := getInput("model_concurrency"); concurrencyStr != "" {
+		concurrency, err := strconv.Atoi(strings.TrimSpace(concurrencyStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid model_concurrency value: '%s'. Model concurrency must be a valid integer between 1 and 10", concurrencyStr))
+		} else {
+			cfg.ModelConcurrency = concurrency
+		}
 	}
-	info(fmt.Sprintf("iFlow CLI version: %s", strings.TrimSpace(string(output))))
-}
 
-func configureIFlow() error {
-	homeDir, err := os.UserHomeDir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+	if sizeStr := getInput("max_output_size"); sizeStr != "" {
+		size, err := strconv.Atoi(strings.TrimSpace(sizeStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid max_output_size value: '%s'. Max output size must be a valid number of bytes", sizeStr))
+		} else {
+			cfg.MaxOutputSize = size
+		}
 	}
 
-	iflowDir := filepath.Join(homeDir, ".iflow")
-	if err := os.MkdirAll(iflowDir, 0755); err != nil {
-		return fmt.Errorf("failed to create .iflow directory: %w", err)
+	if reportFile := getInput("report_file"); reportFile != "" {
+		cfg.ReportFile = strings.TrimSpace(reportFile)
 	}
 
-	settingsFile := filepath.Join(iflowDir, "settings.json")
-
-	var settingsData []byte
-
-	if config.SettingsJSON != "" {
-		// Use provided settings JSON directly
-		info("Using provided settings.json content")
+	if outputSchema := getInput("output_schema"); outputSchema != "" {
+		cfg.OutputSchema = strings.TrimSpace(outputSchema)
+	}
 
-		// Validate that it's valid JSON
-		var testSettings map[string]interface{}
-		if err := json.Unmarshal([]byte(config.SettingsJSON), &testSettings); err != nil {
-			return fmt.Errorf("invalid settings_json provided: %w", err)
+	if retriesStr := getInput("json_retries"); retriesStr != "" {
+		retries, err := strconv.Atoi(strings.TrimSpace(retriesStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid json_retries value: '%s'. JSON retries must be a valid integer between 0 and 5", retriesStr))
+		} else {
+			cfg.JSONRetries = retries
 		}
+	}
 
-		// Pretty format the JSON
-		var prettyJSON json.RawMessage = []byte(config.SettingsJSON)
-		settingsData, err = json.MarshalIndent(prettyJSON, "", "  ")
+	if transcript := getInput("transcript"); transcript != "" {
+		enabled, err := parseBoolInput("transcript", transcript)
 		if err != nil {
-			return fmt.Errorf("failed to format settings JSON: %w", err)
-		}
-	} else {
-		// Create settings from individual parameters
-		info("Creating settings from individual parameters")
-		settings := IFlowSettings{
-			Theme:            "Default",
-			SelectedAuthType: "iflow",
-			APIKey:           config.APIKey,
-			BaseURL:          config.BaseURL,
-			ModelName:        config.Model,
-			SearchAPIKey:     config.APIKey,
+			problems = append(problems, err)
+		} else {
+			cfg.Transcript = enabled
 		}
+	}
 
-		settingsData, err = json.MarshalIndent(settings, "", "  ")
+	if usePTY := getInput("use_pty"); usePTY != "" {
+		enabled, err := parseBoolInput("use_pty", usePTY)
 		if err != nil {
-			return fmt.Errorf("failed to marshal settings: %w", err)
+			problems = append(problems, err)
+		} else {
+			cfg.UsePTY = enabled
 		}
 	}
 
-	if err := os.WriteFile(settingsFile, settingsData, 0644); err != nil {
-		return fmt.Errorf("failed to write settings file: %w", err)
+	if mode := getInput("mode"); mode != "" {
+		cfg.Mode = strings.TrimSpace(mode)
 	}
 
-	info(fmt.Sprintf("iFlow settings configured at %s", settingsFile))
-	return nil
-}
-
-func executePreCmd() error {
-	// Split the precmd into lines and execute each line
-	commands := strings.Split(config.PreCmd, "\n")
-
-	for _, command := range commands {
-		// Skip empty lines
-		command = strings.TrimSpace(command)
-		if command == "" {
-			continue
+	if commitChanges := getInput("commit_changes"); commitChanges != "" {
+		enabled, err := parseBoolInput("commit_changes", commitChanges)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.CommitChanges = enabled
 		}
+	}
 
-		info(fmt.Sprintf("Executing pre-command: %s", command))
-
-		// Create a command to execute the pre-command
-		cmd := exec.Command("sh", "-c", command)
-
-		// Set the working directory for the command
-		cmd.Dir = config.WorkingDir
-
-		// Connect the command's stdin, stdout, and stderr to the current process
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		// Execute the command and wait for it to complete
-		if err := cmd.Run(); err != nil {
-			return fmt.Errorf("pre-command failed: %w", err)
+	if generate := getInput("generate_commit_message"); generate != "" {
+		enabled, err := parseBoolInput("generate_commit_message", generate)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.GenerateCommitMessage = enabled
 		}
 	}
 
-	return nil
-}
-
-func executeIFlow() (string, int, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(config.Timeout)*time.Second)
-	defer cancel()
-
-	// Prepare the command with --prompt and --yolo flags by default
-	// Use --prompt and --yolo flags for all commands
-	args := []string{"--yolo", "--prompt", config.Prompt}
-
-	// Parse and add extra arguments if provided
-	if config.ExtraArgs != "" {
-		extraArgs := parseExtraArgs(config.ExtraArgs)
-		args = append(args, extraArgs...)
-		info(fmt.Sprintf("Using additional arguments: %v", extraArgs))
+	if signoff := getInput("commit_signoff"); signoff != "" {
+		enabled, err := parseBoolInput("commit_signoff", signoff)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.CommitSignoff = enabled
+		}
 	}
 
-	cmd := exec.CommandContext(ctx, "iflow", args...)
-
-	// Create pipes for real-time output streaming
-	stdoutPipe, err := cmd.StdoutPipe()
-	if err != nil {
-		return "", 1, fmt.Errorf("failed to create stdout pipe: %w", err)
+	if push := getInput("push_changes"); push != "" {
+		enabled, err := parseBoolInput("push_changes", push)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.PushChanges = enabled
+		}
 	}
 
-	stderrPipe, err := cmd.StderrPipe()
-	if err != nil {
-		return "", 1, fmt.Errorf("failed to create stderr pipe: %w", err)
+	if branchName := getInput("branch_name"); branchName != "" {
+		cfg.BranchName = strings.TrimSpace(branchName)
 	}
-
-	// Buffer to capture all output for GitHub summary
-	var outputBuffer strings.Builder
-
-	// Create multi-writers to write to both console and buffer
-	stdoutWriter := io.MultiWriter(os.Stdout, &outputBuffer)
-	stderrWriter := io.MultiWriter(os.Stderr, &outputBuffer)
-
-	// Start the command
-	if err := cmd.Start(); err != nil {
-		return "", 1, fmt.Errorf("failed to start command: %w", err)
+	if commitMessage := getInput("commit_message"); commitMessage != "" {
+		cfg.CommitMessage = strings.TrimSpace(commitMessage)
 	}
-
-	// Use WaitGroup to ensure both goroutines complete
-	var wg sync.WaitGroup
-	// Create channels for goroutines to report errors
-	errorChan := make(chan error, 2)
-
-	// Start goroutines to stream output in real-time
-	wg.Add(2)
-	go func() {
-		defer wg.Done()
-		_, err := io.Copy(stdoutWriter, stdoutPipe)
-		errorChan <- err
-	}()
-
-	go func() {
-		defer wg.Done()
-		_, err := io.Copy(stderrWriter, stderrPipe)
-		errorChan <- err
-	}()
-
-	// Wait for command completion
-	err = cmd.Wait()
-
-	// Wait for both output streaming goroutines to complete
-	wg.Wait()
-	close(errorChan)
-
-	// Check for timeout first
-	if ctx.Err() == context.DeadlineExceeded {
-		config.IsTimeout = true
-		return outputBuffer.String(), 124, fmt.Errorf("command timed out after %d seconds", config.Timeout)
+	if authorName := getInput("commit_author_name"); authorName != "" {
+		cfg.CommitAuthorName = strings.TrimSpace(authorName)
+	}
+	if authorEmail := getInput("commit_author_email"); authorEmail != "" {
+		cfg.CommitAuthorEmail = strings.TrimSpace(authorEmail)
 	}
 
-	// Check for streaming errors (but don't fail if we got output)
-	for streamErr := range errorChan {
-		if streamErr != nil && streamErr != io.EOF {
-			// Log streaming errors but continue
-			fmt.Fprintf(os.Stderr, "Warning: output streaming error: %v\n", streamErr)
+	if detectChanges := getInput("detect_changes"); detectChanges != "" {
+		enabled, err := parseBoolInput("detect_changes", detectChanges)
+		if err != nil {
+			problems = append(problems, err)
+		} else {
+			cfg.DetectChanges = enabled
 		}
 	}
 
-	exitCode := 0
-	if err != nil {
-		if exitError, ok := err.(*exec.ExitError); ok {
-			exitCode = exitError.ExitCode()
+	if stripANSI := getInput("strip_ansi"); stripANSI != "" {
+		enabled, err := parseBoolInput("strip_ansi", stripANSI)
+		if err != nil {
+			problems = append(problems, err)
 		} else {
-			// Non-exit error (e.g., command not found)
-			return outputBuffer.String(), 1, err
+			cfg.StripANSI = enabled
 		}
 	}
 
-	return outputBuffer.String(), exitCode, nil
-}
-
-// parseExtraArgs parses a space-separated string of arguments into a slice
-// Handles quoted arguments with spaces properly
-func parseExtraArgs(extraArgs string) []string {
-	if extraArgs == "" {
-		return []string{}
-	}
-
-	var args []string
-	var current strings.Builder
-	inQuotes := false
-	var quoteChar rune
-
-	for i, char := range extraArgs {
-		switch char {
-		case '"', '\'':
-			if !inQuotes {
-				// Start of quoted string
-				inQuotes = true
-				quoteChar = char
-			} else if char == quoteChar {
-				// End of quoted string
-				inQuotes = false
-				quoteChar = 0
-			} else {
-				// Quote character inside different quotes
-				current.WriteRune(char)
-			}
-		case ' ', '\t', '\n':
-			if inQuotes {
-				// Space inside quotes, add to current argument
-				current.WriteRune(char)
-			} else {
-				// Space outside quotes, end current argument
-				if current.Len() > 0 {
-					args = append(args, current.String())
-					current.Reset()
-				}
-			}
-		default:
-			current.WriteRune(char)
+	if memoryStr := getInput("max_memory_mb"); memoryStr != "" {
+		memory, err := strconv.Atoi(strings.TrimSpace(memoryStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid max_memory_mb value: '%s'. Max memory must be a valid number of MB", memoryStr))
+		} else {
+			cfg.MaxMemoryMB = memory
 		}
+	}
 
-		// Handle end of string
-		if i == len(extraArgs)-1 && current.Len() > 0 {
-			args = append(args, current.String())
+	if cpuStr := getInput("max_cpu_seconds"); cpuStr != "" {
+		cpu, err := strconv.Atoi(strings.TrimSpace(cpuStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid max_cpu_seconds value: '%s'. Max CPU time must be a valid number of seconds", cpuStr))
+		} else {
+			cfg.MaxCPUSeconds = cpu
 		}
 	}
 
-	return args
-}
+	if filesStr := getInput("max_open_files"); filesStr != "" {
+		files, err := strconv.Atoi(strings.TrimSpace(filesStr))
+		if err != nil {
+			problems = append(problems, fmt.Errorf("invalid max_open_files value: '%s'. Max open files must be a valid integer", filesStr))
+		} else {
+			cfg.MaxOpenFiles = files
+		}
+	}
 
-func writeStepSummary(result string, exitCode int) error {
-	summaryFile := os.Getenv("GITHUB_STEP_SUMMARY")
-	if summaryFile == "" {
-		// Not in GitHub Actions environment or summary not supported
-		return nil
+	if extraArgs := getInput("extra_args"); extraArgs != "" {
+		cfg.ExtraArgs = strings.TrimSpace(extraArgs)
 	}
 
-	f, err := os.OpenFile(summaryFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-	if err != nil {
-		return fmt.Errorf("failed to open step summary file: %w", err)
+	if preCmd := getInput("precmd"); preCmd != "" {
+		cfg.PreCmd = strings.TrimSpace(preCmd)
 	}
-	defer f.Close()
 
-	// Write summary in Markdown format
-	summaryContent := generateSummaryMarkdown(result, exitCode)
+	if maskValues := getInput("mask_values"); maskValues != "" {
+		cfg.MaskValues = action.SplitLines(maskValues)
+	}
 
-	_, err = f.WriteString(summaryContent)
-	if err != nil {
-		return fmt.Errorf("failed to write to step summary: %w", err)
+	if redactPatterns := getInput("redact_patterns"); redactPatterns != "" {
+		cfg.RedactPatterns = action.SplitLines(redactPatterns)
 	}
 
+	if len(problems) > 0 {
+		return &inputError{problems: problems}
+	}
 	return nil
 }
 
-func generateSummaryMarkdown(result string, exitCode int) string {
-	var summary strings.Builder
-
-	// Add header with emoji based on status
-	if config.IsTimeout {
-		summary.WriteString("## ⏰ iFlow CLI Execution Summary - Timeout\n\n")
-	} else if exitCode == 0 {
-		summary.WriteString("## ✅ iFlow CLI Execution Summary\n\n")
-	} else {
-		summary.WriteString("## ❌ iFlow CLI Execution Summary\n\n")
-	}
-
-	// Add execution status with more detail
-	summary.WriteString("### 📊 Status\n\n")
-	if config.IsTimeout {
-		summary.WriteString("⏰ **Execution**: Timed Out\n")
-		summary.WriteString(fmt.Sprintf("🕒 **Timeout Duration**: %d seconds\n", config.Timeout))
-		summary.WriteString(fmt.Sprintf("💥 **Exit Code**: %d\n\n", exitCode))
-	} else if exitCode == 0 {
-		summary.WriteString("🎉 **Execution**: Successful\n")
-		summary.WriteString("🎯 **Exit Code**: 0\n\n")
-	} else {
-		summary.WriteString("⚠️ **Execution**: Failed\n")
-		summary.WriteString(fmt.Sprintf("💥 **Exit Code**: %d\n\n", exitCode))
-	}
-
-	// Add configuration details in a table format
-	summary.WriteString("### ⚙️ Configuration\n\n")
-	summary.WriteString("| Setting | Value |\n")
-	summary.WriteString("|---------|-------|\n")
-	summary.WriteString(fmt.Sprintf("| Model | `%s` |\n", config.Model))
-	summary.WriteString(fmt.Sprintf("| Base URL | `%s` |\n", config.BaseURL))
-	summary.WriteString(fmt.Sprintf("| Timeout | %d seconds |\n", config.Timeout))
-	summary.WriteString(fmt.Sprintf("| Working Directory | `%s` |\n", config.WorkingDir))
-	if config.ExtraArgs != "" {
-		summary.WriteString(fmt.Sprintf("| Extra Arguments | `%s` |\n", config.ExtraArgs))
-	}
-	summary.WriteString("\n")
-
-	// Add prompt section
-	summary.WriteString("### 📝 Input Prompt\n\n")
-	prompt := config.Prompt
-	if len(prompt) > 300 {
-		prompt = prompt[:300] + "..."
-	}
-	// Escape any markdown characters in the prompt
-	prompt = strings.ReplaceAll(prompt, "`", "\\`")
-	summary.WriteString(fmt.Sprintf("> %s\n\n", prompt))
-
-	// Add result section with better formatting
-	summary.WriteString("### Output\n\n")
-	if exitCode == 0 {
-		displayResult := result
-		if len(result) > 3000 {
-			displayResult = result[:3000] + "\n\n... *(Output truncated. See full output in action logs)*"
-		}
-
-		// Check if result contains markdown or code blocks
-		if strings.Contains(result, "```") {
-			// Result already contains code blocks, display as-is
-			summary.WriteString(fmt.Sprintf("%s\n\n", displayResult))
-		} else if containsCode(result) {
-			// Result looks like code, wrap in code block
-			summary.WriteString(fmt.Sprintf("```\n%s\n```\n\n", displayResult))
-		} else {
-			// Regular text result, format as blockquote for readability
-			lines := strings.Split(displayResult, "\n")
-			for _, line := range lines {
-				if strings.TrimSpace(line) != "" {
-					summary.WriteString(fmt.Sprintf("> %s\n", line))
-				} else {
-					summary.WriteString(">\n")
-				}
-			}
-			summary.WriteString("\n")
-		}
-	} else {
-		// Error output, always in code block
-		summary.WriteString("```\n")
-		summary.WriteString(result)
-		summary.WriteString("\n```\n\n")
-
-		// Add troubleshooting hints for common errors
-		if config.IsTimeout {
-			summary.WriteString("#### ⏰ Timeout Information\n\n")
-			summary.WriteString(fmt.Sprintf("- **Configured Timeout**: %d seconds\n", config.Timeout))
-			summary.WriteString("- **Reason**: The iFlow CLI command did not complete within the specified timeout period\n")
-			summary.WriteString("- **Exit Code**: 124 (timeout)\n\n")
-
-			summary.WriteString("#### 🔧 Timeout Troubleshooting\n\n")
-			summary.WriteString("- **Increase timeout**: Consider increasing the timeout value if the task legitimately needs more time\n")
-			summary.WriteString("- **Optimize prompt**: Try breaking down complex prompts into smaller, more focused requests\n")
-			summary.WriteString("- **Check model performance**: Some models may require longer processing time\n")
-			summary.WriteString("- **Network issues**: Verify network connectivity and API response times\n")
-			summary.WriteString("- **Resource constraints**: Check if the system has sufficient resources (CPU, memory)\n\n")
-		} else if strings.Contains(result, "API Error") {
-			summary.WriteString("#### 🔧 Troubleshooting Hints\n\n")
-			summary.WriteString("- Check if your API key is valid and active\n")
-			summary.WriteString("- Verify the base URL is accessible\n")
-			summary.WriteString("- Ensure the selected model is available\n")
-			summary.WriteString("- Try increasing the timeout value\n\n")
-		}
-	}
+// inputError lists every INPUT_* variable that could not be parsed.
+type inputError struct {
+	problems []error
+}
 
-	// Add performance metrics if available
-	summary.WriteString("### 📈 Metrics\n\n")
-	summary.WriteString(fmt.Sprintf("- **Execution Time**: %s\n", time.Now().UTC().Format("2006-01-02 15:04:05 UTC")))
-	summary.WriteString(fmt.Sprintf("- **Output Length**: %d characters\n", len(result)))
-	if config.IsTimeout {
-		summary.WriteString(fmt.Sprintf("- **Timeout Duration**: %d seconds\n", config.Timeout))
-		summary.WriteString("- **Success Rate**: 0% (Timeout)\n\n")
-	} else if exitCode == 0 {
-		summary.WriteString("- **Success Rate**: 100%\n\n")
-	} else {
-		summary.WriteString("- **Success Rate**: 0%\n\n")
+func (e *inputError) Error() string {
+	messages := make([]string, len(e.problems))
+	for i, problem := range e.problems {
+		messages[i] = problem.Error()
 	}
+	return strings.Join(messages, "; ")
+}
 
-	// Add footer
-	summary.WriteString("---\n")
-	summary.WriteString("*🤖 Generated by [iFlow CLI Action](https://github.com/iflow-ai/iflow-cli-action)*\n\n")
-
-	return summary.String()
+func (e *inputError) Unwrap() []error {
+	return e.problems
 }
 
-// Helper function to detect if text looks like code
-func containsCode(text string) bool {
-	codeIndicators := []string{
-		"function", "class", "def ", "import ", "const ", "let ", "var ",
-		"public ", "private ", "protected", "return ", "if (", "for (", "while (",
-		"{", "}", ";", "//", "/*", "*/", "#include", "package ", "use ",
+// applyExplicitFlags restores values for flags that were set explicitly on the
+// command line, so they win over both the config file and INPUT_* variables.
+func applyExplicitFlags(flags *pflag.FlagSet, cfg *action.Config, explicit action.Config) {
+	if flags.Changed("prompt") {
+		cfg.Prompt = explicit.Prompt
 	}
-
-	lowerText := strings.ToLower(text)
-	for _, indicator := range codeIndicators {
-		if strings.Contains(lowerText, indicator) {
-			return true
-		}
+	if flags.Changed("prompt-file") {
+		cfg.PromptFile = explicit.PromptFile
+	}
+	if flags.Changed("render-prompt") {
+		cfg.RenderPrompt = explicit.RenderPrompt
+	}
+	if flags.Changed("api-key") {
+		cfg.APIKey = explicit.APIKey
+		cfg.SetExplicit("api_key")
+	}
+	if flags.Changed("settings-json") {
+		cfg.SettingsJSON = explicit.SettingsJSON
+	}
+	if flags.Changed("settings-file") {
+		cfg.SettingsFile = explicit.SettingsFile
+	}
+	if flags.Changed("settings-merge") {
+		cfg.SettingsMerge = explicit.SettingsMerge
+	}
+	if flags.Changed("print-settings") {
+		cfg.PrintSettings = explicit.PrintSettings
+	}
+	if flags.Changed("restore-settings") {
+		cfg.RestoreSettings = explicit.RestoreSettings
+	}
+	if flags.Changed("merge-existing-settings") {
+		cfg.MergeExistingSettings = explicit.MergeExistingSettings
+	}
+	if flags.Changed("isolated-home") {
+		cfg.IsolatedHome = explicit.IsolatedHome
+	}
+	if flags.Changed("base-url") {
+		cfg.BaseURL = explicit.BaseURL
+		cfg.SetExplicit("base_url")
+	}
+	if flags.Changed("model") {
+		cfg.Model = explicit.Model
+		cfg.SetExplicit("model")
+	}
+	if flags.Changed("working-directory") {
+		cfg.WorkingDir = explicit.WorkingDir
+	}
+	if flags.Changed("timeout") {
+		cfg.Timeout = explicit.Timeout
+	}
+	if flags.Changed("idle-timeout") {
+		cfg.IdleTimeout = explicit.IdleTimeout
+	}
+	if flags.Changed("kill-grace-period") {
+		cfg.KillGracePeriod = explicit.KillGracePeriod
+	}
+	if flags.Changed("retries") {
+		cfg.Retries = explicit.Retries
+	}
+	if flags.Changed("retry-backoff") {
+		cfg.RetryBackoff = explicit.RetryBackoff
+	}
+	if flags.Changed("retry-on") {
+		cfg.RetryOn = explicit.RetryOn
+	}
+	if flags.Changed("max-output-size") {
+		cfg.MaxOutputSize = explicit.MaxOutputSize
+	}
+	if flags.Changed("report-file") {
+		cfg.ReportFile = explicit.ReportFile
+	}
+	if flags.Changed("output-schema") {
+		cfg.OutputSchema = explicit.OutputSchema
+	}
+	if flags.Changed("json-retries") {
+		cfg.JSONRetries = explicit.JSONRetries
+	}
+	if flags.Changed("transcript") {
+		cfg.Transcript = explicit.Transcript
+	}
+	if flags.Changed("use-pty") {
+		cfg.UsePTY = explicit.UsePTY
+	}
+	if flags.Changed("mode") {
+		cfg.Mode = explicit.Mode
+	}
+	if flags.Changed("commit-changes") {
+		cfg.CommitChanges = explicit.CommitChanges
+	}
+	if flags.Changed("branch-name") {
+		cfg.BranchName = explicit.BranchName
+	}
+	if flags.Changed("commit-message") {
+		cfg.CommitMessage = explicit.CommitMessage
+	}
+	if flags.Changed("generate-commit-message") {
+		cfg.GenerateCommitMessage = explicit.GenerateCommitMessage
+	}
+	if flags.Changed("commit-author-name") {
+		cfg.CommitAuthorName = explicit.CommitAuthorName
+	}
+	if flags.Changed("commit-author-email") {
+		cfg.CommitAuthorEmail = explicit.CommitAuthorEmail
+	}
+	if flags.Changed("commit-signoff") {
+		cfg.CommitSignoff = explicit.CommitSignoff
+	}
+	if flags.Changed("push-changes") {
+		cfg.PushChanges = explicit.PushChanges
+	}
+	if flags.Changed("detect-changes") {
+		cfg.DetectChanges = explicit.DetectChanges
+	}
+	if flags.Changed("strip-ansi") {
+		cfg.StripANSI = explicit.StripANSI
+	}
+	if flags.Changed("max-memory-mb") {
+		cfg.MaxMemoryMB = explicit.MaxMemoryMB
+	}
+	if flags.Changed("max-cpu-seconds") {
+		cfg.MaxCPUSeconds = explicit.MaxCPUSeconds
+	}
+	if flags.Changed("max-open-files") {
+		cfg.MaxOpenFiles = explicit.MaxOpenFiles
+	}
+	if flags.Changed("extra-args") {
+		cfg.ExtraArgs = explicit.ExtraArgs
+	}
+	if flags.Changed("precmd") {
+		cfg.PreCmd = explicit.PreCmd
+	}
+	if flags.Changed("mask-value") {
+		cfg.MaskValues = explicit.MaskValues
+	}
+	if flags.Changed("redact-pattern") {
+		cfg.RedactPatterns = explicit.RedactPatterns
+	}
+	if flags.Changed("steps") {
+		cfg.Steps = explicit.Steps
+	}
+	if flags.Changed("models") {
+		cfg.Models = explicit.Models
+	}
+	if flags.Changed("model-concurrency") {
+		cfg.ModelConcurrency = explicit.ModelConcurrency
 	}
-	return false
 }
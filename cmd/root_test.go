@@ -1,63 +1,185 @@
 package cmd
 
 import (
+	"bytes"
+	"io"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/iflow-ai/iflow-cli-action/action"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
 )
 
-func TestExecutePreCmd(t *testing.T) {
-	// Change to a temporary directory for testing
-	tempDir := t.TempDir()
-	originalDir, _ := os.Getwd()
-	os.Chdir(tempDir)
-	defer os.Chdir(originalDir)
-
-	tests := []struct {
-		name        string
-		preCmd      string
-		expectError bool
-	}{
-		{
-			name:        "Single command",
-			preCmd:      "echo 'single command'",
-			expectError: false,
-		},
-		{
-			name:        "Multiple commands",
-			preCmd:      "echo 'first command'\necho 'second command'",
-			expectError: false,
-		},
-		{
-			name:        "Multiple commands with empty lines",
-			preCmd:      "echo 'first command'\n\necho 'third command'",
-			expectError: false,
-		},
-		{
-			name:        "Empty precmd",
-			preCmd:      "",
-			expectError: false,
-		},
-		{
-			name:        "Invalid command",
-			preCmd:      "nonexistentcommand12345",
-			expectError: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Set the precmd in the global config
-			config.PreCmd = tt.preCmd
-			
-			// Execute the precmd
-			err := executePreCmd()
-			
-			// Check if we expected an error
-			if tt.expectError && err == nil {
-				t.Errorf("Expected error but got none")
-			} else if !tt.expectError && err != nil {
-				t.Errorf("Unexpected error: %v", err)
-			}
-		})
-	}
-}
\ No newline at end of file
+// newTestFlags returns the root command's flags parsed from args, with the
+// parsed values stored in the returned config.
+func newTestFlags(t *testing.T, args ...string) (*pflag.FlagSet, *action.Config) {
+	t.Helper()
+	cfg := &action.Config{}
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.StringVar(&cfg.Model, "model", action.DefaultModel, "")
+	flags.StringVar(&cfg.BaseURL, "base-url", action.DefaultBaseURL, "")
+	flags.IntVar(&cfg.Timeout, "timeout", action.DefaultTimeout, "")
+	flags.StringVar(&cfg.ExtraArgs, "extra-args", "", "")
+	flags.StringVar(&cfg.ConfigFile, "config", "", "")
+	flags.StringVar(&cfg.Profile, "profile", "", "")
+	if err := flags.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return flags, cfg
+}
+
+// setActionDefaults sets an INPUT_* variable for every input of action.yml
+// with a default, as the runner does for inputs a workflow leaves out.
+func setActionDefaults(t *testing.T) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "action.yml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata struct {
+		Inputs map[string]struct {
+			Default string `yaml:"default"`
+		} `yaml:"inputs"`
+	}
+	if err := yaml.Unmarshal(data, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	for name, input := range metadata.Inputs {
+		t.Setenv("INPUT_"+strings.ToUpper(name), input.Default)
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "action.yaml")
+	content := "model: from-file\nbase_url: https://file.example/v1\ntimeout: 120\nextra_args: --from-file\nretries: 2\nmode: patch\nstrip_ansi: false\nrestore_settings: false\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	setActionDefaults(t)
+	t.Setenv("INPUT_CONFIG_FILE", configPath)
+	t.Setenv("INPUT_MODEL", "from-env")
+	t.Setenv("INPUT_EXTRA_ARGS", "--from-env")
+
+	flags, explicit := newTestFlags(t, "--extra-args", "--from-flag")
+	cfg, err := resolveConfig(flags, *explicit, action.ConsoleLogger{Out: io.Discard})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.Model != "from-env" {
+		t.Errorf("Expected env input to override config file, got model %q", cfg.Model)
+	}
+	if cfg.BaseURL != "https://file.example/v1" {
+		t.Errorf("Expected config file to override default, got base URL %q", cfg.BaseURL)
+	}
+	if cfg.Timeout != 120 {
+		t.Errorf("Expected timeout from config file, got %d", cfg.Timeout)
+	}
+	if cfg.ExtraArgs != "--from-flag" {
+		t.Errorf("Expected explicit flag to override env input, got extra args %q", cfg.ExtraArgs)
+	}
+	// Inputs the workflow leaves out must not override the config file
+	if cfg.Retries != 2 || cfg.Mode != action.ModePatch || cfg.StripANSI || cfg.RestoreSettings {
+		t.Errorf("Expected retries, mode, strip_ansi and restore_settings from config file, got %d, %q, %t and %t", cfg.Retries, cfg.Mode, cfg.StripANSI, cfg.RestoreSettings)
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "action.yaml")
+	content := "model: base-model\ntimeout: 600\nprofiles:\n  review:\n    model: review-model\n    extra_args: --debug\n  docs:\n    timeout: 300\n"
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("INPUT_PROFILE", "review")
+	t.Setenv("INPUT_EXTRA_ARGS", "--verbose")
+
+	flags, explicit := newTestFlags(t, "--config", configPath)
+	cfg, err := resolveConfig(flags, *explicit, action.ConsoleLogger{Out: io.Discard})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cfg.Model != "review-model" {
+		t.Errorf("Expected profile to override config file, got model %q", cfg.Model)
+	}
+	if cfg.Timeout != 600 {
+		t.Errorf("Expected timeout from config file, got %d", cfg.Timeout)
+	}
+	if cfg.ExtraArgs != "--verbose" {
+		t.Errorf("Expected input to override profile, got extra args %q", cfg.ExtraArgs)
+	}
+}
+
+func TestConfigExplicitInputs(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "true")
+	setActionDefaults(t)
+	t.Setenv("INPUT_MODEL", action.DefaultModel)
+
+	flags, explicit := newTestFlags(t, "--base-url", action.DefaultBaseURL)
+	cfg, err := resolveConfig(flags, *explicit, action.ConsoleLogger{Out: io.Discard})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// Inputs equal to their defaults still count as provided
+	if !cfg.ExplicitInputs["model"] || !cfg.ExplicitInputs["base_url"] {
+		t.Errorf("Expected model and base_url to be explicit, got %v", cfg.ExplicitInputs)
+	}
+	if cfg.ExplicitInputs["api_key"] {
+		t.Errorf("Expected api_key left out by the workflow not to be explicit")
+	}
+}
+
+func TestResolveConfigDoesNotLogSecrets(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "true")
+	t.Setenv("INPUT_MASK_VALUES", "s3cr3t-token")
+	t.Setenv("INPUT_EXTRA_ARGS", "--token s3cr3t-token")
+	t.Setenv("INPUT_PRECMD", "login --token s3cr3t-token")
+
+	// Masks are only registered once the runner starts, so nothing read
+	// from the inputs may be logged before
+	var out bytes.Buffer
+	flags, explicit := newTestFlags(t)
+	if _, err := resolveConfig(flags, *explicit, action.ConsoleLogger{Out: &out, GitHub: true}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Contains(out.String(), "s3cr3t-token") {
+		t.Errorf("Expected the secret not to be logged before it is masked, got %q", out.String())
+	}
+}
+
+func TestValidateReportsEveryInvalidInput(t *testing.T) {
+	t.Setenv("GITHUB_ACTIONS", "true")
+	setActionDefaults(t)
+	t.Setenv("INPUT_API_KEY", "sk-test")
+	t.Setenv("INPUT_TIMEOUT", "soon")
+	t.Setenv("INPUT_RETRIES", "many")
+	t.Setenv("INPUT_TRANSCRIPT", "maybe")
+
+	var out bytes.Buffer
+	validateCmd.SetOut(&out)
+	t.Cleanup(func() { validateCmd.SetOut(nil) })
+
+	err := runValidate(validateCmd)
+	if err == nil || !strings.Contains(err.Error(), "found 4 configuration problem(s)") {
+		t.Errorf("Expected 4 problems, got %v", err)
+	}
+	// Every invalid input is reported, followed by what Check finds
+	for _, want := range []string{
+		"::error::invalid timeout value: 'soon'",
+		"::error::invalid retries value: 'many'",
+		"::error::invalid transcript value",
+		"::error::prompt or prompt_file input is required",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected output to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
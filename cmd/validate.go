@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/iflow-ai/iflow-cli-action/action"
+	"github.com/spf13/cobra"
+)
+
+// validateCmd checks the configuration without running iFlow
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Validate the configuration without running iFlow CLI",
+	Long: `Load the configuration the same way the action does (flags, INPUT_* variables,
+config file and profile), resolve the prompt and settings, and report every
+problem found, including unknown or mistyped settings_json keys.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runValidate(cmd)
+	},
+}
+
+// schemaCmd prints the JSON Schema for the action inputs
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Print the JSON Schema for the action inputs",
+	Long: `Print a JSON Schema describing the action inputs as they appear in a config
+file, so editors can validate .iflow/action.yaml and similar files.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		schema, err := action.InputsSchema()
+		if err != nil {
+			return fmt.Errorf("failed to generate schema: %w", err)
+		}
+		fmt.Fprintln(cmd.OutOrStdout(), string(schema))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(schemaCmd)
+}
+
+func runValidate(cmd *cobra.Command) error {
+	out := cmd.OutOrStdout()
+	logger := action.ConsoleLogger{Out: out, GitHub: actionsMode()}
+
+	// Invalid inputs leave the rest of the configuration usable, so they are
+	// reported together with the problems Check finds
+	var problems []error
+	cfg, err := resolveConfig(cmd.Flags(), config, logger)
+	var inputErr *inputError
+	switch {
+	case errors.As(err, &inputErr):
+		problems = append(inputErr.problems, action.Check(cfg)...)
+	case err != nil:
+		problems = append(problems, err)
+	default:
+		problems = action.Check(cfg)
+	}
+
+	if len(problems) == 0 {
+		logger.Info("Configuration is valid")
+		return nil
+	}
+
+	for _, problem := range problems {
+		if actionsMode() {
+			fmt.Fprintf(out, "::error::%s\n", problem)
+		} else {
+			fmt.Fprintf(out, "ERROR: %s\n", problem)
+		}
+	}
+	return fmt.Errorf("found %d configuration problem(s)", len(problems))
+}